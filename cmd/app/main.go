@@ -1,13 +1,25 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"gin-layout/internal/conf"
+	"gin-layout/internal/pkg/cron"
+	"gin-layout/internal/pkg/outbox"
+	"gin-layout/internal/pkg/queue"
 	"gin-layout/pkg"
 	"github.com/gin-gonic/gin"
 	logs "github.com/sirupsen/logrus"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// defaultShutdownTimeout 退出时等待处理中的请求完成的默认时间
+const defaultShutdownTimeout = 30 * time.Second
+
 var (
 	// APIConfig api的配置
 	config  conf.AppConfig
@@ -18,6 +30,9 @@ type App struct {
 	conf   *conf.AppConfig
 	gin    *gin.Engine
 	logger *logs.Logger
+	relay  *outbox.Relay
+	worker *queue.Worker
+	cron   *cron.Scheduler
 }
 
 func init() {
@@ -27,8 +42,9 @@ func init() {
 	}
 }
 
-func newApp(conf *conf.AppConfig, engine *gin.Engine, logs *logs.Logger) *App {
-	return &App{conf: conf, gin: engine, logger: logs}
+func newApp(conf *conf.AppConfig, engine *gin.Engine, logs *logs.Logger, relay *outbox.Relay, worker *queue.Worker,
+	scheduler *cron.Scheduler) *App {
+	return &App{conf: conf, gin: engine, logger: logs, relay: relay, worker: worker, cron: scheduler}
 }
 
 func main() {
@@ -40,18 +56,59 @@ func main() {
 	app, f, err := initApp(&config)
 	if err != nil {
 		panic(err)
-		return
 	}
-	defer f()
 
 	if len(Version) > 0 {
 		app.logger.Infof("git commit: %v", Version)
 	}
 
-	panic(app.Run(*port))
+	// SIGINT/SIGTERM时优雅退出
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	err = app.Run(ctx, *port)
+	stop()
+	f()
+	if err != nil {
+		app.logger.Fatalf("app run error: %v", err)
+	}
 }
 
-// Run start service
-func (app *App) Run(port string) error {
-	return app.gin.Run(port)
+// Run start service, 后台任务随服务启动; ctx结束时停止接收新请求,
+// 等待处理中的请求完成后停止后台任务, 之后由initApp的清理函数关闭连接
+func (app *App) Run(ctx context.Context, port string) error {
+	app.relay.Start()
+	app.worker.Start()
+	app.cron.Start()
+
+	srv := &http.Server{Addr: port, Handler: app.gin}
+	serveErr := make(chan error, 1)
+	go func() {
+		app.logger.Infof("listening and serving HTTP on %s", port)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	var err error
+	select {
+	case err = <-serveErr:
+	case <-ctx.Done():
+		app.logger.Info("shutting down")
+		timeout := defaultShutdownTimeout
+		if app.conf.ShutdownTimeoutSeconds > 0 {
+			timeout = time.Duration(app.conf.ShutdownTimeoutSeconds) * time.Second
+		}
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err = srv.Shutdown(shutdownCtx); err != nil {
+			app.logger.Errorf("shutdown http server error: %v", err)
+		}
+	}
+	// 停止调度, 取消执行中的定时任务并释放任务的锁
+	app.cron.Stop()
+	// 等待正在投递的事件完成, 避免已领取的事件等到租约过期才被重新投递
+	app.relay.Stop()
+	// 停止读取新的任务, 等待执行中的任务完成
+	app.worker.Stop()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
 }
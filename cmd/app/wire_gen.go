@@ -20,25 +20,117 @@ import (
 // initApp init app application.
 func initApp(appConfig *conf.AppConfig) (*App, func(), error) {
 	logger := logx.NewLogger(appConfig)
-	db, err := data.NewDB(appConfig, logger)
+	db, cleanup, err := data.NewDB(appConfig, logger)
 	if err != nil {
 		return nil, nil, err
 	}
-	client, err := data.NewRDB(appConfig)
+	dBs, cleanup2, err := data.NewDBs(appConfig, db, logger)
 	if err != nil {
+		cleanup()
 		return nil, nil, err
 	}
-	dataData, err := data.NewData(db, client)
+	client, cleanup3, err := data.NewRDB(appConfig, logger)
 	if err != nil {
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
+	rdBs, cleanup4, err := data.NewRDBs(appConfig, client, logger)
+	if err != nil {
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
+	dataData, cleanup5, err := data.NewData(appConfig, dBs, rdBs, logger)
+	if err != nil {
+		cleanup4()
+		cleanup3()
+		cleanup2()
+		cleanup()
 		return nil, nil, err
 	}
 	iUcUserRepo := data.NewUcUserRepo(dataData)
 	transaction := data.NewTransaction(dataData)
-	ucUserUseCase := biz.NewUcUserUseCase(iUcUserRepo, transaction)
+	locker, cleanup6, err := data.NewLocker(appConfig, dataData, logger)
+	if err != nil {
+		cleanup5()
+		cleanup4()
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
+	relay, cleanup7, err := data.NewOutboxRelay(appConfig, dataData, logger)
+	if err != nil {
+		cleanup6()
+		cleanup5()
+		cleanup4()
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
+	outbox := data.NewOutbox(dataData, relay)
+	jobs := data.NewJobs(appConfig, dataData)
+	ucUserUseCase := biz.NewUcUserUseCase(iUcUserRepo, transaction, locker, outbox, jobs)
 	userService := service.NewUserService(ucUserUseCase)
+	iAuditLogRepo := data.NewAuditLogRepo(dataData)
+	auditLogUseCase := biz.NewAuditLogUseCase(iAuditLogRepo)
+	auditService := service.NewAuditService(auditLogUseCase)
+	cronTasks := biz.NewCronTasks(ucUserUseCase)
+	scheduler, cleanup8, err := data.NewCronScheduler(appConfig, dataData, locker, cronTasks, logger)
+	if err != nil {
+		cleanup7()
+		cleanup6()
+		cleanup5()
+		cleanup4()
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
+	cronUseCase := biz.NewCronUseCase(scheduler)
+	cronService := service.NewCronService(cronUseCase)
 	requestBeforeHandel := router.NewBeforeHandel(userService)
-	engine := router.NewRouter(userService, appConfig, requestBeforeHandel, logger)
-	app := newApp(appConfig, engine, logger)
+	reporter, cleanup9, err := router.NewReporter(appConfig, logger)
+	if err != nil {
+		cleanup8()
+		cleanup7()
+		cleanup6()
+		cleanup5()
+		cleanup4()
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
+	engine := router.NewRouter(userService, auditService, cronService, appConfig, requestBeforeHandel, logger, reporter)
+	jobHandlers := biz.NewJobHandlers(ucUserUseCase)
+	worker, cleanup10, err := data.NewJobWorker(appConfig, dataData, jobHandlers, logger)
+	if err != nil {
+		cleanup9()
+		cleanup8()
+		cleanup7()
+		cleanup6()
+		cleanup5()
+		cleanup4()
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
+	app := newApp(appConfig, engine, logger, relay, worker, scheduler)
 	return app, func() {
+		cleanup10()
+		cleanup9()
+		cleanup8()
+		cleanup7()
+		cleanup6()
+		cleanup5()
+		cleanup4()
+		cleanup3()
+		cleanup2()
+		cleanup()
 	}, nil
 }
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"gin-layout/internal/conf"
+	"gin-layout/internal/data"
+	"gin-layout/internal/data/migrations"
+	"gin-layout/internal/pkg/migrate"
+	"gin-layout/pkg"
+	"gin-layout/pkg/logx"
+	"os"
+	"path/filepath"
+
+	logs "github.com/sirupsen/logrus"
+)
+
+var config conf.AppConfig
+
+const usage = `usage: migrate [flags] <command>
+
+commands:
+  up              执行未执行的迁移
+  down            回滚最近的迁移, 默认回滚1个
+  status          查看迁移状态
+  create <name>   创建迁移文件, name只能包含小写字母、数字和下划线
+
+flags:
+`
+
+func main() {
+	var (
+		steps  = flag.Int("steps", 0, "up: 执行的个数, 0为全部; down: 回滚的个数, 0为1个")
+		dryRun = flag.Bool("dry-run", false, "只输出要执行的SQL, 不修改数据库")
+		dir    = flag.String("dir", filepath.Join(pkg.RootPath(), migrations.Dir), "create: 迁移文件目录")
+	)
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if flag.Arg(0) == "create" {
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		files, err := migrate.Create(*dir, flag.Arg(1))
+		if err != nil {
+			logs.Fatalf("create migration error: %v", err)
+		}
+		for _, file := range files {
+			fmt.Println(file)
+		}
+		return
+	}
+
+	if err := pkg.LoadConfigFor(&config, "app.yml"); err != nil {
+		logs.Fatalf("LoadAppConfig error: %v", err)
+	}
+	logger := logx.NewLogger(&config)
+	db, cleanup, err := data.NewDB(&config, logger)
+	if err != nil {
+		logger.Fatalf("connect mysql error: %+v", err)
+	}
+	defer cleanup()
+
+	src, err := migrations.Source()
+	if err != nil {
+		logger.Fatalf("load migrations error: %+v", err)
+	}
+	m := migrate.New(db, src)
+	if *dryRun {
+		m = m.DryRun(os.Stdout)
+	}
+
+	ctx := context.Background()
+	switch flag.Arg(0) {
+	case "up":
+		done, err := m.Up(ctx, *steps)
+		printMigrations("up", done)
+		if err != nil {
+			logger.Fatalf("migrate up error: %+v", err)
+		}
+	case "down":
+		done, err := m.Down(ctx, *steps)
+		printMigrations("down", done)
+		if err != nil {
+			logger.Fatalf("migrate down error: %+v", err)
+		}
+	case "status":
+		list, err := m.Status(ctx)
+		if err != nil {
+			logger.Fatalf("migrate status error: %+v", err)
+		}
+		for _, s := range list {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Missing {
+				state += " (missing)"
+			}
+			fmt.Printf("%d  %-40s %s\n", s.Version, s.Name, state)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func printMigrations(direction string, list []*migrate.Migration) {
+	if len(list) == 0 {
+		fmt.Printf("%s: nothing to do\n", direction)
+	}
+	for _, mg := range list {
+		fmt.Printf("%s: %d_%s\n", direction, mg.Version, mg.Name)
+	}
+}
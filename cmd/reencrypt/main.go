@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"gin-layout/internal/conf"
+	"gin-layout/internal/data"
+	"gin-layout/pkg"
+	"gin-layout/pkg/logx"
+	"os"
+	"os/signal"
+	"syscall"
+
+	logs "github.com/sirupsen/logrus"
+)
+
+var config conf.AppConfig
+
+const usage = `usage: reencrypt [flags]
+
+轮换加密字段的密钥后执行: 使用encrypt.current_key重新加密所有加密字段并重建盲索引,
+完成前不能从encrypt.keys中删除旧key; 中断后可以重新执行
+
+flags:
+`
+
+func main() {
+	var (
+		batch = flag.Int("batch", data.DefaultBatchSize, "每批处理的行数")
+		table = flag.String("table", "", "只处理该表, 为空时处理所有包含加密字段的表")
+	)
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := pkg.LoadConfigFor(&config, "app.yml"); err != nil {
+		logs.Fatalf("LoadAppConfig error: %v", err)
+	}
+	if config.Encrypt == nil {
+		logs.Fatal("encrypt is not configured")
+	}
+	logger := logx.NewLogger(&config)
+	db, cleanup, err := data.NewDB(&config, logger)
+	if err != nil {
+		logger.Fatalf("connect mysql error: %+v", err)
+	}
+	defer cleanup()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	list, err := data.ReEncrypt(ctx, db, *table, *batch, logger)
+	for _, r := range list {
+		fmt.Printf("%s: scanned %d, updated %d, skipped %d\n", r.Table, r.Scanned, r.Updated, r.Skipped)
+	}
+	if err != nil {
+		logger.Fatalf("reencrypt error: %+v", err)
+	}
+	for _, r := range list {
+		if r.Skipped > 0 {
+			fmt.Println("some rows were modified concurrently and skipped, run reencrypt again")
+			break
+		}
+	}
+}
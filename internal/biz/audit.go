@@ -0,0 +1,46 @@
+package biz
+
+import (
+	"context"
+	"gin-layout/internal/pkg/page"
+	"gin-layout/internal/pkg/query"
+	"time"
+)
+
+// AuditLog 审计日志, 数据的一次创建、更新或删除
+type AuditLog struct {
+	Id        uint64
+	Entity    string // 表名
+	EntityId  string // 主键
+	Action    string // create/update/delete
+	OldValues string // 变更前的值, json
+	NewValues string // 变更后的值, json
+	UserId    uint64 // 操作人
+	RequestId string
+	CreatedAt time.Time
+}
+
+// IAuditLogRepo 查询审计日志, 写入由data层的gorm插件完成
+type IAuditLogRepo interface {
+	AuditLogList(ctx context.Context, condition *ListAuditLogRep) (*page.Result[*AuditLog], error)
+}
+
+// ListAuditLogRep 查询审计日志
+type ListAuditLogRep struct {
+	Page  *page.Page
+	Query *query.Query // 排序和筛选
+}
+
+type AuditLogUseCase struct {
+	repo IAuditLogRepo
+}
+
+// NewAuditLogUseCase .
+func NewAuditLogUseCase(repo IAuditLogRepo) *AuditLogUseCase {
+	return &AuditLogUseCase{repo: repo}
+}
+
+// ListAuditLog 按数据、操作人、时间查询审计日志
+func (u *AuditLogUseCase) ListAuditLog(ctx context.Context, condition *ListAuditLogRep) (*page.Result[*AuditLog], error) {
+	return u.repo.AuditLogList(ctx, condition)
+}
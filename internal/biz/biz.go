@@ -2,24 +2,62 @@ package biz
 
 import (
 	"context"
+	"database/sql"
+	"gin-layout/internal/pkg/queue"
 	"github.com/google/wire"
 )
 
 // ProviderSet is biz providers.
 var ProviderSet = wire.NewSet(
 	NewUcUserUseCase,
+	NewAuditLogUseCase,
+	NewJobHandlers,
+	NewCronTasks,
+	NewCronUseCase,
 	///...
 )
 
-// Transaction 数据库事务
+// Transaction 数据库事务, 在事务中再次调用时使用savepoint
+// 死锁、锁等待超时时会重试整个事务, fn可能被执行多次
 type Transaction interface {
 	InTx(context.Context, func(ctx context.Context) error) error
+	// InTxWithOptions 在事务中调用时不能设置隔离级别和只读, 设置了返回错误
+	InTxWithOptions(context.Context, *TxOptions, func(ctx context.Context) error) error
+	// OnCommit 最外层的事务提交后执行, 不在事务中时立即执行
+	OnCommit(ctx context.Context, fn func(ctx context.Context))
+	// OnRollback 事务回滚后执行, 不在事务中时立即执行
+	OnRollback(ctx context.Context, fn func(ctx context.Context))
+}
+
+// TxOptions 事务选项, 只对最外层的事务生效
+type TxOptions struct {
+	Isolation sql.IsolationLevel // 隔离级别, 默认使用数据库的配置
+	ReadOnly  bool
+	Retries   int // 死锁、锁等待超时时的重试次数, 0使用默认值3, <0时不重试
+}
+
+// Locker 分布式锁, 多个实例之间互斥执行fn, 获取超时返回lock.ErrNotObtained
+type Locker interface {
+	WithLock(ctx context.Context, key string, fn func(ctx context.Context) error) error
+}
+
+// Outbox 领域事件, 在InTx中调用时与业务数据在同一个事务中写入, 提交后异步投递, 至少投递一次
+type Outbox interface {
+	Publish(ctx context.Context, topic, key string, payload any) error
+}
+
+// Jobs 后台任务, 在InTx中调用时事务提交后才入队, 回滚时不入队; 任务至少执行一次, 处理函数需要幂等
+type Jobs interface {
+	Enqueue(ctx context.Context, jobType string, payload any, opts ...queue.Option) (string, error)
 }
 
 // NewUcUserUseCase 初始化UcUser biz
-func NewUcUserUseCase(repo IUcUserRepo, tm Transaction) *UcUserUseCase {
+func NewUcUserUseCase(repo IUcUserRepo, tm Transaction, locker Locker, outbox Outbox, jobs Jobs) *UcUserUseCase {
 	return &UcUserUseCase{
-		repo: repo,
-		tm:   tm,
+		repo:   repo,
+		tm:     tm,
+		locker: locker,
+		outbox: outbox,
+		jobs:   jobs,
 	}
 }
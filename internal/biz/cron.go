@@ -0,0 +1,51 @@
+package biz
+
+import (
+	"context"
+	"gin-layout/internal/pkg/cron"
+	"gin-layout/pkg/errResponse"
+
+	"github.com/pkg/errors"
+)
+
+// CronTasks 定时任务, 由data层的调度器执行, 多个实例时每次只在一个实例上执行
+type CronTasks []cron.Task
+
+// NewCronTasks 注册定时任务, 新的任务在这里添加, 执行时间可以通过配置覆盖
+func NewCronTasks(user *UcUserUseCase) CronTasks {
+	return CronTasks{
+		{Name: CronUcUserRecountSerialNumber, Spec: "0 * * * *", Run: user.recountAllSerialNumbers},
+	}
+}
+
+// CronScheduler 查询和手动触发定时任务
+type CronScheduler interface {
+	Tasks(ctx context.Context) ([]*cron.TaskInfo, error)
+	Trigger(ctx context.Context, name string) error
+}
+
+type CronUseCase struct {
+	scheduler CronScheduler
+}
+
+// NewCronUseCase .
+func NewCronUseCase(scheduler CronScheduler) *CronUseCase {
+	return &CronUseCase{scheduler: scheduler}
+}
+
+// ListCronTask 所有定时任务和最后一次执行的结果
+func (u *CronUseCase) ListCronTask(ctx context.Context) ([]*cron.TaskInfo, error) {
+	return u.scheduler.Tasks(ctx)
+}
+
+// RunCronTask 在当前实例立即执行一次, 不等待执行完成
+func (u *CronUseCase) RunCronTask(ctx context.Context, name string) error {
+	err := u.scheduler.Trigger(ctx, name)
+	switch {
+	case errors.Is(err, cron.ErrUnknownTask):
+		return errResponse.SetCustomizeErrInfoByReason(errResponse.ReasonDataIsNotFount)
+	case errors.Is(err, cron.ErrRunning):
+		return errResponse.SetCustomizeErrInfoByReason(errResponse.ReasonResourceBusy)
+	}
+	return err
+}
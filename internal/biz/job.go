@@ -0,0 +1,15 @@
+package biz
+
+import (
+	"gin-layout/internal/pkg/queue"
+)
+
+// JobHandlers 后台任务的处理函数, 由data层的worker执行
+type JobHandlers []queue.Handler
+
+// NewJobHandlers 注册后台任务的处理函数, 新的任务类型在这里添加
+func NewJobHandlers(user *UcUserUseCase) JobHandlers {
+	return JobHandlers{
+		queue.HandlerFunc(JobUcUserRecountSerialNumber, user.recountSerialNumber),
+	}
+}
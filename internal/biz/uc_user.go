@@ -2,39 +2,78 @@ package biz
 
 import (
 	"context"
+	"gin-layout/internal/pkg/lock"
 	"gin-layout/internal/pkg/page"
+	"gin-layout/internal/pkg/query"
+	"gin-layout/internal/pkg/tenant"
 	"gin-layout/internal/pkg/validate"
 	"gin-layout/pkg/errResponse"
 	"github.com/pkg/errors"
 	"gorm.io/gorm"
+	"strconv"
+)
+
+const (
+	// EventUcUserCreated 用户创建的领域事件, payload为UcUserCreated
+	EventUcUserCreated = "uc_user.created"
+	// JobUcUserRecountSerialNumber 重新计算SerialNumber的后台任务, 没有payload
+	JobUcUserRecountSerialNumber = "uc_user.recount_serial_number"
+	// CronUcUserRecountSerialNumber 定时为所有租户重新计算SerialNumber
+	CronUcUserRecountSerialNumber = "uc_user.recount_serial_number"
 )
 
 type UcUser struct {
 	Id           uint64
 	Name         string `validate:"required,min=1,max=20" label:"名称"`
 	SerialNumber int
+	Phone        string `validate:"omitempty,mobile" label:"手机号"`
+	IdCard       string `validate:"omitempty,idcard" label:"身份证号"`
+}
+
+// UcUserCreated EventUcUserCreated的payload, 事件会投递到redis stream和webhook,
+// 不包含手机号、身份证号等加密字段
+type UcUserCreated struct {
+	Id           uint64
+	Name         string
+	SerialNumber int
 }
 
 // IUcUserRepo 操作用户表 。。。 【在biz层规定data层要实现的功能】
 type IUcUserRepo interface {
 	CreateUcUser(ctx context.Context, a *UcUser) error
 	GetUcUserById(ctx context.Context, id uint64) (*UcUser, error)
+	GetUcUserByPhone(ctx context.Context, phone string) (*UcUser, error)
 	GetUcUserNum(ctx context.Context) (int, error)
 	GetUcUserMaxId(ctx context.Context) (uint64, error)
+	GetUcUserTenantIds(ctx context.Context) ([]string, error)
 	SaveUcUserSerialNumber(ctx context.Context, a *UcUser) error
-	UserList(ctx context.Context, condition *ListTestRep) ([]*UcUser, error)
+	UserList(ctx context.Context, condition *ListTestRep) (*page.Result[*UcUser], error)
+	DeleteUcUser(ctx context.Context, ids ...uint64) (int64, error)
+	TrashUserList(ctx context.Context, condition *ListTestRep) (*page.Result[*UcUser], error)
+	RestoreUcUser(ctx context.Context, ids ...uint64) (int64, error)
 }
 
 type UcUserUseCase struct {
-	repo IUcUserRepo
-	tm   Transaction
+	repo   IUcUserRepo
+	tm     Transaction
+	locker Locker
+	outbox Outbox
+	jobs   Jobs
 }
 
 func (u *UcUserUseCase) GetTest(ctx context.Context, user *UcUser) (*UcUser, error) {
-	if user.Id < 1 {
+	var (
+		res *UcUser
+		err error
+	)
+	switch {
+	case user.Id > 0:
+		res, err = u.repo.GetUcUserById(ctx, user.Id)
+	case user.Phone != "":
+		res, err = u.repo.GetUcUserByPhone(ctx, user.Phone)
+	default:
 		return &UcUser{}, nil
 	}
-	res, err := u.repo.GetUcUserById(ctx, user.Id)
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, errResponse.SetCustomizeErrInfoByReason(errResponse.ReasonDataIsNotFount)
 	}
@@ -42,14 +81,56 @@ func (u *UcUserUseCase) GetTest(ctx context.Context, user *UcUser) (*UcUser, err
 }
 
 func (u *UcUserUseCase) AddTest(ctx context.Context, user *UcUser) error {
-	if err := errors.WithStack(validate.ValidateStruct(user)); err != nil {
+	if err := validate.ValidateStructCtx(ctx, user); err != nil {
 		return err
 	}
-	return u.repo.CreateUcUser(ctx, user)
+	return u.tm.InTx(ctx, func(ctx context.Context) error {
+		if err := u.repo.CreateUcUser(ctx, user); err != nil {
+			return err
+		}
+		// SerialNumber不需要在请求中更新, 交给后台任务
+		if _, err := u.jobs.Enqueue(ctx, JobUcUserRecountSerialNumber, nil); err != nil {
+			return err
+		}
+		return u.outbox.Publish(ctx, EventUcUserCreated, strconv.FormatUint(user.Id, 10), &UcUserCreated{
+			Id:           user.Id,
+			Name:         user.Name,
+			SerialNumber: user.SerialNumber,
+		})
+	})
+}
+
+// recountSerialNumber 后台任务, 锁被占用时返回错误, 由队列重试
+func (u *UcUserUseCase) recountSerialNumber(ctx context.Context, _ struct{}) error {
+	return u.TranTest(ctx)
+}
+
+// recountAllSerialNumbers 定时任务, 每个租户入队一个重新计算的后台任务
+func (u *UcUserUseCase) recountAllSerialNumbers(ctx context.Context) error {
+	ids, err := u.repo.GetUcUserTenantIds(tenant.Bypass(ctx))
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err = u.jobs.Enqueue(tenant.WithTenant(ctx, id), JobUcUserRecountSerialNumber, nil); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// TranTest 事务使用 (示例)
+// TranTest 事务使用 (示例), 先读后写, 多个实例同时执行时需要加锁, 锁在事务提交后释放; 每个租户一把锁
 func (u *UcUserUseCase) TranTest(ctx context.Context) error {
+	err := u.locker.WithLock(ctx, tenant.Key(ctx, "uc_user:serial_number"), func(ctx context.Context) error {
+		return u.tranTest(ctx)
+	})
+	if errors.Is(err, lock.ErrNotObtained) {
+		return errResponse.SetCustomizeErrInfoByReason(errResponse.ReasonResourceBusy)
+	}
+	return err
+}
+
+func (u *UcUserUseCase) tranTest(ctx context.Context) error {
 	err := u.tm.InTx(ctx, func(ctx context.Context) error {
 		// 获取现在有多少条
 		n, err := u.repo.GetUcUserNum(ctx)
@@ -73,12 +154,40 @@ func (u *UcUserUseCase) TranTest(ctx context.Context) error {
 
 // ListTestRep 查询用户列表
 type ListTestRep struct {
-	Page *page.Page
-	Id   uint64
-	Name string
+	Page  *page.Page
+	Query *query.Query // 排序和筛选
 }
 
 // ListTest 用户列表
-func (u *UcUserUseCase) ListTest(ctx context.Context, condition *ListTestRep) ([]*UcUser, error) {
+func (u *UcUserUseCase) ListTest(ctx context.Context, condition *ListTestRep) (*page.Result[*UcUser], error) {
 	return u.repo.UserList(ctx, condition)
 }
+
+// DelTest 删除用户(软删除)
+func (u *UcUserUseCase) DelTest(ctx context.Context, ids []uint64) error {
+	n, err := u.repo.DeleteUcUser(ctx, ids...)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errResponse.SetCustomizeErrInfoByReason(errResponse.ReasonDataIsNotFount)
+	}
+	return nil
+}
+
+// TrashTest 回收站中的用户列表
+func (u *UcUserUseCase) TrashTest(ctx context.Context, condition *ListTestRep) (*page.Result[*UcUser], error) {
+	return u.repo.TrashUserList(ctx, condition)
+}
+
+// RestoreTest 从回收站恢复用户
+func (u *UcUserUseCase) RestoreTest(ctx context.Context, ids []uint64) error {
+	n, err := u.repo.RestoreUcUser(ctx, ids...)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errResponse.SetCustomizeErrInfoByReason(errResponse.ReasonDataIsNotFount)
+	}
+	return nil
+}
@@ -13,9 +13,37 @@ const (
 type AppConfig struct {
 	Env string `yaml:"env"`
 
+	AutoMigrate bool `yaml:"auto_migrate"` // 启动时执行未执行的迁移, 只在test/dev环境生效
+
+	ShutdownTimeoutSeconds int `yaml:"shutdown_timeout_seconds"` // 退出时等待处理中的请求完成的时间, 默认30
+
 	RedisAPI *RedisConf `yaml:"redis_address"`
 
+	Redises map[string]*RedisConf `yaml:"redises"` // 命名的redis连接, 通过Data.NamedRDB(name)使用
+
 	DBAddress *MysqlConf `yaml:"db_address"`
+
+	Databases map[string]*MysqlConf `yaml:"databases"` // 命名的数据库连接, 通过Data.Named(name)使用
+
+	ErrReport *ErrReportConf `yaml:"err_report"`
+
+	SoftDelete *SoftDeleteConf `yaml:"soft_delete"`
+
+	Cache *CacheConf `yaml:"cache"`
+
+	Lock *LockConf `yaml:"lock"`
+
+	Outbox *OutboxConf `yaml:"outbox"`
+
+	Tenant *TenantConf `yaml:"tenant"`
+
+	Encrypt *EncryptConf `yaml:"encrypt"`
+
+	Queue *QueueConf `yaml:"queue"`
+
+	Cron *CronConf `yaml:"cron"`
+
+	CursorSecret string `yaml:"cursor_secret"` // 游标分页的签名密钥, 多实例部署时需要配置相同的值
 }
 
 // Verify ...
@@ -30,21 +58,153 @@ func (a *AppConfig) Verify() error {
 	return nil
 }
 
+// RedisConf redis连接配置, mode为空时使用单节点
 type RedisConf struct {
-	Address                string `yaml:"address"`
-	Password               string `yaml:"password"`
-	DialTimeoutMillisecond int    `yaml:"dial_timeout_millisecond"` // Dial timeout for establishing new connections.
-	RWTimeoutMillisecond   int    `yaml:"rw_timeout_millisecond"`   // timeout for read or write.
-	PoolSize               int    `yaml:"pool_size"`                // Maximum number of socket connections
+	Mode                   string   `yaml:"mode"`        // standalone, sentinel, cluster
+	Address                string   `yaml:"address"`     // standalone的地址
+	Addresses              []string `yaml:"addresses"`   // sentinel为哨兵的地址, cluster为种子节点的地址
+	MasterName             string   `yaml:"master_name"` // sentinel的主节点名称
+	Password               string   `yaml:"password"`
+	DB                     int      `yaml:"db"`                       // cluster不支持
+	DialTimeoutMillisecond int      `yaml:"dial_timeout_millisecond"` // Dial timeout for establishing new connections.
+	RWTimeoutMillisecond   int      `yaml:"rw_timeout_millisecond"`   // timeout for read or write.
+	PoolSize               int      `yaml:"pool_size"`                // Maximum number of socket connections
+	MinIdleConns           int      `yaml:"min_idle_conns"`           // 保持的最少空闲连接数
+	IdleTimeoutSeconds     int      `yaml:"idle_timeout_seconds"`     // 空闲连接的关闭时间, 默认300, <0时不关闭
+	TLS                    bool     `yaml:"tls"`
+	TLSSkipVerify          bool     `yaml:"tls_skip_verify"` // 不校验服务端证书, 只用于测试环境
+	Lazy                   bool     `yaml:"lazy"`            // 启动时不检查连接, redis不可用时不影响启动
 }
 
+// MysqlConf 数据库连接配置, driver为空时使用mysql
 type MysqlConf struct {
-	DatabaseName string `yaml:"database_name"`
+	Driver       string `yaml:"driver"`        // mysql, postgres, sqlite
+	Dsn          string `yaml:"dsn"`           // 不为空时直接使用, 忽略主机、用户名等配置
+	DatabaseName string `yaml:"database_name"` // sqlite为数据库文件路径, 例如 data/app.db 或 file::memory:?cache=shared
 	Hostname     string `yaml:"hostname"`
 	Port         int    `yaml:"port"`
 	Username     string `yaml:"username"`
 	Password     string `yaml:"password"`
 	ParseTime    bool   `yaml:"parse_time"`
+	SSLMode      string `yaml:"ssl_mode"` // postgres的sslmode, 默认disable
 	MaxOpenConns int    `yaml:"max_open_conns"`
 	MaxIdleConns int    `yaml:"max_idle_conns"`
+
+	Replicas           []*ReplicaConf `yaml:"replicas"`             // 从库, 读操作按权重路由到健康的从库
+	HealthCheckSeconds int            `yaml:"health_check_seconds"` // 从库健康检查间隔, 默认5
+}
+
+// ReplicaConf 从库配置, 库名和连接池参数与主库相同
+type ReplicaConf struct {
+	Hostname string `yaml:"hostname"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"` // 为空时使用主库的用户名
+	Password string `yaml:"password"` // 为空时使用主库的密码
+	Weight   int    `yaml:"weight"`   // 权重, 默认1
+}
+
+// ErrReportConf 未知错误上报配置, 不配置则不上报
+type ErrReportConf struct {
+	File         string `yaml:"file"`          // 以jsonl格式追加写入的本地文件, 为空则不写
+	SentryDSN    string `yaml:"sentry_dsn"`    // sentry协议的dsn, 例如: https://key@sentry.example.com/1
+	DedupSeconds int    `yaml:"dedup_seconds"` // 相同指纹的错误在该时间内只上报一次, 默认60
+	QueueSize    int    `yaml:"queue_size"`    // 异步上报队列长度, 默认1024
+	TimeoutMs    int    `yaml:"timeout_ms"`    // http上报超时时间, 默认3000
+}
+
+// SoftDeleteConf 软删除数据的清理配置, RetentionDays<=0 时不清理
+type SoftDeleteConf struct {
+	RetentionDays        int    `yaml:"retention_days"`         // 软删除的数据保留天数, 超过后物理删除
+	PurgeIntervalMinutes int    `yaml:"purge_interval_minutes"` // 清理间隔, 默认60, 配置了purge_cron时不生效
+	PurgeCron            string `yaml:"purge_cron"`             // 清理的cron表达式, 例如 0 3 * * *
+	PurgeBatchSize       int    `yaml:"purge_batch_size"`       // 每批删除的条数, 默认100
+}
+
+// CacheConf 仓储读缓存配置, 不配置时使用默认值
+type CacheConf struct {
+	Namespace          string `yaml:"namespace"`             // key前缀, 默认gin_layout
+	Codec              string `yaml:"codec"`                 // json, msgpack, 默认json
+	TTLSeconds         int    `yaml:"ttl_seconds"`           // 过期时间, 默认600
+	JitterPercent      int    `yaml:"jitter_percent"`        // 过期时间随机增加的百分比, 默认10, <0时不增加
+	NotFoundTTLSeconds int    `yaml:"not_found_ttl_seconds"` // 不存在的数据的缓存时间, 默认60, <0时不缓存
+	LoadTimeoutSeconds int    `yaml:"load_timeout_seconds"`  // 回源的超时时间, 默认5
+
+	LocalMaxEntries int                         `yaml:"local_max_entries"` // 进程内缓存的最大条数, 默认10000
+	LocalTTLSeconds int                         `yaml:"local_ttl_seconds"` // 进程内缓存的过期时间, 默认10
+	Families        map[string]*CacheFamilyConf `yaml:"families"`          // 按key的分类配置, key为表名, 例如uc_users
+}
+
+// CacheFamilyConf 一类key使用的缓存层级和过期时间, 为0时使用CacheConf中的值
+type CacheFamilyConf struct {
+	Tiers           []string `yaml:"tiers"` // local, redis, 默认只使用redis
+	TTLSeconds      int      `yaml:"ttl_seconds"`
+	LocalTTLSeconds int      `yaml:"local_ttl_seconds"`
+}
+
+// LockConf 分布式锁配置, 不配置时使用redis_address的单节点锁
+type LockConf struct {
+	TTLSeconds  int          `yaml:"ttl_seconds"`  // 锁的过期时间, 持有期间自动续期, 默认30
+	WaitSeconds int          `yaml:"wait_seconds"` // 获取锁最多等待的时间, 默认10
+	Redlock     []*RedisConf `yaml:"redlock"`      // 相互独立的redis主节点, 配置后使用redlock, 建议3或5个
+}
+
+// OutboxConf 领域事件的投递配置, 不配置时投递到redis stream
+type OutboxConf struct {
+	Publisher        string `yaml:"publisher"`          // redis_stream, webhook, 默认redis_stream
+	StreamPrefix     string `yaml:"stream_prefix"`      // stream名称的前缀, 完整名称为前缀+topic, 默认gin_layout:events:
+	StreamMaxLen     int64  `yaml:"stream_max_len"`     // stream的近似最大长度, 0为不限制
+	WebhookURL       string `yaml:"webhook_url"`        // publisher为webhook时必填
+	WebhookSecret    string `yaml:"webhook_secret"`     // 不为空时对body签名, 放在X-Outbox-Signature
+	WebhookTimeoutMs int    `yaml:"webhook_timeout_ms"` // 默认3000
+	PollIntervalMs   int    `yaml:"poll_interval_ms"`   // 轮询间隔, 默认1000
+	BatchSize        int    `yaml:"batch_size"`         // 每次认领的条数, 默认100
+	MaxAttempts      int    `yaml:"max_attempts"`       // 投递失败的最大次数, 超过后不再投递, 默认10
+	RetentionDays    int    `yaml:"retention_days"`     // 已投递事件的保留天数, 默认7, <0时不清理
+}
+
+// TenantConf 请求的租户解析配置, 登录后使用token中的租户;
+// trusted为true时未登录的请求依次使用请求头、子域名、默认租户, 为false时只使用默认租户
+type TenantConf struct {
+	Header  string `yaml:"header"`  // 租户的请求头, 默认X-Tenant-Id
+	Domain  string `yaml:"domain"`  // 不为空时使用子域名作为租户, 例如example.com, 请求acme.example.com的租户为acme
+	Default string `yaml:"default"` // 都没有解析到时使用的租户, 单租户部署时配置, 为空时访问按租户隔离的数据返回错误
+	Trusted bool   `yaml:"trusted"` // 请求头和子域名由网关设置, 客户端不能伪造; 不论是否信任, 与token中的租户不一致时都返回403
+}
+
+// EncryptConf 字段加密的密钥, 不配置时不能写入加密字段
+// 轮换时在keys中添加新key并修改current_key, 执行reencrypt后才能删除旧key
+type EncryptConf struct {
+	CurrentKey    string            `yaml:"current_key"`     // 加密使用的key id
+	Keys          map[string]string `yaml:"keys"`            // key id到base64编码的16/24/32字节的key
+	BlindIndexKey string            `yaml:"blind_index_key"` // 盲索引的hmac key, base64编码, 修改后需要执行reencrypt重建盲索引
+}
+
+// QueueConf 后台任务队列配置, 不配置时使用默认值
+type QueueConf struct {
+	Redis             string `yaml:"redis"`               // 使用的redis连接名称, 对应redises中的配置, 默认使用redis_address
+	Prefix            string `yaml:"prefix"`              // key的前缀, 默认{gin_layout:jobs}:, 集群模式下需要包含hash tag
+	Concurrency       int    `yaml:"concurrency"`         // 每个实例同时执行的任务数, 默认10
+	MaxRetries        int    `yaml:"max_retries"`         // 失败后的重试次数, 默认3, <0时不重试
+	BackoffMs         int    `yaml:"backoff_ms"`          // 第一次重试的间隔, 之后每次翻倍, 默认1000
+	MaxBackoffSeconds int    `yaml:"max_backoff_seconds"` // 重试间隔的上限, 默认600
+	TimeoutSeconds    int    `yaml:"timeout_seconds"`     // 单个任务的执行时限, 默认300
+	ClaimIdleSeconds  int    `yaml:"claim_idle_seconds"`  // 任务超过该时间未确认时由其他实例认领, 默认timeout_seconds+60
+	DeadMaxLen        int64  `yaml:"dead_max_len"`        // 死信的近似最大长度, 默认10000
+}
+
+// CronConf 定时任务配置, 不配置时使用默认值
+type CronConf struct {
+	Redis          string                   `yaml:"redis"`           // 使用的redis连接名称, 对应redises中的配置, 默认使用redis_address
+	Prefix         string                   `yaml:"prefix"`          // key的前缀, 默认gin_layout:cron:
+	Timezone       string                   `yaml:"timezone"`        // cron表达式的时区, 例如Asia/Shanghai, 默认使用系统时区
+	JitterSeconds  int                      `yaml:"jitter_seconds"`  // 到期后随机延迟的上限, 默认0
+	TimeoutSeconds int                      `yaml:"timeout_seconds"` // 单次执行的时限, 默认3600
+	ManualOnly     bool                     `yaml:"manual_only"`     // 当前实例不按计划执行, 只能手动触发
+	Tasks          map[string]*CronTaskConf `yaml:"tasks"`           // 按任务名称覆盖代码中的配置
+}
+
+// CronTaskConf 单个定时任务的配置
+type CronTaskConf struct {
+	Spec     string `yaml:"spec"`     // 覆盖代码中的cron表达式
+	Disabled bool   `yaml:"disabled"` // 不执行, 也不能手动触发
 }
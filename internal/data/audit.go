@@ -0,0 +1,46 @@
+package data
+
+import (
+	"context"
+	"gin-layout/internal/biz"
+	"gin-layout/internal/data/model"
+	"gin-layout/internal/pkg/audit"
+	"gin-layout/internal/pkg/page"
+
+	"github.com/pkg/errors"
+)
+
+// auditModels 需要记录审计日志的模型, 创建、更新、删除写入audit_logs表
+var auditModels = []any{
+	&model.UcUser{},
+}
+
+type auditLogRepo struct {
+	data *Data
+}
+
+// NewAuditLogRepo .
+func NewAuditLogRepo(data *Data) biz.IAuditLogRepo {
+	return &auditLogRepo{data: data}
+}
+
+func (r *auditLogRepo) AuditLogList(ctx context.Context, condition *biz.ListAuditLogRep) (*page.Result[*biz.AuditLog], error) {
+	db := condition.Query.Apply(r.data.DB(ctx).Model(&audit.Log{}))
+	res, err := page.Find[*audit.Log](condition.Page.WithContext(ctx), db)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return page.Map(res, func(l *audit.Log) *biz.AuditLog {
+		return &biz.AuditLog{
+			Id:        l.ID,
+			Entity:    l.Entity,
+			EntityId:  l.EntityID,
+			Action:    l.Action,
+			OldValues: l.OldValues,
+			NewValues: l.NewValues,
+			UserId:    l.UserID,
+			RequestId: l.RequestID,
+			CreatedAt: l.CreatedAt,
+		}
+	}), nil
+}
@@ -0,0 +1,76 @@
+package data
+
+import (
+	"context"
+	"gin-layout/internal/conf"
+	"gin-layout/internal/pkg/cache"
+	"gin-layout/internal/pkg/redisx"
+	"time"
+
+	"github.com/pkg/errors"
+	logs "github.com/sirupsen/logrus"
+)
+
+// newCache 按配置创建仓储的读缓存
+func newCache(c *conf.CacheConf, rdb redisx.Client, logger *logs.Logger) (*cache.Cache, error) {
+	if c == nil {
+		return cache.New(rdb, cache.Options{Logger: logger}), nil
+	}
+	codec, err := cache.CodecByName(c.Codec)
+	if err != nil {
+		return nil, err
+	}
+	families := make(map[string]cache.Family, len(c.Families))
+	for name, fc := range c.Families {
+		f := cache.Family{
+			TTL:      time.Duration(fc.TTLSeconds) * time.Second,
+			LocalTTL: time.Duration(fc.LocalTTLSeconds) * time.Second,
+		}
+		for _, tier := range fc.Tiers {
+			switch tier {
+			case "local":
+				f.Tiers |= cache.TierLocal
+			case "redis":
+				f.Tiers |= cache.TierRedis
+			default:
+				return nil, errors.Errorf("cache family %q: unknown tier %q", name, tier)
+			}
+		}
+		families[name] = f
+	}
+	return cache.New(rdb, cache.Options{
+		Namespace:       c.Namespace,
+		Codec:           codec,
+		TTL:             time.Duration(c.TTLSeconds) * time.Second,
+		Jitter:          float64(c.JitterPercent) / 100,
+		NotFoundTTL:     time.Duration(c.NotFoundTTLSeconds) * time.Second,
+		LoadTimeout:     time.Duration(c.LoadTimeoutSeconds) * time.Second,
+		LocalMaxEntries: c.LocalMaxEntries,
+		LocalTTL:        time.Duration(c.LocalTTLSeconds) * time.Second,
+		Families:        families,
+		Logger:          logger,
+	}), nil
+}
+
+// Cache 仓储的读缓存
+func (d *Data) Cache() *cache.Cache {
+	return d.cache
+}
+
+// InvalidateCache 删除缓存, 在事务中时提交后再删除一次,
+// 防止提交前并发的读把旧数据重新写入缓存
+func (d *Data) InvalidateCache(ctx context.Context, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	del := func(ctx context.Context) {
+		err := d.cache.Delete(ctx, keys...)
+		if logger, ok := ctx.Value("logger").(*logs.Entry); ok && err != nil {
+			logger.Warnf("invalidate cache %v error: %v", keys, err)
+		}
+	}
+	del(ctx)
+	if d.inTx(ctx) {
+		d.OnCommit(ctx, del)
+	}
+}
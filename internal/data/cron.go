@@ -0,0 +1,59 @@
+package data
+
+import (
+	"gin-layout/internal/biz"
+	"gin-layout/internal/conf"
+	"gin-layout/internal/pkg/cron"
+	"gin-layout/internal/pkg/lock"
+	"time"
+
+	"github.com/pkg/errors"
+	logs "github.com/sirupsen/logrus"
+)
+
+// NewCronScheduler 执行biz和data层声明的定时任务, 由App启动, 返回的清理函数停止调度并等待执行中的任务结束
+func NewCronScheduler(appConf *conf.AppConfig, d *Data, locker *lock.Locker, tasks biz.CronTasks, logger *logs.Logger) (*cron.Scheduler, func(), error) {
+	c := appConf.Cron
+	if c == nil {
+		c = &conf.CronConf{}
+	}
+	loc := time.Local
+	if c.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(c.Timezone); err != nil {
+			return nil, nil, errors.Wrapf(err, "cron timezone %q", c.Timezone)
+		}
+	}
+	all := append([]cron.Task{}, tasks...)
+	if t, ok := d.purgeTrashTask(appConf.SoftDelete); ok {
+		all = append(all, t)
+	}
+	// 按配置覆盖表达式或者禁用
+	enabled := all[:0]
+	for _, t := range all {
+		if tc := c.Tasks[t.Name]; tc != nil {
+			if tc.Disabled {
+				continue
+			}
+			if tc.Spec != "" {
+				t.Spec = tc.Spec
+			}
+		}
+		enabled = append(enabled, t)
+	}
+	rdb := d.RDB()
+	if c.Redis != "" {
+		rdb = d.NamedRDB(c.Redis)
+	}
+	s, err := cron.New(rdb, locker, enabled, cron.Options{
+		Prefix:     c.Prefix,
+		Location:   loc,
+		Jitter:     time.Duration(c.JitterSeconds) * time.Second,
+		Timeout:    time.Duration(c.TimeoutSeconds) * time.Second,
+		ManualOnly: c.ManualOnly,
+	}, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, s.Stop, nil
+}
@@ -2,15 +2,24 @@ package data
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"gin-layout/internal/biz"
 	"gin-layout/internal/conf"
+	"gin-layout/internal/pkg/audit"
+	"gin-layout/internal/pkg/cache"
+	"gin-layout/internal/pkg/cron"
+	"gin-layout/internal/pkg/dbresolver"
+	"gin-layout/internal/pkg/encrypt"
+	"gin-layout/internal/pkg/lock"
+	"gin-layout/internal/pkg/page"
+	"gin-layout/internal/pkg/redisx"
+	"gin-layout/internal/pkg/tenant"
 	"gin-layout/pkg/logx"
 	"github.com/go-redis/redis"
 	"github.com/google/wire"
 	"github.com/pkg/errors"
 	logs "github.com/sirupsen/logrus"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	gormlogger "gorm.io/gorm/logger"
 	"log"
@@ -19,51 +28,112 @@ import (
 
 // ProviderSet is data providers.
 var ProviderSet = wire.NewSet(
-	NewDB,          // mysql连接
-	NewRDB,         //redis连接
-	NewData,        // data层
-	NewTransaction, // 事务
+	NewDB,            // 数据库连接
+	NewDBs,           // 命名的数据库连接
+	NewRDB,           //redis连接
+	NewRDBs,          // 命名的redis连接
+	NewData,          // data层
+	NewTransaction,   // 事务
+	NewLocker,        // 分布式锁
+	NewOutboxRelay,   // 领域事件投递
+	NewOutbox,        // 领域事件
+	NewJobs,          // 后台任务入队
+	NewJobWorker,     // 后台任务执行
+	NewCronScheduler, // 定时任务
+	NewAuditLogRepo,  // 审计日志
+	wire.Bind(new(biz.Locker), new(*lock.Locker)),
+	wire.Bind(new(biz.CronScheduler), new(*cron.Scheduler)),
 	// ...example...
 	NewUcUserRepo, // 注入用户相关 example...
 	// ...
 )
 
+// DefaultDB 默认连接的名称, 对应配置中的db_address
+const DefaultDB = "default"
+
+// DBs 按名称区分的数据库连接
+type DBs map[string]*gorm.DB
+
+// DefaultRDB 默认redis连接的名称, 对应配置中的redis_address
+const DefaultRDB = "default"
+
+// RDBs 按名称区分的redis连接
+type RDBs map[string]redisx.Client
+
 // Data .
 type Data struct {
-	db  *gorm.DB
-	rdb *redis.Client
+	name  string // 当前使用的连接名称
+	dbs   DBs
+	db    *gorm.DB
+	rdbs  RDBs
+	rdb   redisx.Client
+	cache *cache.Cache
 }
 
-// 用来承载事务的上下文
-type contextTxKey struct{}
-
 // NewTransaction .
 func NewTransaction(d *Data) biz.Transaction {
 	return d
 }
 
 // NewData .
-func NewData(db *gorm.DB, rdb *redis.Client) (*Data, error) {
-	return &Data{
-		db:  db,
-		rdb: rdb,
+func NewData(appConf *conf.AppConfig, dbs DBs, rdbs RDBs, logger *logs.Logger) (*Data, func(), error) {
+	rdb := rdbs[DefaultRDB]
+	// 分页的count缓存使用redis, 按连接名称区分key
+	for name, db := range dbs {
+		if err := page.UseCountCache(db, &pageCountCache{rdb: rdb}, name); err != nil {
+			return nil, nil, errors.Wrapf(err, "use count cache for %s", name)
+		}
+	}
+	c, err := newCache(appConf.Cache, rdb, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	d := &Data{
+		name:  DefaultDB,
+		dbs:   dbs,
+		db:    dbs[DefaultDB],
+		rdbs:  rdbs,
+		rdb:   rdb,
+		cache: c,
+	}
+	if err = autoMigrate(appConf, d.db, logger); err != nil {
+		c.Close()
+		return nil, nil, err
+	}
+	return d, func() {
+		if err := c.Close(); err != nil {
+			logger.Errorf("close cache error: %v", err)
+		}
 	}, nil
 }
 
-// InTx Transaction
-func (d *Data) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
-	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		ctx = context.WithValue(ctx, contextTxKey{}, tx)
-		return fn(ctx)
-	})
+// Named 使用指定名称连接的Data, 用于仓储声明使用的数据库, 未配置该名称时panic
+//
+//	func NewReportRepo(data *Data) biz.IReportRepo {
+//		return &reportRepo{data: data.Named("reporting")}
+//	}
+func (d *Data) Named(name string) *Data {
+	db, ok := d.dbs[name]
+	if !ok {
+		panic(fmt.Sprintf("data: database %q is not configured", name))
+	}
+	return &Data{
+		name:  name,
+		dbs:   d.dbs,
+		db:    db,
+		rdbs:  d.rdbs,
+		rdb:   d.rdb,
+		cache: d.cache,
+	}
 }
 
-// DB 获取mysql
+// DB 获取数据库连接, 读操作路由到从库, 事务中和写操作之后的读使用主库
 func (d *Data) DB(ctx context.Context) *gorm.DB {
 	// 当前的db是不是使用事务
-	tx, ok := ctx.Value(contextTxKey{}).(*gorm.DB)
+	// 事务开启时已经设置了请求的logger, 这里只替换ctx
+	tx, ok := ctx.Value(contextTxKey{name: d.name}).(*gorm.DB)
 	if ok {
-		return tx
+		return tx.WithContext(ctx)
 	}
 
 	return d.db.Session(&gorm.Session{
@@ -72,20 +142,111 @@ func (d *Data) DB(ctx context.Context) *gorm.DB {
 	})
 }
 
-func (d *Data) RDB() *redis.Client {
+// DBNamed 获取指定名称的数据库连接, 规则同DB
+func (d *Data) DBNamed(ctx context.Context, name string) *gorm.DB {
+	return d.Named(name).DB(ctx)
+}
+
+func (d *Data) RDB() redisx.Client {
 	return d.rdb
 }
 
-// NewDB mysql连接
-func NewDB(appConf *conf.AppConfig, logger *logs.Logger) (*gorm.DB, error) {
-	return newMysqlClient(appConf, logger)
+// NamedRDB 获取指定名称的redis连接, 未配置该名称时panic
+func (d *Data) NamedRDB(name string) redisx.Client {
+	rdb, ok := d.rdbs[name]
+	if !ok {
+		panic(fmt.Sprintf("data: redis %q is not configured", name))
+	}
+	return rdb
+}
+
+// NewDB 默认的数据库连接
+func NewDB(appConf *conf.AppConfig, logger *logs.Logger) (*gorm.DB, func(), error) {
+	// 所有连接共用的加密密钥, 在打开连接前设置
+	keyring, err := newKeyring(appConf.Encrypt)
+	if err != nil {
+		return nil, nil, err
+	}
+	encrypt.SetKeyring(keyring)
+	return openDB(appConf.Env, appConf.DBAddress, logger)
+}
+
+// NewDBs 所有的数据库连接, 包含默认连接和databases中配置的命名连接
+func NewDBs(appConf *conf.AppConfig, db *gorm.DB, logger *logs.Logger) (DBs, func(), error) {
+	dbs := DBs{DefaultDB: db}
+	cleanups := make([]func(), 0, len(appConf.Databases))
+	cleanup := func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}
+	for name, c := range appConf.Databases {
+		if _, ok := dbs[name]; ok {
+			cleanup()
+			return nil, nil, errors.Errorf("database name %q is reserved", name)
+		}
+		named, closeFn, err := openDB(appConf.Env, c, logger)
+		if err != nil {
+			cleanup()
+			return nil, nil, errors.WithMessagef(err, "open database %q", name)
+		}
+		dbs[name] = named
+		cleanups = append(cleanups, closeFn)
+	}
+	return dbs, cleanup, nil
 }
 
 // NewRDB redis连接
-func NewRDB(appConf *conf.AppConfig) (*redis.Client, error) {
-	redisClient := newRedisClient(appConf.RedisAPI)
-	_, err := redisClient.Ping().Result()
-	return redisClient, errors.WithStack(err)
+func NewRDB(appConf *conf.AppConfig, logger *logs.Logger) (redisx.Client, func(), error) {
+	return openRDB(DefaultRDB, appConf.RedisAPI, logger)
+}
+
+// NewRDBs 所有的redis连接, 包含默认连接和redises中配置的命名连接
+func NewRDBs(appConf *conf.AppConfig, rdb redisx.Client, logger *logs.Logger) (RDBs, func(), error) {
+	rdbs := RDBs{DefaultRDB: rdb}
+	cleanups := make([]func(), 0, len(appConf.Redises))
+	cleanup := func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}
+	for name, c := range appConf.Redises {
+		if _, ok := rdbs[name]; ok {
+			cleanup()
+			return nil, nil, errors.Errorf("redis name %q is reserved", name)
+		}
+		named, closeFn, err := openRDB(name, c, logger)
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		rdbs[name] = named
+		cleanups = append(cleanups, closeFn)
+	}
+	return rdbs, cleanup, nil
+}
+
+// openRDB 创建redis连接, 没有配置lazy时检查连接是否可用
+func openRDB(name string, c *conf.RedisConf, logger *logs.Logger) (redisx.Client, func(), error) {
+	if c == nil {
+		return nil, nil, errors.Errorf("redis %q is not configured", name)
+	}
+	rdb, err := newRedisClient(c)
+	if err != nil {
+		return nil, nil, errors.WithMessagef(err, "redis %q", name)
+	}
+	cleanup := func() {
+		if err := rdb.Close(); err != nil {
+			logger.Errorf("close redis %q error: %v", name, err)
+		}
+	}
+	if !c.Lazy {
+		if err = rdb.Ping().Err(); err != nil {
+			cleanup()
+			return nil, nil, errors.Wrapf(err, "ping redis %q", name)
+		}
+	}
+	return rdb, cleanup, nil
 }
 
 // createMysqlDsn 生成dsn
@@ -100,8 +261,92 @@ func createMysqlDsn(d *conf.MysqlConf) string {
 	)
 }
 
-// newMysqlClient 获取mysql连接
-func newMysqlClient(appConf *conf.AppConfig, logger *logs.Logger) (*gorm.DB, error) {
+// newResolver 创建从库连接池, 连接在使用时才建立, 启动时从库不可用不影响服务
+func newResolver(c *conf.MysqlConf, logger *logs.Logger) (*dbresolver.Resolver, error) {
+	if len(c.Replicas) > 0 && c.Driver == DriverSqlite {
+		return nil, errors.New("sqlite does not support replicas")
+	}
+	replicas := make([]dbresolver.Replica, 0, len(c.Replicas))
+	fail := func(err error) (*dbresolver.Resolver, error) {
+		for _, r := range replicas {
+			_ = r.DB.Close()
+		}
+		return nil, err
+	}
+	for _, r := range c.Replicas {
+		rc := *c
+		// 从库的dsn由主机配置生成, 不使用主库的dsn
+		rc.Dsn, rc.Hostname, rc.Port = "", r.Hostname, r.Port
+		if r.Username != "" {
+			rc.Username, rc.Password = r.Username, r.Password
+		}
+		dialector, err := newDialector(&rc, true)
+		if err != nil {
+			return fail(err)
+		}
+		db, err := gorm.Open(dialector, &gorm.Config{DisableAutomaticPing: true})
+		if err != nil {
+			return fail(errors.WithStack(err))
+		}
+		conn, err := db.DB()
+		if err != nil {
+			return fail(errors.WithStack(err))
+		}
+		conn.SetMaxOpenConns(c.MaxOpenConns)
+		conn.SetMaxIdleConns(c.MaxIdleConns)
+		replicas = append(replicas, dbresolver.Replica{
+			Name:   fmt.Sprintf("%s:%d", r.Hostname, r.Port),
+			DB:     conn,
+			Weight: r.Weight,
+		})
+	}
+	return dbresolver.New(replicas, time.Duration(c.HealthCheckSeconds)*time.Second, logger), nil
+}
+
+// openDB 打开数据库连接并注册读写分离, 嵌入tenant.Mixin的模型按租户隔离, 加密字段读写时加解密, auditModels的变更记录审计日志
+func openDB(env string, c *conf.MysqlConf, logger *logs.Logger) (*gorm.DB, func(), error) {
+	db, err := newDBClient(env, c, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	closePrimary := func() {
+		if conn, err := db.DB(); err == nil {
+			if err = conn.Close(); err != nil {
+				logger.Errorf("close database error: %v", err)
+			}
+		}
+	}
+	resolver, err := newResolver(c, logger)
+	if err != nil {
+		closePrimary()
+		return nil, nil, err
+	}
+	cleanup := func() {
+		if err := resolver.Close(); err != nil {
+			logger.Errorf("close database replicas error: %v", err)
+		}
+		closePrimary()
+	}
+	if err = db.Use(resolver); err != nil {
+		cleanup()
+		return nil, nil, errors.WithStack(err)
+	}
+	// 租户条件先于审计添加, 审计查询变更前的数据时使用相同的条件
+	for _, plugin := range []gorm.Plugin{tenant.New(), encrypt.New(), audit.New(0, auditModels...)} {
+		if err = db.Use(plugin); err != nil {
+			cleanup()
+			return nil, nil, errors.WithStack(err)
+		}
+	}
+	return db, cleanup, nil
+}
+
+// newDBClient 按配置的驱动获取数据库连接
+func newDBClient(env string, c *conf.MysqlConf, logger *logs.Logger) (*gorm.DB, error) {
+	dialector, err := newDialector(c, false)
+	if err != nil {
+		return nil, err
+	}
 	newLogger := gormlogger.New(
 		log.New(logger.Writer(), "\r\n", log.LstdFlags), // io writer
 		gormlogger.Config{
@@ -109,7 +354,7 @@ func newMysqlClient(appConf *conf.AppConfig, logger *logs.Logger) (*gorm.DB, err
 		},
 	)
 
-	db, err := gorm.Open(mysql.Open(createMysqlDsn(appConf.DBAddress)), &gorm.Config{
+	db, err := gorm.Open(dialector, &gorm.Config{
 		// 禁用默认的事务操作
 		SkipDefaultTransaction: true,
 		Logger:                 newLogger,
@@ -123,25 +368,83 @@ func newMysqlClient(appConf *conf.AppConfig, logger *logs.Logger) (*gorm.DB, err
 		return nil, errors.WithStack(err)
 	}
 
-	conn.SetMaxOpenConns(appConf.DBAddress.MaxOpenConns)
-	conn.SetMaxIdleConns(appConf.DBAddress.MaxIdleConns)
+	conn.SetMaxOpenConns(c.MaxOpenConns)
+	conn.SetMaxIdleConns(c.MaxIdleConns)
 
 	// 开发环境和测试环境开启debug
-	if appConf.Env == conf.EnvTest || appConf.Env == conf.EnvDev {
+	if env == conf.EnvTest || env == conf.EnvDev {
 		db = db.Debug()
 	}
 
 	return db, nil
 }
 
-// RedisClient 初始化redis连接池
-func newRedisClient(r *conf.RedisConf) *redis.Client {
-	return redis.NewClient(&redis.Options{
-		Addr:         r.Address,
-		DialTimeout:  time.Duration(r.DialTimeoutMillisecond) * time.Millisecond,
-		ReadTimeout:  time.Duration(r.RWTimeoutMillisecond) * time.Millisecond,
-		WriteTimeout: time.Duration(r.RWTimeoutMillisecond) * time.Millisecond,
-		PoolSize:     r.PoolSize,
-		Password:     r.Password,
-	})
+// newRedisClient 按mode初始化redis连接池
+func newRedisClient(r *conf.RedisConf) (redisx.Client, error) {
+	var tlsConfig *tls.Config
+	if r.TLS {
+		tlsConfig = &tls.Config{InsecureSkipVerify: r.TLSSkipVerify} //nolint:gosec
+	}
+	idleTimeout := time.Duration(r.IdleTimeoutSeconds) * time.Second
+	if r.IdleTimeoutSeconds < 0 {
+		idleTimeout = -1
+	}
+	dialTimeout := time.Duration(r.DialTimeoutMillisecond) * time.Millisecond
+	rwTimeout := time.Duration(r.RWTimeoutMillisecond) * time.Millisecond
+
+	switch r.Mode {
+	case "", "standalone":
+		if r.Address == "" {
+			return nil, errors.New("address is required")
+		}
+		return redisx.NewClient(&redis.Options{
+			Addr:         r.Address,
+			Password:     r.Password,
+			DB:           r.DB,
+			DialTimeout:  dialTimeout,
+			ReadTimeout:  rwTimeout,
+			WriteTimeout: rwTimeout,
+			PoolSize:     r.PoolSize,
+			MinIdleConns: r.MinIdleConns,
+			IdleTimeout:  idleTimeout,
+			TLSConfig:    tlsConfig,
+		}), nil
+	case "sentinel":
+		if r.MasterName == "" || len(r.Addresses) == 0 {
+			return nil, errors.New("sentinel requires master_name and addresses")
+		}
+		return redisx.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    r.MasterName,
+			SentinelAddrs: r.Addresses,
+			Password:      r.Password,
+			DB:            r.DB,
+			DialTimeout:   dialTimeout,
+			ReadTimeout:   rwTimeout,
+			WriteTimeout:  rwTimeout,
+			PoolSize:      r.PoolSize,
+			MinIdleConns:  r.MinIdleConns,
+			IdleTimeout:   idleTimeout,
+			TLSConfig:     tlsConfig,
+		}), nil
+	case "cluster":
+		if len(r.Addresses) == 0 {
+			return nil, errors.New("cluster requires addresses")
+		}
+		if r.DB != 0 {
+			return nil, errors.New("cluster does not support db")
+		}
+		return redisx.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        r.Addresses,
+			Password:     r.Password,
+			DialTimeout:  dialTimeout,
+			ReadTimeout:  rwTimeout,
+			WriteTimeout: rwTimeout,
+			PoolSize:     r.PoolSize,
+			MinIdleConns: r.MinIdleConns,
+			IdleTimeout:  idleTimeout,
+			TLSConfig:    tlsConfig,
+		}), nil
+	default:
+		return nil, errors.Errorf("unknown redis mode %q", r.Mode)
+	}
 }
@@ -0,0 +1,60 @@
+package data
+
+import (
+	"fmt"
+	"gin-layout/internal/conf"
+
+	"github.com/pkg/errors"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const (
+	DriverMysql    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSqlite   = "sqlite" // 用于本地开发和测试, 需要cgo
+)
+
+// newDialector 按driver创建gorm方言, lazy为true时不在初始化时连接数据库(用于从库)
+func newDialector(c *conf.MysqlConf, lazy bool) (gorm.Dialector, error) {
+	switch c.Driver {
+	case "", DriverMysql:
+		dsn := c.Dsn
+		if dsn == "" {
+			dsn = createMysqlDsn(c)
+		}
+		return mysql.New(mysql.Config{DSN: dsn, SkipInitializeWithVersion: lazy}), nil
+	case DriverPostgres:
+		dsn := c.Dsn
+		if dsn == "" {
+			dsn = createPostgresDsn(c)
+		}
+		return postgres.Open(dsn), nil
+	case DriverSqlite:
+		dsn := c.Dsn
+		if dsn == "" {
+			dsn = c.DatabaseName
+		}
+		return sqlite.Open(dsn), nil
+	default:
+		return nil, errors.Errorf("unsupported database driver: %s", c.Driver)
+	}
+}
+
+// createPostgresDsn 生成postgres的dsn
+func createPostgresDsn(d *conf.MysqlConf) string {
+	sslMode := d.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		d.Hostname,
+		d.Port,
+		d.Username,
+		d.Password,
+		d.DatabaseName,
+		sslMode,
+	)
+}
@@ -0,0 +1,68 @@
+package data
+
+import (
+	"context"
+	"encoding/base64"
+	"gin-layout/internal/conf"
+	"gin-layout/internal/data/model"
+	"gin-layout/internal/pkg/encrypt"
+
+	"github.com/pkg/errors"
+	logs "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// encryptedModels 包含加密字段的模型, 轮换密钥后由ReEncrypt重新加密
+var encryptedModels = []any{
+	&model.UcUser{},
+}
+
+// newKeyring 按配置创建加密字段的密钥, 没有配置时返回nil
+func newKeyring(c *conf.EncryptConf) (*encrypt.Keyring, error) {
+	if c == nil || len(c.Keys) == 0 {
+		return nil, nil
+	}
+	keys := make(map[string][]byte, len(c.Keys))
+	for id, s := range c.Keys {
+		key, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "encrypt key %q", id)
+		}
+		keys[id] = key
+	}
+	indexKey, err := base64.StdEncoding.DecodeString(c.BlindIndexKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "encrypt blind_index_key")
+	}
+	return encrypt.NewKeyring(c.CurrentKey, keys, indexKey)
+}
+
+// ReEncrypt 使用当前的key重新加密所有加密字段并重建盲索引, table不为空时只处理该表
+func ReEncrypt(ctx context.Context, db *gorm.DB, table string, batchSize int, logger *logs.Logger) ([]*encrypt.RotateResult, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	list := make([]*encrypt.RotateResult, 0, len(encryptedModels))
+	for _, m := range encryptedModels {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(m); err != nil {
+			return list, errors.WithStack(err)
+		}
+		if table != "" && stmt.Schema.Table != table {
+			continue
+		}
+		res, err := encrypt.Rotate(ctx, db, m, batchSize, func(r *encrypt.RotateResult) {
+			logger.Infof("reencrypt %s: scanned %d, updated %d, skipped %d", r.Table, r.Scanned, r.Updated, r.Skipped)
+		})
+		if res != nil {
+			list = append(list, res)
+		}
+		if err != nil {
+			return list, err
+		}
+	}
+	if table != "" && len(list) == 0 {
+		return nil, errors.Errorf("table %q has no encrypted fields", table)
+	}
+	return list, nil
+}
@@ -0,0 +1,44 @@
+package data
+
+import (
+	"gin-layout/internal/conf"
+	"gin-layout/internal/pkg/lock"
+	"gin-layout/internal/pkg/redisx"
+	"time"
+
+	"github.com/pkg/errors"
+	logs "github.com/sirupsen/logrus"
+)
+
+// NewLocker 分布式锁, 默认使用Data.RDB(), 配置了redlock节点时使用redlock
+func NewLocker(appConf *conf.AppConfig, d *Data, logger *logs.Logger) (*lock.Locker, func(), error) {
+	c := appConf.Lock
+	if c == nil {
+		c = &conf.LockConf{}
+	}
+	opts := lock.Options{
+		TTL:         time.Duration(c.TTLSeconds) * time.Second,
+		WaitTimeout: time.Duration(c.WaitSeconds) * time.Second,
+		Logger:      logger,
+	}
+	if len(c.Redlock) == 0 {
+		return lock.New(opts, d.RDB()), func() {}, nil
+	}
+	clients := make([]redisx.Client, 0, len(c.Redlock))
+	cleanup := func() {
+		for _, client := range clients {
+			if err := client.Close(); err != nil {
+				logger.Errorf("close redlock client error: %v", err)
+			}
+		}
+	}
+	for i, rc := range c.Redlock {
+		client, err := newRedisClient(rc)
+		if err != nil {
+			cleanup()
+			return nil, nil, errors.WithMessagef(err, "redlock node %d", i)
+		}
+		clients = append(clients, client)
+	}
+	return lock.New(opts, clients...), cleanup, nil
+}
@@ -0,0 +1,27 @@
+package data
+
+import (
+	"context"
+	"gin-layout/internal/conf"
+	"gin-layout/internal/data/migrations"
+	"gin-layout/internal/pkg/migrate"
+
+	logs "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// autoMigrate 开发和测试环境配置了auto_migrate时, 启动时执行未执行的迁移
+func autoMigrate(appConf *conf.AppConfig, db *gorm.DB, logger *logs.Logger) error {
+	if !appConf.AutoMigrate || (appConf.Env != conf.EnvTest && appConf.Env != conf.EnvDev) {
+		return nil
+	}
+	src, err := migrations.Source()
+	if err != nil {
+		return err
+	}
+	done, err := migrate.New(db, src).Up(context.Background(), 0)
+	for _, mg := range done {
+		logger.Infof("migrate up: %d_%s", mg.Version, mg.Name)
+	}
+	return err
+}
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS "uc_users";
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS `uc_users` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `name` VARCHAR(64) NOT NULL DEFAULT '',
+  `serial_number` INT NOT NULL DEFAULT 0,
+  `is_del` TINYINT NOT NULL DEFAULT 0,
+  `deleted_at` DATETIME(3) NULL DEFAULT NULL,
+  `deleted_by` BIGINT UNSIGNED NOT NULL DEFAULT 0,
+  `created_at` DATETIME(3) NOT NULL,
+  `updated_at` DATETIME(3) NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_is_del_deleted_at` (`is_del`, `deleted_at`),
+  KEY `idx_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
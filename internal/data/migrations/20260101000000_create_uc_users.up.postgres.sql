@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS "uc_users" (
+  "id" BIGSERIAL PRIMARY KEY,
+  "name" VARCHAR(64) NOT NULL DEFAULT '',
+  "serial_number" INTEGER NOT NULL DEFAULT 0,
+  "is_del" SMALLINT NOT NULL DEFAULT 0,
+  "deleted_at" TIMESTAMPTZ NULL DEFAULT NULL,
+  "deleted_by" BIGINT NOT NULL DEFAULT 0,
+  "created_at" TIMESTAMPTZ NOT NULL,
+  "updated_at" TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS "idx_uc_users_is_del_deleted_at" ON "uc_users" ("is_del", "deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_uc_users_created_at" ON "uc_users" ("created_at");
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS `uc_users` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `name` VARCHAR(64) NOT NULL DEFAULT '',
+  `serial_number` INTEGER NOT NULL DEFAULT 0,
+  `is_del` INTEGER NOT NULL DEFAULT 0,
+  `deleted_at` DATETIME NULL DEFAULT NULL,
+  `deleted_by` INTEGER NOT NULL DEFAULT 0,
+  `created_at` DATETIME NOT NULL,
+  `updated_at` DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS `idx_uc_users_is_del_deleted_at` ON `uc_users` (`is_del`, `deleted_at`);
+CREATE INDEX IF NOT EXISTS `idx_uc_users_created_at` ON `uc_users` (`created_at`);
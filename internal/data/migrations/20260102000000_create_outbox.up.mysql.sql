@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS `outbox` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `topic` VARCHAR(128) NOT NULL,
+  `msg_key` VARCHAR(128) NOT NULL DEFAULT '',
+  `payload` MEDIUMTEXT NOT NULL,
+  `status` TINYINT NOT NULL DEFAULT 0,
+  `attempts` INT NOT NULL DEFAULT 0,
+  `next_attempt_at` DATETIME(3) NOT NULL,
+  `locked_by` VARCHAR(64) NOT NULL DEFAULT '',
+  `last_error` VARCHAR(1024) NOT NULL DEFAULT '',
+  `created_at` DATETIME(3) NOT NULL,
+  `sent_at` DATETIME(3) NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_status_next_attempt_at` (`status`, `next_attempt_at`),
+  KEY `idx_status_sent_at` (`status`, `sent_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
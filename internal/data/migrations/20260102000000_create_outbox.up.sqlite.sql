@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS `outbox` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `topic` VARCHAR(128) NOT NULL,
+  `msg_key` VARCHAR(128) NOT NULL DEFAULT '',
+  `payload` TEXT NOT NULL,
+  `status` INTEGER NOT NULL DEFAULT 0,
+  `attempts` INTEGER NOT NULL DEFAULT 0,
+  `next_attempt_at` DATETIME NOT NULL,
+  `locked_by` VARCHAR(64) NOT NULL DEFAULT '',
+  `last_error` VARCHAR(1024) NOT NULL DEFAULT '',
+  `created_at` DATETIME NOT NULL,
+  `sent_at` DATETIME NULL DEFAULT NULL
+);
+CREATE INDEX IF NOT EXISTS `idx_outbox_status_next_attempt_at` ON `outbox` (`status`, `next_attempt_at`);
+CREATE INDEX IF NOT EXISTS `idx_outbox_status_sent_at` ON `outbox` (`status`, `sent_at`);
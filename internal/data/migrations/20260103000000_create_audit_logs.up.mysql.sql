@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS `audit_logs` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `entity` VARCHAR(64) NOT NULL,
+  `entity_id` VARCHAR(64) NOT NULL,
+  `action` VARCHAR(16) NOT NULL,
+  `old_values` MEDIUMTEXT NOT NULL,
+  `new_values` MEDIUMTEXT NOT NULL,
+  `user_id` BIGINT UNSIGNED NOT NULL DEFAULT 0,
+  `request_id` VARCHAR(64) NOT NULL DEFAULT '',
+  `created_at` DATETIME(3) NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_entity_entity_id` (`entity`, `entity_id`),
+  KEY `idx_user_id_created_at` (`user_id`, `created_at`),
+  KEY `idx_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
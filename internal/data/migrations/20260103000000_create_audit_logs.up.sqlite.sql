@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS `audit_logs` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `entity` VARCHAR(64) NOT NULL,
+  `entity_id` VARCHAR(64) NOT NULL,
+  `action` VARCHAR(16) NOT NULL,
+  `old_values` TEXT NOT NULL,
+  `new_values` TEXT NOT NULL,
+  `user_id` INTEGER NOT NULL DEFAULT 0,
+  `request_id` VARCHAR(64) NOT NULL DEFAULT '',
+  `created_at` DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS `idx_audit_logs_entity_entity_id` ON `audit_logs` (`entity`, `entity_id`);
+CREATE INDEX IF NOT EXISTS `idx_audit_logs_user_id_created_at` ON `audit_logs` (`user_id`, `created_at`);
+CREATE INDEX IF NOT EXISTS `idx_audit_logs_created_at` ON `audit_logs` (`created_at`);
@@ -0,0 +1,3 @@
+ALTER TABLE `uc_users`
+  DROP KEY `idx_tenant_id_created_at`,
+  DROP COLUMN `tenant_id`;
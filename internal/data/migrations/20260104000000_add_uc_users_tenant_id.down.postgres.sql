@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS "idx_uc_users_tenant_id_created_at";
+ALTER TABLE "uc_users" DROP COLUMN IF EXISTS "tenant_id";
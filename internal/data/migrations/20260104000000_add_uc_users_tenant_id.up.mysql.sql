@@ -0,0 +1,3 @@
+ALTER TABLE `uc_users`
+  ADD COLUMN `tenant_id` VARCHAR(64) NOT NULL DEFAULT '' AFTER `id`,
+  ADD KEY `idx_tenant_id_created_at` (`tenant_id`, `created_at`);
@@ -0,0 +1,2 @@
+ALTER TABLE "uc_users" ADD COLUMN IF NOT EXISTS "tenant_id" VARCHAR(64) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS "idx_uc_users_tenant_id_created_at" ON "uc_users" ("tenant_id", "created_at");
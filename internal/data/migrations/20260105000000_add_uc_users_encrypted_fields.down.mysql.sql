@@ -0,0 +1,7 @@
+ALTER TABLE `uc_users`
+  DROP KEY `idx_id_card_bidx`,
+  DROP KEY `idx_phone_bidx`,
+  DROP COLUMN `id_card_bidx`,
+  DROP COLUMN `id_card`,
+  DROP COLUMN `phone_bidx`,
+  DROP COLUMN `phone`;
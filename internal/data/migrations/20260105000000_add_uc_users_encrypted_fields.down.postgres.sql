@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS "idx_uc_users_id_card_bidx";
+DROP INDEX IF EXISTS "idx_uc_users_phone_bidx";
+ALTER TABLE "uc_users"
+  DROP COLUMN IF EXISTS "id_card_bidx",
+  DROP COLUMN IF EXISTS "id_card",
+  DROP COLUMN IF EXISTS "phone_bidx",
+  DROP COLUMN IF EXISTS "phone";
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS `idx_uc_users_id_card_bidx`;
+DROP INDEX IF EXISTS `idx_uc_users_phone_bidx`;
+ALTER TABLE `uc_users` DROP COLUMN `id_card_bidx`;
+ALTER TABLE `uc_users` DROP COLUMN `id_card`;
+ALTER TABLE `uc_users` DROP COLUMN `phone_bidx`;
+ALTER TABLE `uc_users` DROP COLUMN `phone`;
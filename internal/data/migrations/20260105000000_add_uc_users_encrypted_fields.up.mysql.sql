@@ -0,0 +1,7 @@
+ALTER TABLE `uc_users`
+  ADD COLUMN `phone` VARCHAR(255) NOT NULL DEFAULT '',
+  ADD COLUMN `phone_bidx` VARCHAR(32) NOT NULL DEFAULT '',
+  ADD COLUMN `id_card` VARCHAR(255) NOT NULL DEFAULT '',
+  ADD COLUMN `id_card_bidx` VARCHAR(32) NOT NULL DEFAULT '',
+  ADD KEY `idx_phone_bidx` (`phone_bidx`),
+  ADD KEY `idx_id_card_bidx` (`id_card_bidx`);
@@ -0,0 +1,7 @@
+ALTER TABLE "uc_users"
+  ADD COLUMN IF NOT EXISTS "phone" VARCHAR(255) NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS "phone_bidx" VARCHAR(32) NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS "id_card" VARCHAR(255) NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS "id_card_bidx" VARCHAR(32) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS "idx_uc_users_phone_bidx" ON "uc_users" ("phone_bidx");
+CREATE INDEX IF NOT EXISTS "idx_uc_users_id_card_bidx" ON "uc_users" ("id_card_bidx");
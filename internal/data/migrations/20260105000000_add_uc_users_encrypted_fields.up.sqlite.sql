@@ -0,0 +1,6 @@
+ALTER TABLE `uc_users` ADD COLUMN `phone` VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE `uc_users` ADD COLUMN `phone_bidx` VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE `uc_users` ADD COLUMN `id_card` VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE `uc_users` ADD COLUMN `id_card_bidx` VARCHAR(32) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS `idx_uc_users_phone_bidx` ON `uc_users` (`phone_bidx`);
+CREATE INDEX IF NOT EXISTS `idx_uc_users_id_card_bidx` ON `uc_users` (`id_card_bidx`);
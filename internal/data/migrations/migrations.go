@@ -0,0 +1,21 @@
+package migrations
+
+import (
+	"embed"
+	"gin-layout/internal/pkg/migrate"
+)
+
+// Dir 迁移文件所在目录, migrate create 在这里生成文件
+const Dir = "internal/data/migrations"
+
+//go:embed *.sql
+var sqlFS embed.FS
+
+// Source 编译进二进制的所有迁移, Go迁移在这里通过src.Add添加
+func Source() (*migrate.Source, error) {
+	src := migrate.NewSource()
+	if err := src.AddFS(sqlFS); err != nil {
+		return nil, err
+	}
+	return src, nil
+}
@@ -1,17 +1,21 @@
 package model
 
 import (
+	"gin-layout/internal/pkg/softdelete"
 	"time"
 )
 
 const (
-	MysqlNotDel = iota
-	MysqlIsDel
+	MysqlNotDel = softdelete.NotDeleted
+	MysqlIsDel  = softdelete.Deleted
 )
 
+// Model 嵌入Model的模型默认只查询 is_del=0 的数据, Delete为软删除
 type Model struct {
-	ID        uint64    `gorm:"primaryKey"`
-	IsDel     int8      `gorm:"is_del"`
-	CreatedAt time.Time `gorm:"column:created_at"`
-	UpdatedAt time.Time `gorm:"column:updated_at"`
+	ID        uint64          `gorm:"primaryKey"`
+	IsDel     softdelete.Flag `gorm:"column:is_del"`
+	DeletedAt *time.Time      `gorm:"column:deleted_at"`
+	DeletedBy uint64          `gorm:"column:deleted_by"` // 删除操作人
+	CreatedAt time.Time       `gorm:"column:created_at"`
+	UpdatedAt time.Time       `gorm:"column:updated_at"`
 }
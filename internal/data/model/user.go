@@ -1,11 +1,19 @@
 package model
 
-import "gin-layout/internal/biz"
+import (
+	"gin-layout/internal/biz"
+	"gin-layout/internal/pkg/tenant"
+)
 
 type UcUser struct {
 	Model
+	tenant.Mixin
 	Name         string
 	SerialNumber int
+	Phone        string `gorm:"column:phone;serializer:encrypt" blind_index:"phone_bidx" audit:"redact"`
+	PhoneBidx    string `gorm:"column:phone_bidx" audit:"-"`
+	IdCard       string `gorm:"column:id_card;serializer:encrypt" blind_index:"id_card_bidx" audit:"redact"`
+	IdCardBidx   string `gorm:"column:id_card_bidx" audit:"-"`
 }
 
 func (u *UcUser) TableName() string {
@@ -17,5 +25,7 @@ func (u *UcUser) ToDomain() *biz.UcUser {
 		Id:           u.ID,
 		Name:         u.Name,
 		SerialNumber: u.SerialNumber,
+		Phone:        u.Phone,
+		IdCard:       u.IdCard,
 	}
 }
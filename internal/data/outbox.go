@@ -0,0 +1,64 @@
+package data
+
+import (
+	"context"
+	"gin-layout/internal/biz"
+	"gin-layout/internal/conf"
+	"gin-layout/internal/pkg/outbox"
+	"time"
+
+	"github.com/pkg/errors"
+	logs "github.com/sirupsen/logrus"
+)
+
+type outboxRepo struct {
+	data  *Data
+	relay *outbox.Relay
+}
+
+// NewOutbox 领域事件写入outbox表
+func NewOutbox(data *Data, relay *outbox.Relay) biz.Outbox {
+	return &outboxRepo{data: data, relay: relay}
+}
+
+func (o *outboxRepo) Publish(ctx context.Context, topic, key string, payload any) error {
+	if _, err := outbox.Add(o.data.DB(ctx), topic, key, payload); err != nil {
+		return err
+	}
+	// 提交后通知relay立即投递, 不用等下一次轮询
+	o.data.OnCommit(ctx, func(context.Context) {
+		o.relay.Notify()
+	})
+	return nil
+}
+
+// NewOutboxRelay 投递outbox表中的事件, 由App启动, 返回的清理函数停止投递
+func NewOutboxRelay(appConf *conf.AppConfig, d *Data, logger *logs.Logger) (*outbox.Relay, func(), error) {
+	c := appConf.Outbox
+	if c == nil {
+		c = &conf.OutboxConf{}
+	}
+	var publisher outbox.Publisher
+	switch c.Publisher {
+	case "", "redis_stream":
+		publisher = outbox.NewRedisStreamPublisher(d.RDB(), c.StreamPrefix, c.StreamMaxLen)
+	case "webhook":
+		if c.WebhookURL == "" {
+			return nil, nil, errors.New("outbox webhook_url is required")
+		}
+		publisher = outbox.NewWebhookPublisher(c.WebhookURL, c.WebhookSecret, time.Duration(c.WebhookTimeoutMs)*time.Millisecond)
+	default:
+		return nil, nil, errors.Errorf("unknown outbox publisher %q", c.Publisher)
+	}
+	retention := time.Duration(c.RetentionDays) * 24 * time.Hour
+	if c.RetentionDays < 0 {
+		retention = -1
+	}
+	relay := outbox.NewRelay(d.db, publisher, outbox.Options{
+		Interval:    time.Duration(c.PollIntervalMs) * time.Millisecond,
+		BatchSize:   c.BatchSize,
+		MaxAttempts: c.MaxAttempts,
+		Retention:   retention,
+	}, logger)
+	return relay, relay.Stop, nil
+}
@@ -0,0 +1,81 @@
+package data
+
+import (
+	"context"
+	"gin-layout/internal/biz"
+	"gin-layout/internal/conf"
+	"gin-layout/internal/pkg/queue"
+	"gin-layout/internal/pkg/redisx"
+	"time"
+
+	logs "github.com/sirupsen/logrus"
+)
+
+type jobQueue struct {
+	data   *Data
+	client *queue.Client
+}
+
+// NewJobs 后台任务入队, 使用queue.redis配置的redis连接
+func NewJobs(appConf *conf.AppConfig, d *Data) biz.Jobs {
+	c := queueConf(appConf)
+	maxRetries := c.MaxRetries
+	switch {
+	case maxRetries == 0:
+		maxRetries = -1
+	case maxRetries < 0:
+		maxRetries = 0
+	}
+	return &jobQueue{data: d, client: queue.NewClient(queueRDB(c, d), c.Prefix, maxRetries)}
+}
+
+func (q *jobQueue) Enqueue(ctx context.Context, jobType string, payload any, opts ...queue.Option) (string, error) {
+	job, err := q.client.NewJob(ctx, jobType, payload, opts...)
+	if err != nil {
+		return "", err
+	}
+	if !q.data.inTx(ctx) {
+		return job.ID, q.client.Push(ctx, job)
+	}
+	// 事务提交后才入队, 避免任务读不到未提交的数据; 此时业务已经提交, 入队失败只记录日志
+	q.data.OnCommit(ctx, func(ctx context.Context) {
+		if err := q.client.Push(ctx, job); err != nil {
+			if logger, ok := ctx.Value("logger").(*logs.Entry); ok {
+				logger.Errorf("enqueue job %s (%s) error: %+v", job.ID, job.Type, err)
+			}
+		}
+	})
+	return job.ID, nil
+}
+
+// NewJobWorker 执行后台任务, 由App启动, 返回的清理函数停止消费并等待执行中的任务完成
+func NewJobWorker(appConf *conf.AppConfig, d *Data, handlers biz.JobHandlers, logger *logs.Logger) (*queue.Worker, func(), error) {
+	c := queueConf(appConf)
+	worker, err := queue.NewWorker(queueRDB(c, d), handlers, queue.Options{
+		Prefix:      c.Prefix,
+		Concurrency: c.Concurrency,
+		Backoff:     time.Duration(c.BackoffMs) * time.Millisecond,
+		MaxBackoff:  time.Duration(c.MaxBackoffSeconds) * time.Second,
+		Timeout:     time.Duration(c.TimeoutSeconds) * time.Second,
+		ClaimIdle:   time.Duration(c.ClaimIdleSeconds) * time.Second,
+		DeadMaxLen:  c.DeadMaxLen,
+	}, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	return worker, worker.Stop, nil
+}
+
+func queueConf(appConf *conf.AppConfig) *conf.QueueConf {
+	if appConf.Queue == nil {
+		return &conf.QueueConf{}
+	}
+	return appConf.Queue
+}
+
+func queueRDB(c *conf.QueueConf, d *Data) redisx.Client {
+	if c.Redis == "" {
+		return d.RDB()
+	}
+	return d.NamedRDB(c.Redis)
+}
@@ -1,5 +1,24 @@
 package data
 
-//func getUserKey(id uint64) string {
-//	return fmt.Sprintf("gin_layout:user_id:%d", id)
-//}
+import (
+	"context"
+	"gin-layout/internal/pkg/page"
+	"gin-layout/internal/pkg/redisx"
+	"time"
+)
+
+// pageCountCache page.CountCache 的redis实现
+type pageCountCache struct {
+	rdb redisx.Client
+}
+
+var _ page.CountCache = (*pageCountCache)(nil)
+
+func (c *pageCountCache) Get(ctx context.Context, key string) (int64, bool) {
+	total, err := c.rdb.WithContext(ctx).Get(key).Int64()
+	return total, err == nil
+}
+
+func (c *pageCountCache) Set(ctx context.Context, key string, total int64, ttl time.Duration) {
+	c.rdb.WithContext(ctx).Set(key, total, ttl)
+}
@@ -0,0 +1,320 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"gin-layout/internal/pkg/cache"
+	"gin-layout/internal/pkg/encrypt"
+	"gin-layout/internal/pkg/page"
+	"gin-layout/internal/pkg/softdelete"
+	"gin-layout/internal/pkg/tenant"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// DefaultBatchSize CreateInBatches未指定批次大小时使用
+const DefaultBatchSize = 100
+
+// DomainModel gorm模型, 可以转换为biz层的领域对象
+type DomainModel[D any] interface {
+	ToDomain() D
+}
+
+// Repo 通用仓储, M为gorm模型的指针类型, D为领域对象
+// 所有操作都通过Data.DB(ctx)获取连接, 在InTx中调用时自动使用事务
+//
+//	type ucUserRepo struct {
+//		*Repo[*model.UcUser, *biz.UcUser]
+//	}
+//
+//	repo := &ucUserRepo{Repo: NewRepo[*model.UcUser, *biz.UcUser](data)}
+type Repo[M DomainModel[D], D any] struct {
+	data   *Data
+	table  string         // 不为空时开启按主键的读缓存, 为缓存key的一部分
+	schema *schema.Schema // 开启缓存时解析的模型, 加密字段以密文写入缓存
+}
+
+// NewRepo .
+func NewRepo[M DomainModel[D], D any](data *Data) *Repo[M, D] {
+	return &Repo[M, D]{data: data}
+}
+
+// WithCache 开启按主键的读缓存, GetCached读取缓存, Repo的写操作会删除对应主键的缓存;
+// 不通过Repo的写操作需要调用Forget; serializer:encrypt的字段在缓存中保存密文
+//
+//	repo := &ucUserRepo{Repo: NewRepo[*model.UcUser, *biz.UcUser](data).WithCache()}
+func (r *Repo[M, D]) WithCache() *Repo[M, D] {
+	stmt := &gorm.Statement{DB: r.data.db}
+	if err := stmt.Parse(r.newModel()); err != nil {
+		panic(fmt.Sprintf("data: parse model %T: %v", r.newModel(), err))
+	}
+	return &Repo[M, D]{data: r.data, table: stmt.Table, schema: stmt.Schema}
+}
+
+// DB 获取绑定了模型的连接, 用于Repo没有覆盖的查询
+func (r *Repo[M, D]) DB(ctx context.Context) *gorm.DB {
+	return r.data.DB(ctx).Model(r.newModel())
+}
+
+// Get 按主键查询, 不存在时返回gorm.ErrRecordNotFound
+func (r *Repo[M, D]) Get(ctx context.Context, id uint64) (d D, err error) {
+	m := r.newModel()
+	if err = r.data.DB(ctx).Take(m, id).Error; err != nil {
+		return d, errors.WithStack(err)
+	}
+	return m.ToDomain(), nil
+}
+
+// GetCached 按主键查询, 优先读取缓存, 不存在时返回gorm.ErrRecordNotFound并缓存空值
+// 未开启缓存或在事务中时直接查询数据库, 避免未提交的数据进入缓存
+// 按租户隔离的模型缓存时不区分租户, 读取后检查是否属于当前租户
+func (r *Repo[M, D]) GetCached(ctx context.Context, id uint64) (d D, err error) {
+	if r.table == "" || r.data.inTx(ctx) {
+		return r.Get(ctx, id)
+	}
+	m, err := cache.Fetch(ctx, r.data.cache, r.cacheKey(id), func(ctx context.Context) (M, error) {
+		m := r.newModel()
+		if err := r.data.DB(tenant.Bypass(ctx)).Take(m, id).Error; err != nil {
+			return m, errors.WithStack(err)
+		}
+		return m, encrypt.Seal(ctx, r.schema, m)
+	})
+	if err != nil {
+		return d, err
+	}
+	// 未命中时并发的调用共用load返回的值, 解密到副本
+	m = r.clone(m)
+	if err = encrypt.Open(ctx, r.schema, m); err != nil {
+		// 升级前写入的明文缓存或密钥已删除, 删除缓存后查询数据库
+		r.Forget(ctx, id)
+		return r.Get(ctx, id)
+	}
+	if err = tenant.Check(ctx, m); err != nil {
+		return d, err
+	}
+	return m.ToDomain(), nil
+}
+
+// Forget 删除主键对应的缓存, 用于不通过Repo的写操作
+func (r *Repo[M, D]) Forget(ctx context.Context, ids ...uint64) {
+	if r.table == "" || len(ids) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, r.cacheKey(id))
+	}
+	r.data.InvalidateCache(ctx, keys...)
+}
+
+// GetMany 按主键批量查询, 不存在的主键会被忽略, 结果不保证与ids的顺序一致
+func (r *Repo[M, D]) GetMany(ctx context.Context, ids []uint64) ([]D, error) {
+	list := make([]M, 0, len(ids))
+	if len(ids) > 0 {
+		if err := r.data.DB(ctx).Find(&list, ids).Error; err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return toDomains[M, D](list), nil
+}
+
+// Count 统计数量, scopes为查询条件
+func (r *Repo[M, D]) Count(ctx context.Context, scopes ...func(*gorm.DB) *gorm.DB) (int64, error) {
+	var num int64
+	err := r.DB(ctx).Scopes(scopes...).Count(&num).Error
+	return num, errors.WithStack(err)
+}
+
+// Create 创建, 自增主键会回写到m
+func (r *Repo[M, D]) Create(ctx context.Context, m M) error {
+	res := r.data.DB(ctx).Create(m)
+	if res.Error != nil {
+		return errors.WithStack(res.Error)
+	}
+	// 主键可能被缓存了空值
+	r.Forget(ctx, primaryKeys(res)...)
+	return nil
+}
+
+// CreateInBatches 分批创建, batchSize<=0时使用DefaultBatchSize
+func (r *Repo[M, D]) CreateInBatches(ctx context.Context, list []M, batchSize int) error {
+	if len(list) == 0 {
+		return nil
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	res := r.data.DB(ctx).CreateInBatches(list, batchSize)
+	if res.Error != nil {
+		return errors.WithStack(res.Error)
+	}
+	r.Forget(ctx, primaryKeys(res)...)
+	return nil
+}
+
+// Update 按m的主键更新, fields为需要更新的字段(字段名或列名), 可以把字段更新为零值;
+// fields为空时只更新非零值字段. 返回受影响的行数
+//
+//	repo.Update(ctx, &model.UcUser{Model: model.Model{ID: 1}, Name: ""}, "name")
+func (r *Repo[M, D]) Update(ctx context.Context, m M, fields ...string) (int64, error) {
+	db := r.data.DB(ctx).Model(m)
+	if len(fields) > 0 {
+		db = db.Select(fields)
+	}
+	// 主键为零值时gorm没有where条件, 会返回ErrMissingWhereClause, 不会更新整张表
+	res := db.Updates(m)
+	if res.Error != nil {
+		return 0, errors.WithStack(res.Error)
+	}
+	r.Forget(ctx, primaryKeys(res)...)
+	return res.RowsAffected, nil
+}
+
+// Upsert 插入, 主键或唯一索引冲突时更新columns(列名), columns为空时更新所有字段
+// mysql生成 INSERT ... ON DUPLICATE KEY UPDATE
+// 开启缓存时只能删除list中有主键的缓存, 按唯一索引冲突更新的数据需要调用方自行Forget
+func (r *Repo[M, D]) Upsert(ctx context.Context, list []M, columns ...string) error {
+	if len(list) == 0 {
+		return nil
+	}
+	conflict := clause.OnConflict{UpdateAll: true}
+	if len(columns) > 0 {
+		conflict = clause.OnConflict{DoUpdates: clause.AssignmentColumns(columns)}
+	}
+	res := r.data.DB(ctx).Clauses(conflict).Create(list)
+	if res.Error != nil {
+		return errors.WithStack(res.Error)
+	}
+	r.Forget(ctx, primaryKeys(res)...)
+	return nil
+}
+
+// Delete 按主键删除, 返回受影响的行数. 模型有softdelete.Flag字段时为软删除
+func (r *Repo[M, D]) Delete(ctx context.Context, ids ...uint64) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	res := r.data.DB(ctx).Delete(r.newModel(), ids)
+	if res.Error != nil {
+		return 0, errors.WithStack(res.Error)
+	}
+	r.Forget(ctx, ids...)
+	return res.RowsAffected, nil
+}
+
+// List 分页查询, scopes为筛选和排序条件
+// scopes会立即执行而不是交给gorm延迟执行, 因为page需要在查询前读取排序
+func (r *Repo[M, D]) List(ctx context.Context, p *page.Page, scopes ...func(*gorm.DB) *gorm.DB) (*page.Result[D], error) {
+	db := r.DB(ctx)
+	for _, scope := range scopes {
+		db = scope(db)
+	}
+	res, err := page.Find[M](p.WithContext(ctx), db)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return page.Map(res, func(m M) D { return m.ToDomain() }), nil
+}
+
+// Trash 分页查询已软删除的数据(回收站)
+func (r *Repo[M, D]) Trash(ctx context.Context, p *page.Page, scopes ...func(*gorm.DB) *gorm.DB) (*page.Result[D], error) {
+	return r.List(ctx, p, append([]func(*gorm.DB) *gorm.DB{softdelete.OnlyTrashed}, scopes...)...)
+}
+
+// Restore 按主键恢复已软删除的数据, 返回恢复的行数
+func (r *Repo[M, D]) Restore(ctx context.Context, ids ...uint64) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	res := softdelete.Restore(r.DB(ctx).Where(ids))
+	if res.Error != nil {
+		return 0, errors.WithStack(res.Error)
+	}
+	r.Forget(ctx, ids...)
+	return res.RowsAffected, nil
+}
+
+// Purge 物理删除 deleted_at 早于before的已软删除数据, 每批最多batchSize条, 返回删除的总数
+func (r *Repo[M, D]) Purge(ctx context.Context, before time.Time, batchSize int) (int64, error) {
+	return purgeInBatches(ctx, r.DB, before, batchSize)
+}
+
+// purgeInBatches 按批次物理删除db(ctx)绑定的模型中早于before的软删除数据, 直到不足一批或ctx结束
+func purgeInBatches(ctx context.Context, db func(ctx context.Context) *gorm.DB, before time.Time, batchSize int) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	var total int64
+	for {
+		n, err := softdelete.Purge(db(ctx), before, batchSize)
+		total += n
+		if err != nil || n < int64(batchSize) {
+			return total, errors.WithStack(err)
+		}
+		if err = ctx.Err(); err != nil {
+			return total, errors.WithStack(err)
+		}
+	}
+}
+
+// newModel 创建M指向的零值, 用于Take/Delete等需要模型实例的操作
+func (r *Repo[M, D]) newModel() M {
+	var m M
+	t := reflect.TypeOf(m)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return m
+	}
+	return reflect.New(t.Elem()).Interface().(M)
+}
+
+// clone 浅拷贝m指向的模型
+func (r *Repo[M, D]) clone(m M) M {
+	c := r.newModel()
+	reflect.ValueOf(c).Elem().Set(reflect.ValueOf(m).Elem())
+	return c
+}
+
+// cacheKey 表名:连接名:id, 表名在第一段用于匹配缓存的family, 不同数据库中的同名表不共用缓存
+func (r *Repo[M, D]) cacheKey(id uint64) string {
+	return r.data.cache.Key(r.table, r.data.name, id)
+}
+
+// primaryKeys 读取写操作后模型的主键, 用于删除缓存
+func primaryKeys(db *gorm.DB) []uint64 {
+	stmt := db.Statement
+	if stmt.Schema == nil || stmt.Schema.PrioritizedPrimaryField == nil {
+		return nil
+	}
+	field := stmt.Schema.PrioritizedPrimaryField
+	ids := make([]uint64, 0)
+	add := func(rv reflect.Value) {
+		if v, zero := field.ValueOf(stmt.Context, rv); !zero {
+			if id, ok := v.(uint64); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	rv := reflect.Indirect(stmt.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			add(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		add(rv)
+	}
+	return ids
+}
+
+func toDomains[M DomainModel[D], D any](list []M) []D {
+	res := make([]D, 0, len(list))
+	for _, m := range list {
+		res = append(res, m.ToDomain())
+	}
+	return res
+}
@@ -0,0 +1,72 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"gin-layout/internal/conf"
+	"gin-layout/internal/data/model"
+	"gin-layout/internal/pkg/cron"
+	"gin-layout/internal/pkg/tenant"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	logs "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// trashModels 需要定期清理软删除数据的模型
+var trashModels = []any{
+	&model.UcUser{},
+}
+
+// TaskPurgeTrash 清理软删除数据的定时任务名称
+const TaskPurgeTrash = "purge_trash"
+
+// purgeTrashTask 物理删除超过保留天数的软删除数据, 没有配置保留天数时返回false
+func (d *Data) purgeTrashTask(c *conf.SoftDeleteConf) (cron.Task, bool) {
+	if c == nil || c.RetentionDays <= 0 {
+		return cron.Task{}, false
+	}
+	spec := c.PurgeCron
+	if spec == "" {
+		interval := c.PurgeIntervalMinutes
+		if interval <= 0 {
+			interval = 60
+		}
+		spec = fmt.Sprintf("@every %dm", interval)
+	}
+	batchSize := c.PurgeBatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	retention := time.Duration(c.RetentionDays) * 24 * time.Hour
+	return cron.Task{
+		Name: TaskPurgeTrash,
+		Spec: spec,
+		Run: func(ctx context.Context) error {
+			// 清理所有租户的数据
+			return d.purgeTrashOnce(tenant.Bypass(ctx), time.Now().Add(-retention), batchSize)
+		},
+	}, true
+}
+
+func (d *Data) purgeTrashOnce(ctx context.Context, before time.Time, batchSize int) error {
+	logger, _ := ctx.Value("logger").(*logs.Entry)
+	var errs []string
+	for _, m := range trashModels {
+		total, err := purgeInBatches(ctx, func(ctx context.Context) *gorm.DB {
+			return d.DB(ctx).Model(m)
+		}, before, batchSize)
+		if total > 0 && logger != nil {
+			logger.Infof("purge %T: %d rows deleted before %s", m, total, before.Format("2006-01-02 15:04:05"))
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("purge %T: %v", m, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
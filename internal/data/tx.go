@@ -0,0 +1,177 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"gin-layout/internal/biz"
+	"math/rand"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"github.com/pkg/errors"
+	logs "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultTxRetries 事务因死锁、锁等待超时失败时的重试次数
+	DefaultTxRetries = 3
+
+	txRetryBackoff    = 50 * time.Millisecond
+	txRetryMaxBackoff = time.Second
+)
+
+// 用来承载事务的上下文, 每个连接的事务相互独立
+type contextTxKey struct {
+	name string
+}
+
+// 事务提交或回滚后执行的函数, 每个连接的事务相互独立
+type contextTxHooksKey struct {
+	name string
+}
+
+type txHooks struct {
+	commit   []func(ctx context.Context)
+	rollback []func(ctx context.Context)
+}
+
+func (h *txHooks) run(ctx context.Context, committed bool) {
+	fns := h.rollback
+	if committed {
+		fns = h.commit
+	}
+	for _, fn := range fns {
+		fn(ctx)
+	}
+}
+
+// InTx Transaction, 只对当前连接生效, 提交后执行事务中注册的OnCommit, 回滚后执行OnRollback
+func (d *Data) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return d.InTxWithOptions(ctx, nil, fn)
+}
+
+// InTxWithOptions 按选项开启事务, 已经在事务中时使用savepoint, fn返回错误只回滚到savepoint;
+// 死锁和锁等待超时时回滚后重试整个事务, fn可能被执行多次
+// savepoint不能设置隔离级别和只读, 嵌套时设置了返回错误, Retries被忽略
+func (d *Data) InTxWithOptions(ctx context.Context, opts *biz.TxOptions, fn func(ctx context.Context) error) error {
+	if parent, ok := ctx.Value(contextTxKey{name: d.name}).(*gorm.DB); ok {
+		if opts != nil && (opts.Isolation != sql.LevelDefault || opts.ReadOnly) {
+			return errors.New("isolation and read only can not be set on a nested transaction")
+		}
+		return d.savepoint(ctx, parent, fn)
+	}
+	if opts == nil {
+		opts = &biz.TxOptions{}
+	}
+	retries := opts.Retries
+	if retries == 0 {
+		retries = DefaultTxRetries
+	}
+	for attempt := 0; ; attempt++ {
+		err := d.transaction(ctx, opts, fn)
+		if err == nil || attempt >= retries || !retryableTxError(err) {
+			return err
+		}
+		backoff := txBackoff(attempt)
+		if logger, ok := ctx.Value("logger").(*logs.Entry); ok {
+			logger.Warnf("transaction retry %d after %v: %v", attempt+1, backoff, err)
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// InTxNamed 在指定名称的连接上开启事务
+func (d *Data) InTxNamed(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	return d.Named(name).InTx(ctx, fn)
+}
+
+// transaction 开启最外层的事务, 从DB(ctx)开始, 事务中的SQL使用请求的logger
+func (d *Data) transaction(ctx context.Context, opts *biz.TxOptions, fn func(ctx context.Context) error) error {
+	var txOpts []*sql.TxOptions
+	if opts.Isolation != sql.LevelDefault || opts.ReadOnly {
+		txOpts = append(txOpts, &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly})
+	}
+	hooks := &txHooks{}
+	err := d.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(d.withTx(ctx, tx, hooks))
+	}, txOpts...)
+	hooks.run(ctx, err == nil)
+	return err
+}
+
+// savepoint 嵌套的事务, 成功后注册的函数交给外层事务, 由最外层的事务结束后执行;
+// 回滚到savepoint时立即执行其中注册的OnRollback, OnCommit被丢弃
+func (d *Data) savepoint(ctx context.Context, parent *gorm.DB, fn func(ctx context.Context) error) error {
+	hooks := &txHooks{}
+	err := parent.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(d.withTx(ctx, tx, hooks))
+	})
+	if err != nil {
+		hooks.run(ctx, false)
+		return err
+	}
+	if parentHooks, ok := ctx.Value(contextTxHooksKey{name: d.name}).(*txHooks); ok {
+		parentHooks.commit = append(parentHooks.commit, hooks.commit...)
+		parentHooks.rollback = append(parentHooks.rollback, hooks.rollback...)
+	}
+	return nil
+}
+
+func (d *Data) withTx(ctx context.Context, tx *gorm.DB, hooks *txHooks) context.Context {
+	ctx = context.WithValue(ctx, contextTxKey{name: d.name}, tx)
+	return context.WithValue(ctx, contextTxHooksKey{name: d.name}, hooks)
+}
+
+// inTx 当前连接是否在事务中
+func (d *Data) inTx(ctx context.Context) bool {
+	_, ok := ctx.Value(contextTxKey{name: d.name}).(*gorm.DB)
+	return ok
+}
+
+// OnCommit 最外层的事务提交后执行fn, 用于删除缓存、发布事件等, 回滚时不执行; 不在事务中时立即执行
+// fn的ctx不带事务
+func (d *Data) OnCommit(ctx context.Context, fn func(ctx context.Context)) {
+	if hooks, ok := ctx.Value(contextTxHooksKey{name: d.name}).(*txHooks); ok {
+		hooks.commit = append(hooks.commit, fn)
+		return
+	}
+	fn(ctx)
+}
+
+// OnRollback 事务回滚后执行fn, 在savepoint中注册时回滚到该savepoint后执行; 不在事务中时立即执行, 与OnCommit一致
+func (d *Data) OnRollback(ctx context.Context, fn func(ctx context.Context)) {
+	if hooks, ok := ctx.Value(contextTxHooksKey{name: d.name}).(*txHooks); ok {
+		hooks.rollback = append(hooks.rollback, fn)
+		return
+	}
+	fn(ctx)
+}
+
+// retryableTxError 重试后可能成功的错误
+// mysql: 1213死锁, 1205锁等待超时; postgres: 40001序列化失败, 40P01死锁
+func retryableTxError(err error) bool {
+	var me *mysql.MySQLError
+	if errors.As(err, &me) {
+		return me.Number == 1213 || me.Number == 1205
+	}
+	var pe *pgconn.PgError
+	if errors.As(err, &pe) {
+		return pe.Code == "40001" || pe.Code == "40P01"
+	}
+	return false
+}
+
+// txBackoff 指数退避加随机抖动, 避免冲突的事务同时重试
+func txBackoff(attempt int) time.Duration {
+	backoff := txRetryBackoff << attempt
+	if backoff > txRetryMaxBackoff {
+		backoff = txRetryMaxBackoff
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
@@ -0,0 +1,268 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gin-layout/internal/biz"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	logs "github.com/sirupsen/logrus"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type txRow struct {
+	ID   uint64 `gorm:"primaryKey"`
+	Name string
+}
+
+func openTxTestData(t *testing.T) (*Data, context.Context) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	// 每个连接是独立的内存数据库, 只使用一个连接
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err = db.AutoMigrate(&txRow{}); err != nil {
+		t.Fatal(err)
+	}
+	l := logs.New()
+	l.SetOutput(io.Discard)
+	d := &Data{name: DefaultDB, dbs: DBs{DefaultDB: db}, db: db}
+	return d, context.WithValue(context.Background(), "logger", logs.NewEntry(l))
+}
+
+func txRowNames(t *testing.T, d *Data, ctx context.Context) []string {
+	t.Helper()
+	var names []string
+	if err := d.DB(ctx).Model(&txRow{}).Order("id").Pluck("name", &names).Error; err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+// record 记录钩子的执行顺序
+type record []string
+
+func (r *record) hook(name string) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		*r = append(*r, name)
+	}
+}
+
+func TestInTxSavepoint(t *testing.T) {
+	errInner := errors.New("inner")
+	cases := []struct {
+		name      string
+		innerErr  error
+		outerErr  error
+		wantErr   error
+		wantRows  []string
+		wantHooks []string
+	}{
+		{
+			name:      "both commit",
+			wantRows:  []string{"outer", "inner", "after"},
+			wantHooks: []string{"outer commit", "inner commit"},
+		},
+		{
+			// 只回滚到savepoint, 内层的OnRollback立即执行, OnCommit被丢弃
+			name:      "inner rollback",
+			innerErr:  errInner,
+			wantRows:  []string{"outer", "after"},
+			wantHooks: []string{"inner rollback", "outer commit"},
+		},
+		{
+			// 内层成功后注册的钩子交给外层, 随外层一起回滚
+			name:      "outer rollback",
+			outerErr:  errInner,
+			wantErr:   errInner,
+			wantHooks: []string{"outer rollback", "inner rollback"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d, ctx := openTxTestData(t)
+			var hooks record
+			err := d.InTx(ctx, func(ctx context.Context) error {
+				d.OnCommit(ctx, hooks.hook("outer commit"))
+				d.OnRollback(ctx, hooks.hook("outer rollback"))
+				if err := d.DB(ctx).Create(&txRow{Name: "outer"}).Error; err != nil {
+					return err
+				}
+				err := d.InTx(ctx, func(ctx context.Context) error {
+					d.OnCommit(ctx, hooks.hook("inner commit"))
+					d.OnRollback(ctx, hooks.hook("inner rollback"))
+					if err := d.DB(ctx).Create(&txRow{Name: "inner"}).Error; err != nil {
+						return err
+					}
+					return c.innerErr
+				})
+				if !errors.Is(err, c.innerErr) {
+					t.Errorf("inner got %v, want %v", err, c.innerErr)
+				}
+				// 钩子在最外层结束前不执行, 回滚到savepoint的除外
+				if c.innerErr == nil && len(hooks) != 0 {
+					t.Errorf("hooks run before outer tx ends: %v", hooks)
+				}
+				if err := d.DB(ctx).Create(&txRow{Name: "after"}).Error; err != nil {
+					return err
+				}
+				return c.outerErr
+			})
+			if !errors.Is(err, c.wantErr) {
+				t.Fatalf("got %v, want %v", err, c.wantErr)
+			}
+			if got := txRowNames(t, d, ctx); fmt.Sprint(got) != fmt.Sprint(c.wantRows) {
+				t.Errorf("rows got %v, want %v", got, c.wantRows)
+			}
+			if !reflect.DeepEqual([]string(hooks), c.wantHooks) {
+				t.Errorf("hooks got %v, want %v", hooks, c.wantHooks)
+			}
+		})
+	}
+}
+
+func TestInTxRetry(t *testing.T) {
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}
+	cases := []struct {
+		name      string
+		errs      []error // 每次执行fn返回的错误, 超出时返回nil
+		retries   int
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "mysql deadlock", errs: []error{deadlock, deadlock}, wantCalls: 3},
+		{name: "mysql lock wait timeout", errs: []error{&mysql.MySQLError{Number: 1205}}, wantCalls: 2},
+		{name: "postgres serialization", errs: []error{&pgconn.PgError{Code: "40001"}}, wantCalls: 2},
+		{name: "wrapped", errs: []error{fmt.Errorf("create: %w", deadlock)}, wantCalls: 2},
+		{name: "not retryable", errs: []error{&mysql.MySQLError{Number: 1062}}, wantCalls: 1, wantErr: &mysql.MySQLError{Number: 1062}},
+		{name: "retries exhausted", errs: []error{deadlock, deadlock}, retries: 1, wantCalls: 2, wantErr: deadlock},
+		{name: "retry disabled", errs: []error{deadlock}, retries: -1, wantCalls: 1, wantErr: deadlock},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d, ctx := openTxTestData(t)
+			var hooks record
+			calls := 0
+			err := d.InTxWithOptions(ctx, &biz.TxOptions{Retries: c.retries}, func(ctx context.Context) error {
+				calls++
+				d.OnCommit(ctx, hooks.hook(fmt.Sprintf("commit %d", calls)))
+				d.OnRollback(ctx, hooks.hook(fmt.Sprintf("rollback %d", calls)))
+				if err := d.DB(ctx).Create(&txRow{Name: fmt.Sprint(calls)}).Error; err != nil {
+					return err
+				}
+				if calls <= len(c.errs) {
+					return c.errs[calls-1]
+				}
+				return nil
+			})
+			if fmt.Sprint(err) != fmt.Sprint(c.wantErr) {
+				t.Fatalf("got %v, want %v", err, c.wantErr)
+			}
+			if calls != c.wantCalls {
+				t.Fatalf("fn called %d times, want %d", calls, c.wantCalls)
+			}
+			// 失败的尝试都已回滚, 只有最后一次成功的尝试写入数据并执行OnCommit
+			var wantRows, wantHooks []string
+			for i := 1; i <= calls; i++ {
+				if i == calls && err == nil {
+					wantRows = append(wantRows, fmt.Sprint(i))
+					wantHooks = append(wantHooks, fmt.Sprintf("commit %d", i))
+				} else {
+					wantHooks = append(wantHooks, fmt.Sprintf("rollback %d", i))
+				}
+			}
+			if got := txRowNames(t, d, ctx); fmt.Sprint(got) != fmt.Sprint(wantRows) {
+				t.Errorf("rows got %v, want %v", got, wantRows)
+			}
+			if !reflect.DeepEqual([]string(hooks), wantHooks) {
+				t.Errorf("hooks got %v, want %v", hooks, wantHooks)
+			}
+		})
+	}
+}
+
+func TestInTxSavepointNotRetried(t *testing.T) {
+	d, ctx := openTxTestData(t)
+	calls := 0
+	deadlock := &mysql.MySQLError{Number: 1213}
+	err := d.InTx(ctx, func(ctx context.Context) error {
+		err := d.InTx(ctx, func(ctx context.Context) error {
+			calls++
+			return deadlock
+		})
+		if !errors.Is(err, deadlock) {
+			t.Errorf("got %v, want %v", err, deadlock)
+		}
+		return nil
+	})
+	// savepoint失败时只回滚到savepoint, 由外层决定是否重试整个事务
+	if err != nil || calls != 1 {
+		t.Fatalf("got err %v, calls %d", err, calls)
+	}
+}
+
+func TestOnCommitOutsideTx(t *testing.T) {
+	d, ctx := openTxTestData(t)
+	var hooks record
+	d.OnCommit(ctx, hooks.hook("commit"))
+	d.OnRollback(ctx, hooks.hook("rollback"))
+	if !reflect.DeepEqual([]string(hooks), []string{"commit", "rollback"}) {
+		t.Fatalf("got %v", hooks)
+	}
+}
+
+func TestNestedTxOptions(t *testing.T) {
+	d, ctx := openTxTestData(t)
+	calls := 0
+	err := d.InTx(ctx, func(ctx context.Context) error {
+		if err := d.InTxWithOptions(ctx, &biz.TxOptions{ReadOnly: true}, func(ctx context.Context) error {
+			calls++
+			return nil
+		}); err == nil {
+			t.Error("want error for read only savepoint")
+		}
+		return d.InTxWithOptions(ctx, &biz.TxOptions{Retries: 1}, func(ctx context.Context) error {
+			calls++
+			return nil
+		})
+	})
+	if err != nil || calls != 1 {
+		t.Fatalf("got err %v, calls %d", err, calls)
+	}
+}
+
+func TestOnCommitCtxWithoutTx(t *testing.T) {
+	d, ctx := openTxTestData(t)
+	var inTx []bool
+	err := d.InTx(ctx, func(ctx context.Context) error {
+		d.OnCommit(ctx, func(ctx context.Context) {
+			inTx = append(inTx, d.inTx(ctx))
+			// 钩子中的写操作在事务外执行, 不会被单连接的事务阻塞
+			if err := d.DB(ctx).Create(&txRow{Name: "hook"}).Error; err != nil {
+				t.Error(err)
+			}
+		})
+		inTx = append(inTx, d.inTx(ctx))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(inTx, []bool{true, false}) {
+		t.Fatalf("got %v", inTx)
+	}
+	if got := txRowNames(t, d, ctx); !reflect.DeepEqual(got, []string{"hook"}) {
+		t.Fatalf("got %v", got)
+	}
+}
@@ -2,60 +2,64 @@ package data
 
 import (
 	"context"
-	"fmt"
 	"gin-layout/internal/biz"
 	"gin-layout/internal/data/model"
+	"gin-layout/internal/pkg/encrypt"
+	"gin-layout/internal/pkg/page"
 	"github.com/pkg/errors"
-	"golang.org/x/sync/singleflight"
 )
 
 type ucUserRepo struct {
+	*Repo[*model.UcUser, *biz.UcUser]
 	data *Data
-	sg   *singleflight.Group
 }
 
 func NewUcUserRepo(data *Data) biz.IUcUserRepo {
 	return &ucUserRepo{
+		Repo: NewRepo[*model.UcUser, *biz.UcUser](data).WithCache(),
 		data: data,
-		sg:   &singleflight.Group{},
 	}
 }
 
 func (r *ucUserRepo) CreateUcUser(ctx context.Context, user *biz.UcUser) error {
 	var u model.UcUser
-	u.Name = user.Name
+	u.Name, u.Phone, u.IdCard = user.Name, user.Phone, user.IdCard
 
-	if err := errors.WithStack(r.data.DB(ctx).Save(&u).Error); err != nil {
+	if err := r.Create(ctx, &u); err != nil {
 		return err
 	}
+	user.Id = u.ID
 	return nil
 }
 
 func (r *ucUserRepo) GetUcUserById(ctx context.Context, id uint64) (*biz.UcUser, error) {
-	res, err, _ := r.sg.Do(fmt.Sprintf("GetUcUserById_%d", id), func() (any, error) {
-		var c model.UcUser
-		if err := errors.WithStack(r.data.DB(ctx).Where("id = ?", id).Take(&c).Error); err != nil {
-			return nil, err
-		}
-		return &c, nil
-	})
-	if err != nil {
-		return nil, err
+	return r.GetCached(ctx, id)
+}
+
+// GetUcUserByPhone phone为加密字段, 按盲索引查询
+func (r *ucUserRepo) GetUcUserByPhone(ctx context.Context, phone string) (*biz.UcUser, error) {
+	var u model.UcUser
+	if err := r.DB(ctx).Scopes(encrypt.Eq("phone", phone)).Take(&u).Error; err != nil {
+		return nil, errors.WithStack(err)
 	}
-	return res.(*model.UcUser).ToDomain(), nil
+	return u.ToDomain(), nil
 }
 
 func (r *ucUserRepo) GetUcUserNum(ctx context.Context) (int, error) {
-	var num int64
-	err := errors.WithStack(r.data.DB(ctx).Model(&model.UcUser{}).Count(&num).Error)
+	num, err := r.Count(ctx)
 	return int(num), err
 }
 
 func (r *ucUserRepo) SaveUcUserSerialNumber(ctx context.Context, user *biz.UcUser) error {
-	return errors.WithStack(r.data.DB(ctx).Model(&model.UcUser{}).
+	err := r.data.DB(ctx).Model(&model.UcUser{}).
 		Where("id = ?", user.Id).
 		Update("serial_number", user.SerialNumber).
-		Error)
+		Error
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	r.Forget(ctx, user.Id)
+	return nil
 }
 
 func (r *ucUserRepo) GetUcUserMaxId(ctx context.Context) (uint64, error) {
@@ -66,29 +70,28 @@ func (r *ucUserRepo) GetUcUserMaxId(ctx context.Context) (uint64, error) {
 	return user.ID, err
 }
 
-func (r *ucUserRepo) UserList(ctx context.Context, condition *biz.ListTestRep) (res []*biz.UcUser, err error) {
-	roles := make([]*model.UcUser, 0)
-	db := r.data.DB(ctx)
-	db = db.Model(&model.UcUser{}).Order("id DESC")
-	// 条件筛选
-	if condition.Id > 0 {
-		db = db.Where("id = ?", condition.Id)
-	}
-	if len(condition.Name) > 0 {
-		db = db.Where("name LIKE ?", fmt.Sprintf("%%%s%%", condition.Name))
-	}
+// GetUcUserTenantIds 有数据的租户, ctx需要通过tenant.Bypass跳过租户条件
+func (r *ucUserRepo) GetUcUserTenantIds(ctx context.Context) ([]string, error) {
+	var ids []string
+	err := r.data.DB(ctx).Model(&model.UcUser{}).Distinct("tenant_id").Pluck("tenant_id", &ids).Error
+	return ids, errors.WithStack(err)
+}
 
-	err = errors.WithStack(condition.Page.
-		WithContext(ctx).
-		Query(db).
-		Find(&roles),
-	)
-	if err != nil {
-		return
-	}
-	res = make([]*biz.UcUser, 0)
-	for _, v := range roles {
-		res = append(res, v.ToDomain())
-	}
-	return
+func (r *ucUserRepo) UserList(ctx context.Context, condition *biz.ListTestRep) (*page.Result[*biz.UcUser], error) {
+	// count和查询数据并发执行
+	condition.Page.CountStrategy = page.CountConcurrent
+	// 条件筛选和排序
+	return r.List(ctx, condition.Page, condition.Query.Apply)
+}
+
+func (r *ucUserRepo) DeleteUcUser(ctx context.Context, ids ...uint64) (int64, error) {
+	return r.Delete(ctx, ids...)
+}
+
+func (r *ucUserRepo) TrashUserList(ctx context.Context, condition *biz.ListTestRep) (*page.Result[*biz.UcUser], error) {
+	return r.Trash(ctx, condition.Page, condition.Query.Apply)
+}
+
+func (r *ucUserRepo) RestoreUcUser(ctx context.Context, ids ...uint64) (int64, error) {
+	return r.Restore(ctx, ids...)
 }
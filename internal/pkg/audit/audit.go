@@ -0,0 +1,53 @@
+package audit
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+
+	// loginUserKey requestIdKey gin.Context中登录用户id和请求id的key, 没有通过WithUser指定时使用
+	loginUserKey = "login_user_id"
+	requestIdKey = "request_id"
+)
+
+// Log audit_logs表中的一条记录, 每条数据的每次变更一条
+type Log struct {
+	ID        uint64    `gorm:"primaryKey"`
+	Entity    string    `gorm:"column:entity"`     // 表名
+	EntityID  string    `gorm:"column:entity_id"`  // 主键, 联合主键以逗号分隔
+	Action    string    `gorm:"column:action"`     // ActionCreate/ActionUpdate/ActionDelete
+	OldValues string    `gorm:"column:old_values"` // 变更前的值, json; 更新时只包含变化的字段, 创建时为空
+	NewValues string    `gorm:"column:new_values"` // 变更后的值, json; 更新时只包含变化的字段, 删除时为空
+	UserID    uint64    `gorm:"column:user_id"`    // 操作人
+	RequestID string    `gorm:"column:request_id"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+}
+
+func (*Log) TableName() string {
+	return "audit_logs"
+}
+
+type userKey struct{}
+
+// WithUser 指定操作人, 不指定时使用gin.Context中的login_user_id, 用于任务等非请求的场景
+func WithUser(ctx context.Context, userId uint64) context.Context {
+	return context.WithValue(ctx, userKey{}, userId)
+}
+
+func user(ctx context.Context) uint64 {
+	if id, ok := ctx.Value(userKey{}).(uint64); ok {
+		return id
+	}
+	id, _ := ctx.Value(loginUserKey).(uint64)
+	return id
+}
+
+func requestId(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey).(string)
+	return id
+}
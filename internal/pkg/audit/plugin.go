@@ -0,0 +1,387 @@
+package audit
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"gin-layout/internal/pkg/dbresolver"
+	"reflect"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	// DefaultMaxRows 一次更新/删除最多记录的行数
+	DefaultMaxRows = 1000
+
+	// RedactedValue audit:"redact" 字段记录的值
+	RedactedValue = "******"
+
+	snapshotKey = "audit:snapshot"
+	startedKey  = "audit:started_transaction"
+	batchSize   = 200
+)
+
+// ErrTooManyRows 一次更新/删除的行数超过MaxRows, 操作不会执行
+var ErrTooManyRows = errors.New("audit: too many rows")
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// Plugin gorm插件, 记录模型的创建、更新、删除到audit_logs表
+// 审计日志使用业务语句的事务写入, 与业务数据一起提交或回滚, 业务语句不在事务中时由插件开启事务; 写入失败时业务语句返回错误
+// 更新和删除前先按相同的条件查出变更前的数据并加FOR UPDATE
+// 使用map创建、Raw/Exec执行的语句不会被记录; 字段tag为 audit:"-" 时不记录该字段(如密码),
+// 为 audit:"redact" 时记录是否变化, 值记录为RedactedValue(如加密字段)
+//
+//	db.Use(audit.New(0, &model.UcUser{}))
+type Plugin struct {
+	models  []any
+	maxRows int
+	tables  map[string]bool
+}
+
+// New models为需要审计的模型, maxRows<=0时使用DefaultMaxRows
+func New(maxRows int, models ...any) *Plugin {
+	if maxRows <= 0 {
+		maxRows = DefaultMaxRows
+	}
+	return &Plugin{models: models, maxRows: maxRows}
+}
+
+func (p *Plugin) Name() string {
+	return "audit"
+}
+
+func (p *Plugin) Initialize(db *gorm.DB) error {
+	p.tables = make(map[string]bool, len(p.models))
+	for _, m := range p.models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(m); err != nil {
+			return errors.WithStack(err)
+		}
+		p.tables[stmt.Schema.Table] = true
+	}
+	cb := db.Callback()
+	// 最先开启事务, 最后提交; SkipDefaultTransaction时gorm不注册默认事务的回调
+	if err := cb.Create().Before("*").Register("audit:begin_create", p.begin); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := cb.Create().After("*").Register("audit:end_create", p.end); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := cb.Update().Before("*").Register("audit:begin_update", p.begin); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := cb.Update().After("*").Register("audit:end_update", p.end); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := cb.Delete().Before("*").Register("audit:begin_delete", p.begin); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := cb.Delete().After("*").Register("audit:end_delete", p.end); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := cb.Create().After("gorm:create").Register("audit:after_create", p.afterCreate); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := cb.Update().Before("gorm:update").Register("audit:before_update", p.before); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := cb.Update().After("gorm:update").Register("audit:after_update", p.afterUpdate); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("audit:before_delete", p.before); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(cb.Delete().After("gorm:delete").Register("audit:after_delete", p.afterDelete))
+}
+
+func (p *Plugin) audited(db *gorm.DB) bool {
+	stmt := db.Statement
+	return db.Error == nil && !db.DryRun && stmt.Schema != nil && p.tables[stmt.Schema.Table]
+}
+
+// begin 审计的语句不在事务中时开启事务, 业务语句、变更前数据的锁和审计日志在同一个事务中
+func (p *Plugin) begin(db *gorm.DB) {
+	if !p.audited(db) {
+		return
+	}
+	if _, ok := db.Statement.ConnPool.(gorm.TxCommitter); ok {
+		return
+	}
+	tx := db.Begin()
+	if tx.Error != nil {
+		if !errors.Is(tx.Error, gorm.ErrInvalidTransaction) {
+			_ = db.AddError(errors.WithStack(tx.Error))
+		}
+		return
+	}
+	db.Statement.ConnPool = tx.Statement.ConnPool
+	db.InstanceSet(startedKey, true)
+}
+
+// end 提交或回滚begin开启的事务
+func (p *Plugin) end(db *gorm.DB) {
+	if _, ok := db.InstanceGet(startedKey); !ok {
+		return
+	}
+	if db.Error != nil {
+		db.Rollback()
+	} else {
+		db.Commit()
+	}
+	db.Statement.ConnPool = db.ConnPool
+}
+
+func (p *Plugin) afterCreate(db *gorm.DB) {
+	if !p.audited(db) || db.RowsAffected == 0 {
+		return
+	}
+	stmt := db.Statement
+	list := make([]*Log, 0, 1)
+	eachRow(stmt.ReflectValue, func(rv reflect.Value) {
+		list = append(list, &Log{
+			EntityID:  entityId(stmt, rv),
+			Action:    ActionCreate,
+			NewValues: toJSON(stmt, values(stmt, rv)),
+		})
+	})
+	p.write(db, list)
+}
+
+// before 更新/删除前查出变更前的数据
+func (p *Plugin) before(db *gorm.DB) {
+	if !p.audited(db) {
+		return
+	}
+	stmt := db.Statement
+	where := primaryKeyConditions(stmt)
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if w, ok := c.Expression.(clause.Where); ok {
+			where = append(where, w.Exprs...)
+		}
+	}
+	// 没有条件时gorm会返回ErrMissingWhereClause, 不需要查询
+	if len(where) == 0 && !stmt.AllowGlobalUpdate {
+		return
+	}
+	tx := p.session(db).Table(stmt.Table)
+	if stmt.Unscoped {
+		tx = tx.Unscoped()
+	}
+	if len(where) > 0 {
+		tx = tx.Where(clause.Where{Exprs: where})
+	}
+	if _, ok := stmt.ConnPool.(gorm.TxCommitter); ok {
+		tx = tx.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	rows := reflect.New(reflect.SliceOf(stmt.Schema.ModelType))
+	if err := tx.Limit(p.maxRows + 1).Find(rows.Interface()).Error; err != nil {
+		_ = db.AddError(errors.WithStack(err))
+		return
+	}
+	if rows.Elem().Len() > p.maxRows {
+		_ = db.AddError(errors.Wrapf(ErrTooManyRows, "%s affects more than %d rows", stmt.Table, p.maxRows))
+		return
+	}
+	db.InstanceSet(snapshotKey, rows.Elem())
+}
+
+func (p *Plugin) snapshot(db *gorm.DB) (reflect.Value, bool) {
+	if !p.audited(db) || db.RowsAffected == 0 {
+		return reflect.Value{}, false
+	}
+	v, ok := db.InstanceGet(snapshotKey)
+	if !ok {
+		return reflect.Value{}, false
+	}
+	rows := v.(reflect.Value)
+	return rows, rows.Len() > 0
+}
+
+// afterUpdate 按主键重新查询变更后的数据, 只记录变化的字段
+func (p *Plugin) afterUpdate(db *gorm.DB) {
+	rows, ok := p.snapshot(db)
+	if !ok {
+		return
+	}
+	stmt := db.Statement
+	_, queryValues := schema.GetIdentityFieldValuesMap(stmt.Context, rows, stmt.Schema.PrimaryFields)
+	column, pks := schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, queryValues)
+	after := reflect.New(reflect.SliceOf(stmt.Schema.ModelType))
+	err := p.session(db).Table(stmt.Table).Unscoped().
+		Where(clause.IN{Column: column, Values: pks}).
+		Find(after.Interface()).Error
+	if err != nil {
+		_ = db.AddError(errors.WithStack(err))
+		return
+	}
+	current := make(map[string]reflect.Value, after.Elem().Len())
+	eachRow(after.Elem(), func(rv reflect.Value) {
+		current[entityId(stmt, rv)] = rv
+	})
+
+	list := make([]*Log, 0, rows.Len())
+	eachRow(rows, func(rv reflect.Value) {
+		id := entityId(stmt, rv)
+		cur, ok := current[id]
+		if !ok {
+			return
+		}
+		old, changed := diff(stmt, values(stmt, rv), values(stmt, cur))
+		if len(changed) == 0 {
+			return
+		}
+		list = append(list, &Log{
+			EntityID:  id,
+			Action:    ActionUpdate,
+			OldValues: toJSON(stmt, old),
+			NewValues: toJSON(stmt, changed),
+		})
+	})
+	p.write(db, list)
+}
+
+func (p *Plugin) afterDelete(db *gorm.DB) {
+	rows, ok := p.snapshot(db)
+	if !ok {
+		return
+	}
+	stmt := db.Statement
+	list := make([]*Log, 0, rows.Len())
+	eachRow(rows, func(rv reflect.Value) {
+		list = append(list, &Log{
+			EntityID:  entityId(stmt, rv),
+			Action:    ActionDelete,
+			OldValues: toJSON(stmt, values(stmt, rv)),
+		})
+	})
+	p.write(db, list)
+}
+
+// write 使用业务语句的连接写入, 在事务中时属于同一个事务
+func (p *Plugin) write(db *gorm.DB, list []*Log) {
+	if len(list) == 0 {
+		return
+	}
+	ctx := db.Statement.Context
+	userId, reqId, now := user(ctx), requestId(ctx), time.Now()
+	for _, l := range list {
+		l.Entity, l.UserID, l.RequestID, l.CreatedAt = db.Statement.Table, userId, reqId, now
+	}
+	if err := p.session(db).CreateInBatches(list, batchSize).Error; err != nil {
+		_ = db.AddError(errors.WithStack(err))
+	}
+}
+
+// session 新的语句, 保留业务语句的连接(事务); 变更前后的数据要读主库
+func (p *Plugin) session(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{
+		NewDB:     true,
+		SkipHooks: true,
+		Context:   dbresolver.UsePrimary(db.Statement.Context),
+	})
+}
+
+// primaryKeyConditions 与gorm一致, 传入对象的主键不为零值时作为条件
+func primaryKeyConditions(stmt *gorm.Statement) []clause.Expression {
+	exprs := make([]clause.Expression, 0, 2)
+	add := func(rv reflect.Value) {
+		_, queryValues := schema.GetIdentityFieldValuesMap(stmt.Context, rv, stmt.Schema.PrimaryFields)
+		column, values := schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, queryValues)
+		if len(values) > 0 {
+			exprs = append(exprs, clause.IN{Column: column, Values: values})
+		}
+	}
+	if stmt.ReflectValue.IsValid() {
+		add(stmt.ReflectValue)
+	}
+	if stmt.Model != nil && stmt.Dest != stmt.Model {
+		add(reflect.Indirect(reflect.ValueOf(stmt.Model)))
+	}
+	return exprs
+}
+
+// eachRow rv为结构体或结构体的slice, 其他类型(如map)忽略
+func eachRow(rv reflect.Value, fn func(rv reflect.Value)) {
+	rv = reflect.Indirect(rv)
+	switch rv.Kind() {
+	case reflect.Struct:
+		fn(rv)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if row := reflect.Indirect(rv.Index(i)); row.Kind() == reflect.Struct {
+				fn(row)
+			}
+		}
+	}
+}
+
+func entityId(stmt *gorm.Statement, rv reflect.Value) string {
+	ids := make([]string, 0, len(stmt.Schema.PrimaryFields))
+	for _, f := range stmt.Schema.PrimaryFields {
+		v, _ := f.ValueOf(stmt.Context, rv)
+		ids = append(ids, fmt.Sprint(v))
+	}
+	return strings.Join(ids, ",")
+}
+
+// values 列名到值, Valuer类型使用数据库中的值, serializer字段使用字段的值(如加密字段的明文)
+func values(stmt *gorm.Statement, rv reflect.Value) map[string]any {
+	m := make(map[string]any, len(stmt.Schema.DBNames))
+	for _, name := range stmt.Schema.DBNames {
+		f := stmt.Schema.FieldsByDBName[name]
+		if f.Tag.Get("audit") == "-" {
+			continue
+		}
+		if f.Serializer != nil {
+			m[name] = f.ReflectValueOf(stmt.Context, rv).Interface()
+			continue
+		}
+		v, _ := f.ValueOf(stmt.Context, rv)
+		if r := reflect.ValueOf(v); r.Kind() == reflect.Ptr && r.IsNil() {
+			v = nil
+		} else if valuer, ok := v.(driver.Valuer); ok {
+			if dv, err := valuer.Value(); err == nil {
+				v = dv
+			}
+		}
+		m[name] = v
+	}
+	return m
+}
+
+// diff 返回变化的字段变更前后的值, 自动更新的时间字段不算变化
+func diff(stmt *gorm.Statement, before, after map[string]any) (map[string]any, map[string]any) {
+	old, changed := map[string]any{}, map[string]any{}
+	for name, v := range after {
+		if stmt.Schema.FieldsByDBName[name].AutoUpdateTime > 0 {
+			continue
+		}
+		a, _ := json.Marshal(before[name])
+		b, _ := json.Marshal(v)
+		if string(a) != string(b) {
+			old[name], changed[name] = before[name], v
+		}
+	}
+	return old, changed
+}
+
+// toJSON 序列化前替换 audit:"redact" 字段的值, 零值不替换
+func toJSON(stmt *gorm.Statement, m map[string]any) string {
+	if len(m) == 0 {
+		return ""
+	}
+	for name, v := range m {
+		if stmt.Schema.FieldsByDBName[name].Tag.Get("audit") == "redact" && v != nil && !reflect.ValueOf(v).IsZero() {
+			m[name] = RedactedValue
+		}
+	}
+	b, _ := json.Marshal(m)
+	return string(b)
+}
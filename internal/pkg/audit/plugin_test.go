@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type auditedRow struct {
+	ID        uint64 `gorm:"primaryKey"`
+	Name      string
+	Score     int
+	Password  string `audit:"-"`
+	Secret    string `audit:"redact"`
+	UpdatedAt time.Time
+}
+
+// openTestDB 与data层一致, 关闭gorm的默认事务
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{SkipDefaultTransaction: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err = db.AutoMigrate(&auditedRow{}, &Log{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Use(New(0, &auditedRow{})); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestUpdateDiff(t *testing.T) {
+	db := openTestDB(t)
+	ctx := WithUser(context.Background(), 7)
+	if err := db.WithContext(ctx).Create(&auditedRow{ID: 1, Name: "a", Score: 1, Password: "p", Secret: "s"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	err := db.WithContext(ctx).Model(&auditedRow{ID: 1}).
+		Updates(map[string]any{"name": "b", "score": 1, "password": "q", "secret": "t"}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs []Log
+	if err = db.Order("id").Find(&logs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 || logs[0].Action != ActionCreate || logs[1].Action != ActionUpdate {
+		t.Fatalf("got %+v", logs)
+	}
+	// 只记录变化的字段, 不记录audit:"-"和updated_at, audit:"redact"的值被替换
+	l := logs[1]
+	if l.EntityID != "1" || l.UserID != 7 ||
+		l.OldValues != `{"name":"a","secret":"******"}` || l.NewValues != `{"name":"b","secret":"******"}` {
+		t.Fatalf("got %+v", l)
+	}
+}
+
+func TestWriteInTransaction(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.Create(&auditedRow{ID: 1, Name: "a"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrator().DropTable(&Log{}); err != nil {
+		t.Fatal(err)
+	}
+	// 审计日志写入失败时, 事务外的业务语句一起回滚
+	if err := db.Model(&auditedRow{ID: 1}).Update("name", "b").Error; err == nil {
+		t.Fatal("want error when audit_logs is missing")
+	}
+	if err := db.Delete(&auditedRow{ID: 1}).Error; err == nil {
+		t.Fatal("want error when audit_logs is missing")
+	}
+	var row auditedRow
+	if err := db.Take(&row, 1).Error; err != nil || row.Name != "a" {
+		t.Fatalf("got %+v, %v", row, err)
+	}
+}
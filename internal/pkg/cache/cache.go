@@ -0,0 +1,413 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"gin-layout/internal/pkg/redisx"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	logs "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultNamespace       = "gin_layout"
+	DefaultTTL             = 10 * time.Minute
+	DefaultJitter          = 0.1
+	DefaultNotFoundTTL     = time.Minute
+	DefaultLocalMaxEntries = 10000
+	DefaultLocalTTL        = 10 * time.Second
+	DefaultLoadTimeout     = 5 * time.Second
+)
+
+// pingInterval 订阅连接空闲时ping的间隔
+const pingInterval = 30 * time.Second
+
+// notFound 数据不存在时缓存的值, 0xc1在msgpack中不会出现, 也不是合法的json
+const notFound = "\xc1"
+
+// Tier 缓存层级, 可以组合使用
+type Tier uint8
+
+const (
+	TierLocal Tier = 1 << iota // 进程内LRU
+	TierRedis                  // redis
+)
+
+// Family 一类key的配置, 按Key的第一段区分, 例如 gin_layout:uc_users:1 的family为uc_users
+type Family struct {
+	Tiers    Tier          // 使用的层级, 为0时只使用redis
+	TTL      time.Duration // redis的过期时间, 为0时使用Options.TTL
+	LocalTTL time.Duration // 进程内的过期时间, 为0时使用Options.LocalTTL
+}
+
+// Options 为零值的字段使用默认值
+type Options struct {
+	Namespace   string        // key的前缀, 不同服务共用redis时区分
+	Codec       Codec         // 默认JSON
+	TTL         time.Duration // 过期时间
+	Jitter      float64       // 过期时间随机增加的比例, 避免同一批key同时过期, <0时不增加
+	NotFoundTTL time.Duration // 不存在的数据的缓存时间, 防止缓存穿透, <0时不缓存
+	LoadTimeout time.Duration // 回源的超时时间, 回源不受调用方取消的影响
+
+	LocalMaxEntries int               // 进程内缓存的最大条数, 超过后淘汰最久未使用的
+	LocalTTL        time.Duration     // 进程内缓存的过期时间, 删除消息丢失时最多读到这么久的旧数据
+	Families        map[string]Family // 未配置的family只使用redis
+
+	Logger *logs.Logger // 记录订阅等后台错误
+}
+
+// Stats 命中统计, 从创建开始累计
+type Stats struct {
+	LocalHits      uint64
+	LocalMisses    uint64
+	RedisHits      uint64
+	RedisMisses    uint64
+	Loads          uint64 // 回源次数
+	LocalSize      int
+	LocalEvictions uint64 // 超过LocalMaxEntries被淘汰的条数
+}
+
+// Cache cache-aside缓存, 可以在redis前加一层进程内LRU, 未命中时通过singleflight加载, 同一个key同时只有一次回源
+// 使用进程内缓存时, 删除通过redis pub/sub广播到所有实例; redis不可用时直接回源, 不影响业务
+//
+//	user, err := cache.Fetch(ctx, c, c.Key("uc_users", id), func(ctx context.Context) (*biz.UcUser, error) {
+//		return repo.Get(ctx, id)
+//	})
+type Cache struct {
+	rdb      redisx.Client
+	opts     Options
+	sg       singleflight.Group
+	local    *local
+	families map[string]Family
+	fallback Family
+	channel  string
+
+	localHits, localMisses, redisHits, redisMisses, loads atomic.Uint64
+
+	pubsub    *redis.PubSub
+	done      chan struct{}
+	closed    atomic.Bool
+	closeOnce sync.Once
+}
+
+// New 有family使用进程内缓存时订阅删除消息, 需要调用Close停止
+func New(rdb redisx.Client, opts Options) *Cache {
+	if opts.Namespace == "" {
+		opts.Namespace = DefaultNamespace
+	}
+	if opts.Codec == nil {
+		opts.Codec = JSON
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTTL
+	}
+	if opts.Jitter == 0 {
+		opts.Jitter = DefaultJitter
+	}
+	if opts.NotFoundTTL == 0 {
+		opts.NotFoundTTL = DefaultNotFoundTTL
+	}
+	if opts.LoadTimeout <= 0 {
+		opts.LoadTimeout = DefaultLoadTimeout
+	}
+	if opts.LocalMaxEntries <= 0 {
+		opts.LocalMaxEntries = DefaultLocalMaxEntries
+	}
+	if opts.LocalTTL <= 0 {
+		opts.LocalTTL = DefaultLocalTTL
+	}
+	c := &Cache{
+		rdb:      rdb,
+		opts:     opts,
+		families: make(map[string]Family, len(opts.Families)),
+		fallback: Family{Tiers: TierRedis, TTL: opts.TTL, LocalTTL: opts.LocalTTL},
+		channel:  opts.Namespace + ":cache:invalidate",
+		done:     make(chan struct{}),
+	}
+	useLocal := false
+	for name, f := range opts.Families {
+		if f.Tiers == 0 {
+			f.Tiers = TierRedis
+		}
+		if f.TTL <= 0 {
+			f.TTL = opts.TTL
+		}
+		if f.LocalTTL <= 0 {
+			f.LocalTTL = opts.LocalTTL
+		}
+		c.families[name] = f
+		useLocal = useLocal || f.Tiers&TierLocal != 0
+	}
+	if !useLocal {
+		close(c.done)
+		return c
+	}
+	c.local = newLocal(opts.LocalMaxEntries)
+	c.pubsub = rdb.Subscribe()
+	go c.subscribe()
+	return c
+}
+
+// Key 生成带命名空间的key, 例如 Key("uc_users", 1) 为 gin_layout:uc_users:1
+func (c *Cache) Key(parts ...any) string {
+	var sb strings.Builder
+	sb.WriteString(c.opts.Namespace)
+	for _, part := range parts {
+		sb.WriteString(":")
+		sb.WriteString(fmt.Sprint(part))
+	}
+	return sb.String()
+}
+
+// Fetch 依次读取进程内缓存和redis, 都未命中时调用load并写入缓存
+// load返回gorm.ErrRecordNotFound时缓存空值, 过期前再次读取直接返回gorm.ErrRecordNotFound
+func Fetch[T any](ctx context.Context, c *Cache, key string, load func(ctx context.Context) (T, error)) (T, error) {
+	f := c.family(key)
+	useLocal := f.Tiers&TierLocal != 0 && c.local != nil
+	var gen uint64
+	if useLocal {
+		if data, ok := c.local.get(key); ok {
+			c.localHits.Add(1)
+			if v, ok, err := decode[T](ctx, c, key, data); ok {
+				return v, err
+			}
+		} else {
+			c.localMisses.Add(1)
+		}
+		// 在读取redis之前获取, 之后的删除都会使这次写入失效
+		gen = c.local.generation()
+	}
+
+	if f.Tiers&TierRedis != 0 {
+		data, err := c.rdb.WithContext(ctx).Get(key).Bytes()
+		switch {
+		case err == nil:
+			c.redisHits.Add(1)
+			if v, ok, err := decode[T](ctx, c, key, data); ok {
+				if useLocal {
+					c.local.set(key, data, f.LocalTTL, gen)
+				}
+				return v, err
+			}
+		case err == redis.Nil:
+			c.redisMisses.Add(1)
+		default:
+			c.redisMisses.Add(1)
+			warnf(ctx, "cache: get %s error: %v", key, err)
+		}
+	}
+
+	res, err, _ := c.sg.Do(key, func() (any, error) {
+		c.loads.Add(1)
+		// 等待同一个key的调用方共用这次回源, 第一个调用方取消或超时不能让其他调用方失败
+		ctx, cancel := context.WithTimeout(detach(ctx), c.opts.LoadTimeout)
+		defer cancel()
+		v, err := load(ctx)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) && c.opts.NotFoundTTL > 0 {
+				c.store(ctx, f, key, []byte(notFound), c.opts.NotFoundTTL, gen, useLocal)
+			}
+			return v, err
+		}
+		data, err := c.opts.Codec.Marshal(v)
+		if err != nil {
+			warnf(ctx, "cache: encode %s error: %v", key, err)
+			return v, nil
+		}
+		c.store(ctx, f, key, data, c.ttl(f.TTL), gen, useLocal)
+		return v, nil
+	})
+	if err != nil {
+		var v T
+		return v, err
+	}
+	return res.(T), nil
+}
+
+// Delete 删除缓存, 数据修改后调用, 使用进程内缓存时通知其他实例删除
+func (c *Cache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if c.local != nil {
+		c.local.delete(keys...)
+	}
+	// 集群模式下多个key可能不在同一个slot, 使用pipeline逐个删除
+	pipe := c.rdb.WithContext(ctx).Pipeline()
+	for _, key := range keys {
+		pipe.Del(key)
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return errors.WithStack(err)
+	}
+	if c.local == nil {
+		return nil
+	}
+	return errors.WithStack(c.rdb.WithContext(ctx).Publish(c.channel, strings.Join(keys, "\n")).Err())
+}
+
+// Stats 命中统计
+func (c *Cache) Stats() Stats {
+	s := Stats{
+		LocalHits:   c.localHits.Load(),
+		LocalMisses: c.localMisses.Load(),
+		RedisHits:   c.redisHits.Load(),
+		RedisMisses: c.redisMisses.Load(),
+		Loads:       c.loads.Load(),
+	}
+	if c.local != nil {
+		s.LocalSize, s.LocalEvictions = c.local.stats()
+	}
+	return s
+}
+
+// Close 停止订阅删除消息
+func (c *Cache) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.closed.Store(true)
+		if c.pubsub != nil {
+			err = c.pubsub.Close()
+		}
+	})
+	<-c.done
+	return errors.WithStack(err)
+}
+
+// subscribe 接收其他实例的删除消息, 断线重连后清空进程内缓存, 因为断线期间的消息已经丢失
+func (c *Cache) subscribe() {
+	defer close(c.done)
+	if err := c.pubsub.Subscribe(c.channel); err != nil {
+		c.errorf("cache: subscribe %s error: %v", c.channel, err)
+	}
+	subscribed := false
+	for attempt := 0; ; {
+		msg, err := c.pubsub.ReceiveTimeout(pingInterval)
+		if c.closed.Load() {
+			return
+		}
+		// 一段时间没有消息时ping, 发现失效的连接
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			err = c.pubsub.Ping()
+			if err == nil {
+				continue
+			}
+		}
+		if err != nil {
+			c.errorf("cache: receive %s error: %v", c.channel, err)
+			c.local.purge()
+			if attempt < 10 {
+				attempt++
+			}
+			time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+			continue
+		}
+		attempt = 0
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			if subscribed {
+				c.local.purge()
+			}
+			subscribed = true
+		case *redis.Message:
+			c.local.delete(strings.Split(m.Payload, "\n")...)
+		}
+	}
+}
+
+func (c *Cache) family(key string) Family {
+	name := strings.TrimPrefix(key, c.opts.Namespace+":")
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		name = name[:i]
+	}
+	if f, ok := c.families[name]; ok {
+		return f
+	}
+	return c.fallback
+}
+
+// store 写入family使用的层级, 进程内缓存的过期时间不超过ttl
+func (c *Cache) store(ctx context.Context, f Family, key string, data []byte, ttl time.Duration, gen uint64, useLocal bool) {
+	if f.Tiers&TierRedis != 0 {
+		if err := c.rdb.WithContext(ctx).Set(key, data, ttl).Err(); err != nil {
+			warnf(ctx, "cache: set %s error: %v", key, err)
+		}
+	}
+	if useLocal {
+		if f.LocalTTL < ttl {
+			ttl = f.LocalTTL
+		}
+		c.local.set(key, data, ttl, gen)
+	}
+}
+
+// ttl 过期时间加上随机的抖动
+func (c *Cache) ttl(ttl time.Duration) time.Duration {
+	if c.opts.Jitter <= 0 {
+		return ttl
+	}
+	jitter := int64(float64(ttl) * c.opts.Jitter)
+	if jitter <= 0 {
+		return ttl
+	}
+	return ttl + time.Duration(rand.Int63n(jitter))
+}
+
+func (c *Cache) errorf(format string, args ...any) {
+	if c.opts.Logger != nil {
+		c.opts.Logger.Errorf(format, args...)
+	}
+}
+
+// decode 解码缓存的值, 解码失败时ok为false, 需要回源
+func decode[T any](ctx context.Context, c *Cache, key string, data []byte) (v T, ok bool, err error) {
+	if string(data) == notFound {
+		return v, true, errors.WithStack(gorm.ErrRecordNotFound)
+	}
+	if err = c.opts.Codec.Unmarshal(data, &v); err != nil {
+		warnf(ctx, "cache: decode %s error: %v", key, err)
+		return v, false, nil
+	}
+	return v, true, nil
+}
+
+// warnf 缓存错误只记录日志, 使用请求的logger
+func warnf(ctx context.Context, format string, args ...any) {
+	if logger, ok := ctx.Value("logger").(*logs.Entry); ok {
+		logger.Warnf(format, args...)
+	}
+}
+
+// detachedContext 保留ctx中的值(logger、租户等), 去掉取消和超时
+type detachedContext struct {
+	parent context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key any) any {
+	return c.parent.Value(key)
+}
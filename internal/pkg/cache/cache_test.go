@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"context"
+	"gin-layout/internal/pkg/redisx"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+type ctxKey struct{}
+
+// 使用已关闭的redis客户端, redis不可用时直接回源
+func newTestCache(t *testing.T) *Cache {
+	t.Helper()
+	rdb := redisx.NewClient(&redis.Options{Addr: "127.0.0.1:6379"})
+	_ = rdb.Close()
+	c := New(rdb, Options{LoadTimeout: time.Minute})
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestFetchDetachedLoad(t *testing.T) {
+	c := newTestCache(t)
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "v"))
+	defer cancel()
+	got, err := Fetch(ctx, c, c.Key("users", 1), func(ctx context.Context) (string, error) {
+		// 第一个调用方取消后, 共用的回源继续执行
+		cancel()
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+			t.Errorf("got deadline %v, %v", deadline, ok)
+		}
+		return ctx.Value(ctxKey{}).(string), nil
+	})
+	if err != nil || got != "v" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if s := c.Stats(); s.Loads != 1 || s.RedisMisses != 1 {
+		t.Fatalf("got stats %+v", s)
+	}
+}
+
+func TestKeyFamily(t *testing.T) {
+	c := New(nil, Options{Namespace: "ns", TTL: time.Minute, Families: map[string]Family{"users": {TTL: time.Hour}}})
+	key := c.Key("users", "default", 1)
+	if key != "ns:users:default:1" {
+		t.Fatalf("got key %s", key)
+	}
+	if f := c.family(key); f.TTL != time.Hour || f.Tiers != TierRedis {
+		t.Fatalf("got family %+v", f)
+	}
+	if f := c.family(c.Key("orders", 1)); f.TTL != time.Minute {
+		t.Fatalf("got fallback %+v", f)
+	}
+}
@@ -0,0 +1,61 @@
+package cache
+
+import (
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec 缓存值的序列化方式
+type Codec interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	// JSON 默认的序列化方式, 便于在redis中直接查看
+	JSON Codec = jsonCodec{}
+	// Msgpack 体积更小, 序列化更快
+	Msgpack Codec = msgpackCodec{}
+)
+
+// CodecByName 按名称获取Codec, 名称为空时使用JSON
+func CodecByName(name string) (Codec, error) {
+	switch name {
+	case "", JSON.Name():
+		return JSON, nil
+	case Msgpack.Name():
+		return Msgpack, nil
+	default:
+		return nil, errors.Errorf("cache: unknown codec %q", name)
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(data, v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	return msgpack.Unmarshal(data, v)
+}
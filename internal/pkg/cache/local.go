@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// local 进程内的LRU缓存, 保存序列化后的值, 避免调用方修改缓存中的对象
+type local struct {
+	mu         sync.Mutex
+	maxEntries int
+	ll         *list.List
+	items      map[string]*list.Element
+	// gen 每次删除时加1, 回源期间发生过删除时不写入, 防止写入旧值
+	gen       uint64
+	evictions uint64
+}
+
+type localEntry struct {
+	key      string
+	data     []byte
+	expireAt time.Time
+}
+
+func newLocal(maxEntries int) *local {
+	return &local{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+func (l *local) get(key string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	el, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*localEntry)
+	if time.Now().After(entry.expireAt) {
+		l.remove(el)
+		return nil, false
+	}
+	l.ll.MoveToFront(el)
+	return entry.data, true
+}
+
+// generation 回源前读取, set时传入
+func (l *local) generation() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.gen
+}
+
+// set gen与当前不一致时说明回源期间有删除, 放弃写入
+func (l *local) set(key string, data []byte, ttl time.Duration, gen uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if gen != l.gen {
+		return
+	}
+	expireAt := time.Now().Add(ttl)
+	if el, ok := l.items[key]; ok {
+		entry := el.Value.(*localEntry)
+		entry.data, entry.expireAt = data, expireAt
+		l.ll.MoveToFront(el)
+		return
+	}
+	l.items[key] = l.ll.PushFront(&localEntry{key: key, data: data, expireAt: expireAt})
+	for l.ll.Len() > l.maxEntries {
+		l.remove(l.ll.Back())
+		l.evictions++
+	}
+}
+
+func (l *local) delete(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.gen++
+	for _, key := range keys {
+		if el, ok := l.items[key]; ok {
+			l.remove(el)
+		}
+	}
+}
+
+// purge 清空, 订阅断开期间可能丢失了删除消息
+func (l *local) purge() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.gen++
+	l.ll.Init()
+	l.items = make(map[string]*list.Element)
+}
+
+func (l *local) stats() (size int, evictions uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ll.Len(), l.evictions
+}
+
+func (l *local) remove(el *list.Element) {
+	l.ll.Remove(el)
+	delete(l.items, el.Value.(*localEntry).key)
+}
@@ -0,0 +1,398 @@
+package cron
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"gin-layout/internal/pkg/lock"
+	"gin-layout/internal/pkg/redisx"
+	mrand "math/rand"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+	logs "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultPrefix  = "gin_layout:cron:"
+	DefaultTimeout = time.Hour
+
+	// TriggerSchedule 按计划执行
+	TriggerSchedule = "schedule"
+	// TriggerManual 手动触发
+	TriggerManual = "manual"
+
+	// tick去重key的保留时间, 在该范围内按任务的间隔计算, 覆盖各实例之间的时钟偏差
+	minTickTTL = time.Minute
+	maxTickTTL = 24 * time.Hour
+
+	saveTimeout    = 5 * time.Second
+	maxErrorLength = 1024
+)
+
+var (
+	// ErrUnknownTask 任务不存在
+	ErrUnknownTask = errors.New("cron: unknown task")
+	// ErrRunning 任务正在执行(可能在其他实例)
+	ErrRunning = errors.New("cron: task is running")
+	// ErrStopped 调度器已经停止
+	ErrStopped = errors.New("cron: scheduler stopped")
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// Task 定时任务, 在代码中声明
+//
+//	cron.Task{Name: "purge_trash", Spec: "CRON_TZ=Asia/Shanghai 0 3 * * *", Run: purge}
+type Task struct {
+	Name    string
+	Spec    string        // cron表达式, 见Parse
+	Jitter  time.Duration // 到期后随机延迟的上限, 0使用Options.Jitter, <0时不延迟
+	Timeout time.Duration // 执行时限, 0使用Options.Timeout
+	Run     func(ctx context.Context) error
+}
+
+// Options 为零值的字段使用默认值
+type Options struct {
+	Prefix     string         // key的前缀
+	Location   *time.Location // cron表达式没有指定CRON_TZ时使用的时区, 默认time.Local
+	Jitter     time.Duration  // 到期后随机延迟的上限, 分散多个任务同时执行的压力, 需要小于任务的间隔
+	Timeout    time.Duration  // 执行时限, 超过后取消任务的ctx
+	ManualOnly bool           // 只能手动触发, 不按计划执行
+}
+
+// Run 一次执行的记录
+type Run struct {
+	Task       string    `json:"task"`
+	Trigger    string    `json:"trigger"`
+	Instance   string    `json:"instance"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// TaskInfo 任务的状态
+type TaskInfo struct {
+	Name    string
+	Spec    string
+	NextRun time.Time // 下一次计划执行的时间, ManualOnly时为零值
+	LastRun *Run      // 最后一次执行, 所有实例共享, 没有执行过时为nil
+}
+
+type entry struct {
+	task     Task
+	schedule Schedule
+	rnd      *mrand.Rand // 只在任务自己的goroutine中使用
+}
+
+// Scheduler 按cron表达式执行定时任务, 多个实例同时运行时:
+// 每个到期时间只由最先通过SETNX认领的实例执行一次;
+// 执行期间持有分布式锁, 上一次还没结束时跳过本次, 手动触发时返回ErrRunning;
+// 实例崩溃后锁在lock.Options.TTL后释放
+//
+//	s, err := cron.New(rdb, locker, tasks, cron.Options{}, logger)
+//	s.Start()
+//	defer s.Stop()
+type Scheduler struct {
+	rdb      redisx.Client
+	locker   *lock.Locker
+	opts     Options
+	tasks    []*entry
+	byName   map[string]*entry
+	logger   *logs.Entry
+	instance string
+
+	ctx       context.Context // Stop时取消, 执行中的任务随之取消
+	cancel    context.CancelFunc
+	mu        sync.Mutex
+	stopped   bool
+	wg        sync.WaitGroup
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// New 任务名称不能重复, 表达式错误时返回错误
+func New(rdb redisx.Client, locker *lock.Locker, tasks []Task, opts Options, logger *logs.Logger) (*Scheduler, error) {
+	if opts.Prefix == "" {
+		opts.Prefix = DefaultPrefix
+	}
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	s := &Scheduler{
+		rdb:    rdb,
+		locker: locker,
+		opts:   opts,
+		byName: make(map[string]*entry, len(tasks)),
+		logger: logs.NewEntry(logger).WithField("job", "cron"),
+	}
+	for i, t := range tasks {
+		if t.Name == "" || t.Run == nil {
+			return nil, errors.Errorf("cron: task %d has no name or run func", i)
+		}
+		if _, ok := s.byName[t.Name]; ok {
+			return nil, errors.Errorf("cron: duplicate task %q", t.Name)
+		}
+		schedule, err := Parse(t.Spec, opts.Location)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "cron: task %q", t.Name)
+		}
+		e := &entry{task: t, schedule: schedule, rnd: mrand.New(mrand.NewSource(time.Now().UnixNano() + int64(i)))}
+		s.tasks = append(s.tasks, e)
+		s.byName[t.Name] = e
+	}
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	s.instance = host + "-" + hex.EncodeToString(b)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s, nil
+}
+
+// Start 每个任务一个goroutine等待到期, 多次调用只启动一次
+func (s *Scheduler) Start() {
+	s.startOnce.Do(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.stopped || s.opts.ManualOnly {
+			return
+		}
+		for _, e := range s.tasks {
+			s.wg.Add(1)
+			go s.loop(e)
+		}
+		s.logger.Infof("cron scheduler started with %d tasks", len(s.tasks))
+	})
+}
+
+// Stop 停止调度, 取消并等待执行中的任务
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() {
+		s.mu.Lock()
+		s.stopped = true
+		s.mu.Unlock()
+		s.cancel()
+		s.wg.Wait()
+	})
+}
+
+// Tasks 所有任务的状态
+func (s *Scheduler) Tasks(ctx context.Context) ([]*TaskInfo, error) {
+	now := time.Now()
+	rdb := s.rdb.WithContext(ctx)
+	res := make([]*TaskInfo, 0, len(s.tasks))
+	for _, e := range s.tasks {
+		info := &TaskInfo{Name: e.task.Name, Spec: e.task.Spec}
+		if !s.opts.ManualOnly {
+			info.NextRun = e.schedule.Next(now)
+		}
+		data, err := rdb.Get(s.key(e, "last")).Bytes()
+		switch {
+		case err == redis.Nil:
+		case err != nil:
+			return nil, errors.WithStack(err)
+		default:
+			info.LastRun = &Run{}
+			if err = json.Unmarshal(data, info.LastRun); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+		res = append(res, info)
+	}
+	return res, nil
+}
+
+// Trigger 立即在当前实例后台执行一次, 不影响计划的执行时间
+// 任务正在执行时返回ErrRunning
+func (s *Scheduler) Trigger(ctx context.Context, name string) error {
+	e, ok := s.byName[name]
+	if !ok {
+		return errors.WithStack(ErrUnknownTask)
+	}
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return errors.WithStack(ErrStopped)
+	}
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	lk, err := s.locker.TryAcquire(ctx, s.lockKey(e))
+	if err != nil {
+		s.wg.Done()
+		if errors.Is(err, lock.ErrNotObtained) {
+			return errors.WithStack(ErrRunning)
+		}
+		return err
+	}
+	logger := s.logger
+	if requestId, ok := ctx.Value("request_id").(string); ok {
+		logger = logger.WithField("request_id", requestId)
+	}
+	go func() {
+		defer s.wg.Done()
+		s.run(e, TriggerManual, lk, logger)
+	}()
+	return nil
+}
+
+func (s *Scheduler) loop(e *entry) {
+	defer s.wg.Done()
+	for {
+		tick := e.schedule.Next(time.Now())
+		if tick.IsZero() {
+			s.logger.Warnf("cron task %s has no next run, spec: %s", e.task.Name, e.task.Spec)
+			return
+		}
+		timer := time.NewTimer(time.Until(tick) + s.jitter(e))
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.tick(e, tick)
+	}
+}
+
+// tick 认领本次执行, 没有认领到或上一次还没结束时跳过
+func (s *Scheduler) tick(e *entry, tick time.Time) {
+	logger := s.logger.WithField("cron_task", e.task.Name)
+	key := s.key(e, "tick:"+strconv.FormatInt(tick.Unix(), 10))
+	ok, err := s.rdb.WithContext(s.ctx).SetNX(key, s.instance, s.tickTTL(e, tick)).Result()
+	if err != nil {
+		if s.ctx.Err() == nil {
+			logger.Errorf("cron task %s claim tick error: %+v", e.task.Name, errors.WithStack(err))
+		}
+		return
+	}
+	if !ok {
+		logger.Debugf("cron task %s tick %s claimed by another instance", e.task.Name, tick.Format(time.RFC3339))
+		return
+	}
+	lk, err := s.locker.TryAcquire(s.ctx, s.lockKey(e))
+	if err != nil {
+		if errors.Is(err, lock.ErrNotObtained) {
+			logger.Warnf("cron task %s skipped tick %s, previous run is still in progress", e.task.Name, tick.Format(time.RFC3339))
+		} else if s.ctx.Err() == nil {
+			logger.Errorf("cron task %s lock error: %+v", e.task.Name, err)
+		}
+		return
+	}
+	s.run(e, TriggerSchedule, lk, s.logger)
+}
+
+// run 持有锁执行一次, 记录耗时和结果, 结束后释放锁
+func (s *Scheduler) run(e *entry, trigger string, lk *lock.Lock, logger *logs.Entry) {
+	logger = logger.WithFields(logs.Fields{"cron_task": e.task.Name, "trigger": trigger})
+	timeout := e.task.Timeout
+	if timeout <= 0 {
+		timeout = s.opts.Timeout
+	}
+	ctx, cancel := context.WithTimeout(context.WithValue(s.ctx, "logger", logger), timeout)
+	defer cancel()
+	defer func() {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+		defer cancel()
+		if err := lk.Release(releaseCtx); err != nil {
+			logger.Errorf("cron task %s release lock error: %+v", e.task.Name, err)
+		}
+	}()
+	// 锁丢失后其他实例可能开始执行, 取消本次执行
+	go func() {
+		select {
+		case <-lk.Lost():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	start := time.Now()
+	err := call(ctx, e.task.Run, logger)
+	duration := time.Since(start)
+	run := &Run{
+		Task:       e.task.Name,
+		Trigger:    trigger,
+		Instance:   s.instance,
+		StartedAt:  start,
+		DurationMs: duration.Milliseconds(),
+	}
+	logger = logger.WithField("duration_ms", run.DurationMs)
+	if err != nil {
+		run.Error = truncate(err.Error())
+		logger.Errorf("cron task %s failed after %s: %+v", e.task.Name, duration, err)
+	} else {
+		logger.Infof("cron task %s finished in %s", e.task.Name, duration)
+	}
+	if err = s.saveRun(e, run); err != nil {
+		logger.Errorf("cron task %s save run error: %+v", e.task.Name, err)
+	}
+}
+
+func (s *Scheduler) saveRun(e *entry, run *Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+	defer cancel()
+	return errors.WithStack(s.rdb.WithContext(ctx).Set(s.key(e, "last"), data, 0).Err())
+}
+
+func call(ctx context.Context, fn func(ctx context.Context) error, logger *logs.Entry) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = errors.Errorf("panic: %v", e)
+			logger.Errorf("cron task panic: %v\n%s", e, debug.Stack())
+		}
+	}()
+	return fn(ctx)
+}
+
+func (s *Scheduler) jitter(e *entry) time.Duration {
+	jitter := e.task.Jitter
+	if jitter == 0 {
+		jitter = s.opts.Jitter
+	}
+	if jitter <= 0 {
+		return 0
+	}
+	return time.Duration(e.rnd.Int63n(int64(jitter)))
+}
+
+// tickTTL 任务的间隔, 限制在[minTickTTL, maxTickTTL]
+func (s *Scheduler) tickTTL(e *entry, tick time.Time) time.Duration {
+	ttl := maxTickTTL
+	if next := e.schedule.Next(tick); !next.IsZero() && next.Sub(tick) < ttl {
+		ttl = next.Sub(tick)
+	}
+	if ttl < minTickTTL {
+		ttl = minTickTTL
+	}
+	return ttl
+}
+
+func (s *Scheduler) key(e *entry, suffix string) string {
+	return s.opts.Prefix + e.task.Name + ":" + suffix
+}
+
+// lockKey 在Locker的前缀下
+func (s *Scheduler) lockKey(e *entry) string {
+	return "cron:" + e.task.Name
+}
+
+func truncate(s string) string {
+	if len(s) > maxErrorLength {
+		return s[:maxErrorLength]
+	}
+	return s
+}
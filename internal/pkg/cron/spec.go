@@ -0,0 +1,224 @@
+package cron
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Schedule 计算下一次执行的时间
+type Schedule interface {
+	// Next 返回t之后的下一次执行时间, 没有时返回零值
+	Next(t time.Time) time.Time
+}
+
+// field 一个字段允许的值
+type field struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{min: 0, max: 59}
+	hourField   = field{min: 0, max: 23}
+	domField    = field{min: 1, max: 31}
+	monthField  = field{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 0和7都是星期日
+	dowField = field{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+
+	descriptors = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+)
+
+// Parse 解析标准的5段cron表达式(分 时 日 月 周), 使用loc计算时间, 支持:
+//
+//	*/15 9-18 * * MON-FRI
+//	CRON_TZ=Asia/Shanghai 0 3 * * *
+//	@daily, @hourly 等
+//	@every 1h30m, 按间隔从零点(Unix时间)对齐
+//
+// 夏令时开始时跳过不存在的时间, 结束时重复的时间只执行一次, 分或时为*的除外
+func Parse(spec string, loc *time.Location) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		tz, rest, _ := strings.Cut(spec, " ")
+		_, name, _ := strings.Cut(tz, "=")
+		l, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cron: invalid timezone %q", name)
+		}
+		loc, spec = l, strings.TrimSpace(rest)
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil || d < time.Second {
+			return nil, errors.Errorf("cron: invalid interval in %q", spec)
+		}
+		return every(d), nil
+	}
+	if s, ok := descriptors[spec]; ok {
+		spec = s
+	}
+	parts := strings.Fields(spec)
+	if len(parts) != 5 {
+		return nil, errors.Errorf("cron: %q must have 5 fields", spec)
+	}
+	s := &specSchedule{loc: loc}
+	var err error
+	if s.minute, err = minuteField.parse(parts[0]); err != nil {
+		return nil, err
+	}
+	if s.hour, err = hourField.parse(parts[1]); err != nil {
+		return nil, err
+	}
+	if s.dom, err = domField.parse(parts[2]); err != nil {
+		return nil, err
+	}
+	if s.month, err = monthField.parse(parts[3]); err != nil {
+		return nil, err
+	}
+	if s.dow, err = dowField.parse(parts[4]); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar, s.dowStar = parts[2] == "*", parts[4] == "*"
+	s.wildcard = strings.HasPrefix(parts[0], "*") || strings.HasPrefix(parts[1], "*")
+	return s, nil
+}
+
+// parse 支持 *, a, a-b, */n, a-b/n, a/n 和逗号分隔的列表, 返回允许的值的位图
+func (f field) parse(expr string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, errors.Errorf("cron: invalid step in %q", part)
+			}
+			step = n
+		}
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(a); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = f.value(b); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				hi = f.max
+			}
+			if lo > hi {
+				return 0, errors.Errorf("cron: invalid range %q", part)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, errors.Errorf("cron: %q out of range [%d, %d]", s, f.min, f.max)
+	}
+	return v, nil
+}
+
+type specSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+	wildcard                      bool // 分或时以*开头, 夏令时结束时重复的一小时中按新的时间再执行一次
+	loc                           *time.Location
+}
+
+func (s *specSchedule) Next(t time.Time) time.Time {
+	t = t.In(s.loc)
+	from := wallClock(t)
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, s.loc).Add(time.Minute)
+	// 表达式可能永远不匹配, 例如2月30日
+	limit := t.Year() + 5
+	for t.Year() <= limit {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = forward(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc))
+		case !s.dayMatches(t):
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc))
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = nextHour(t)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		case !s.wildcard && !wallClock(t).After(from):
+			// 夏令时结束时固定时间的任务只执行一次, 与crontab一致
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// forward 夏令时切换时time.Date可能把不存在的时间调整到之前, 此时改为前进到下一个小时
+func forward(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return nextHour(t)
+}
+
+// nextHour 按绝对时间前进到下一个整点, 跳过夏令时不存在的时间
+func nextHour(t time.Time) time.Time {
+	return t.Add(time.Duration(60-t.Minute()) * time.Minute)
+}
+
+// wallClock 当地的日期和时间, 精确到分钟, 用于比较夏令时结束时重复的时间
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+// dayMatches 日和周都有限制时满足其一即可, 与crontab一致
+func (s *specSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	d := time.Duration(e)
+	return t.Truncate(d).Add(d)
+}
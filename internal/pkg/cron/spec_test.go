@@ -0,0 +1,64 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	utc := func(s string) time.Time {
+		v, _ := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+		return v
+	}
+	cases := []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"*/15 9-18 * * MON-FRI", utc("2026-01-02 18:50"), utc("2026-01-05 09:00")},
+		{"@yearly", utc("2026-06-01 00:00"), utc("2027-01-01 00:00")},
+		// 日和周都有限制时满足其一即可
+		{"0 0 13 * FRI", utc("2026-01-01 00:00"), utc("2026-01-02 00:00")},
+		// 7也是星期日
+		{"0 * * * 7", utc("2026-01-03 23:30"), utc("2026-01-04 00:00")},
+		{"@every 1h30m", utc("2026-01-01 00:10"), utc("2026-01-01 01:30")},
+		{"0 0 30 2 *", utc("2026-01-01 00:00"), time.Time{}},
+		// 夏令时开始当天没有2:30, 下一次是第二天
+		{"CRON_TZ=America/New_York 30 2 * * *", time.Date(2026, 3, 7, 3, 0, 0, 0, ny), time.Date(2026, 3, 9, 2, 30, 0, 0, ny)},
+		// 夏令时结束当天1:30出现两次, 只执行第一次
+		{"CRON_TZ=America/New_York 30 1 * * *", time.Date(2026, 11, 1, 1, 30, 0, 0, ny), time.Date(2026, 11, 2, 1, 30, 0, 0, ny)},
+		// 分或时为*的任务在重复的一小时中按新的时间执行
+		{"CRON_TZ=America/New_York 30 * * * *", time.Date(2026, 11, 1, 1, 30, 0, 0, ny), time.Date(2026, 11, 1, 1, 30, 0, 0, ny).Add(time.Hour)},
+	}
+	for _, c := range cases {
+		t.Run(c.spec, func(t *testing.T) {
+			s, err := Parse(c.spec, time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Next(c.from); !got.Equal(c.want) {
+				t.Fatalf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, spec := range []string{
+		"61 * * * *",
+		"* * * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"@every 10ms",
+		"CRON_TZ=Bad/Zone 0 0 * * *",
+	} {
+		if _, err := Parse(spec, time.UTC); err == nil {
+			t.Errorf("%q: want error", spec)
+		}
+	}
+}
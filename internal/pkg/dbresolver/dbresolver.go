@@ -0,0 +1,262 @@
+package dbresolver
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logs "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	// StateKey 请求级别的读写状态在gin.Context中的key, 由中间件设置
+	StateKey = "db_resolver_state"
+
+	DefaultHealthCheckInterval = 5 * time.Second
+
+	pingTimeout = time.Second
+)
+
+// Replica 从库连接池
+type Replica struct {
+	Name   string // 用于日志, 一般为 host:port
+	DB     *sql.DB
+	Weight int // 权重, <=0 时为1
+}
+
+type replica struct {
+	Replica
+	healthy atomic.Bool
+}
+
+// Resolver gorm插件, 读操作路由到健康的从库, 以下情况使用主库:
+// 事务中、SELECT ... FOR UPDATE、ctx被UsePrimary标记、同一请求中已经执行过写操作(读己之写)
+//
+//	db.Use(dbresolver.New(replicas, interval, logger))
+type Resolver struct {
+	replicas []*replica
+	interval time.Duration
+	logger   *logs.Logger
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	running  atomic.Bool // 健康检查已经开始, Initialize失败时Close不等待
+}
+
+// State 一次请求的读写状态, 写操作后该请求后续的读都使用主库
+type State struct {
+	wrote atomic.Bool
+}
+
+// NewState .
+func NewState() *State {
+	return &State{}
+}
+
+type primaryKey struct{}
+
+// WithState 为非gin请求(如任务)创建读写状态, gin请求由中间件设置
+func WithState(ctx context.Context) context.Context {
+	return context.WithValue(ctx, StateKey, NewState())
+}
+
+// UsePrimary 强制读主库
+func UsePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// New interval<=0 时使用DefaultHealthCheckInterval
+func New(replicas []Replica, interval time.Duration, logger *logs.Logger) *Resolver {
+	if interval <= 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	r := &Resolver{
+		interval: interval,
+		logger:   logger,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, rp := range replicas {
+		if rp.Weight <= 0 {
+			rp.Weight = 1
+		}
+		item := &replica{Replica: rp}
+		item.healthy.Store(true)
+		r.replicas = append(r.replicas, item)
+	}
+	return r
+}
+
+// Name implements gorm.Plugin
+func (r *Resolver) Name() string {
+	return "dbresolver"
+}
+
+// Initialize implements gorm.Plugin, 注册回调并开始健康检查
+func (r *Resolver) Initialize(db *gorm.DB) error {
+	if len(r.replicas) == 0 {
+		return nil
+	}
+	cb := db.Callback()
+	if err := cb.Query().Before("gorm:query").Register("dbresolver:query", r.route); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("dbresolver:row", r.route); err != nil {
+		return err
+	}
+	if err := cb.Create().After("gorm:create").Register("dbresolver:create", r.wrote); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("dbresolver:update", r.wrote); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:delete").Register("dbresolver:delete", r.wrote); err != nil {
+		return err
+	}
+	if err := cb.Raw().After("gorm:raw").Register("dbresolver:raw", r.wrote); err != nil {
+		return err
+	}
+	r.running.Store(true)
+	go r.healthCheck()
+	return nil
+}
+
+// Close 停止健康检查并关闭从库连接池
+func (r *Resolver) Close() error {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+	if r.running.Load() {
+		<-r.done
+	}
+	var err error
+	for _, rp := range r.replicas {
+		if e := rp.DB.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// route 读操作切换到从库
+func (r *Resolver) route(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+	stmt := db.Statement
+	// 事务中的ConnPool是*sql.Tx
+	if _, ok := stmt.ConnPool.(gorm.TxCommitter); ok {
+		return
+	}
+	// SELECT ... FOR UPDATE / LOCK IN SHARE MODE
+	if _, ok := stmt.Clauses["FOR"]; ok {
+		return
+	}
+	// Raw的SQL已经生成, 只有普通的SELECT才走从库
+	if stmt.SQL.Len() > 0 && !readOnlySQL(stmt.SQL.String()) {
+		return
+	}
+	if usePrimary(stmt.Context) {
+		return
+	}
+	if rp := r.pick(); rp != nil {
+		stmt.ConnPool = rp.DB
+	}
+}
+
+// wrote 写操作后标记当前请求, 之后的读使用主库
+func (r *Resolver) wrote(db *gorm.DB) {
+	if state := stateFrom(db.Statement.Context); state != nil {
+		state.wrote.Store(true)
+	}
+}
+
+// pick 按权重随机选择健康的从库, 没有健康的从库时返回nil, 使用主库
+func (r *Resolver) pick() *replica {
+	total := 0
+	for _, rp := range r.replicas {
+		if rp.healthy.Load() {
+			total += rp.Weight
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+	n := rand.Intn(total)
+	for _, rp := range r.replicas {
+		if !rp.healthy.Load() {
+			continue
+		}
+		if n < rp.Weight {
+			return rp
+		}
+		n -= rp.Weight
+	}
+	return nil
+}
+
+// healthCheck 定期ping从库, 失败的从库被摘除, 恢复后重新加入
+func (r *Resolver) healthCheck() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+		for _, rp := range r.replicas {
+			ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+			err := rp.DB.PingContext(ctx)
+			cancel()
+			healthy := err == nil
+			if rp.healthy.Swap(healthy) == healthy || r.logger == nil {
+				continue
+			}
+			if healthy {
+				r.logger.Infof("dbresolver: replica %s recovered", rp.Name)
+			} else {
+				r.logger.Errorf("dbresolver: replica %s ejected: %v", rp.Name, err)
+			}
+		}
+	}
+}
+
+func readOnlySQL(sql string) bool {
+	sql = strings.ToUpper(strings.TrimSpace(sql))
+	if !strings.HasPrefix(sql, "SELECT") {
+		return false
+	}
+	for _, lock := range []string{"FOR UPDATE", "FOR SHARE", "LOCK IN SHARE MODE"} {
+		if strings.Contains(sql, lock) {
+			return false
+		}
+	}
+	return true
+}
+
+func usePrimary(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	if primary, _ := ctx.Value(primaryKey{}).(bool); primary {
+		return true
+	}
+	state := stateFrom(ctx)
+	return state != nil && state.wrote.Load()
+}
+
+func stateFrom(ctx context.Context) *State {
+	if ctx == nil {
+		return nil
+	}
+	state, _ := ctx.Value(StateKey).(*State)
+	return state
+}
@@ -0,0 +1,136 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// blindIndexSize 盲索引使用hmac-sha256的前16字节
+	blindIndexSize = 16
+)
+
+var (
+	// ErrNoKeyring 没有配置密钥时加密非空的值
+	ErrNoKeyring = errors.New("encrypt: keyring is not configured")
+	// ErrUnknownKey 密文的key id不在密钥中, 轮换时旧key需要保留到reencrypt完成
+	ErrUnknownKey = errors.New("encrypt: unknown key id")
+	// ErrMalformed 不是Keyring生成的密文
+	ErrMalformed = errors.New("encrypt: malformed ciphertext")
+)
+
+var keyring atomic.Pointer[Keyring]
+
+// SetKeyring 设置serializer和盲索引使用的密钥, 启动时调用
+func SetKeyring(k *Keyring) {
+	keyring.Store(k)
+}
+
+// Default 当前的密钥, 没有配置时为nil
+func Default() *Keyring {
+	return keyring.Load()
+}
+
+// Keyring AES-GCM密钥, 按key id区分, 加密使用current, 解密按密文中的key id选择
+// 密文格式为 key_id:base64(nonce+密文), 轮换时添加新key并修改current, 再执行reencrypt
+type Keyring struct {
+	current  string
+	aeads    map[string]cipher.AEAD
+	indexKey []byte
+}
+
+// NewKeyring keys为key id到16/24/32字节的key, indexKey为盲索引的hmac key, 为空时不能使用盲索引
+func NewKeyring(current string, keys map[string][]byte, indexKey []byte) (*Keyring, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, errors.Errorf("encrypt: current key %q is not in keys", current)
+	}
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, errors.Errorf("encrypt: invalid key id %q", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "encrypt: key %q", id)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		aeads[id] = aead
+	}
+	return &Keyring{current: current, aeads: aeads, indexKey: indexKey}, nil
+}
+
+// Current 加密使用的key id
+func (k *Keyring) Current() string {
+	return k.current
+}
+
+// Encrypt 使用current加密, 空字符串不加密
+func (k *Keyring) Encrypt(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	aead := k.aeads[k.current]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.WithStack(err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return k.current + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 按密文中的key id解密, 空字符串返回空字符串
+func (k *Keyring) Decrypt(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	id, data, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", errors.WithStack(ErrMalformed)
+	}
+	aead, ok := k.aeads[id]
+	if !ok {
+		return "", errors.Wrapf(ErrUnknownKey, "%q", id)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(data)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.WithStack(ErrMalformed)
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.WithStack(ErrMalformed)
+	}
+	return string(plain), nil
+}
+
+// KeyID 密文使用的key id
+func KeyID(s string) string {
+	id, _, _ := strings.Cut(s, ":")
+	return id
+}
+
+// BlindIndex 等值查询使用的盲索引, column用于区分不同字段相同的值, 空字符串返回空字符串
+func (k *Keyring) BlindIndex(column, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if len(k.indexKey) == 0 {
+		return "", errors.New("encrypt: blind index key is not configured")
+	}
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(column))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)[:blindIndexSize]), nil
+}
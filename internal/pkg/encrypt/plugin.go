@@ -0,0 +1,220 @@
+package encrypt
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Plugin gorm插件, 写入加密字段时同时写入盲索引;
+// gorm使用map更新时不经过serializer, 这里把map中加密字段的值替换为密文
+//
+//	db.Use(encrypt.New())
+type Plugin struct {
+	fields sync.Map // *schema.Schema -> []encryptedField
+}
+
+// New .
+func New() *Plugin {
+	return &Plugin{}
+}
+
+func (p *Plugin) Name() string {
+	return "encrypt"
+}
+
+func (p *Plugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register("encrypt:create", p.create); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(cb.Update().Before("gorm:update").Register("encrypt:update", p.update))
+}
+
+func (p *Plugin) encryptedFields(db *gorm.DB) []encryptedField {
+	sch := db.Statement.Schema
+	if db.Error != nil || sch == nil {
+		return nil
+	}
+	if v, ok := p.fields.Load(sch); ok {
+		return v.([]encryptedField)
+	}
+	list, err := encryptedFields(sch)
+	if err != nil {
+		_ = db.AddError(err)
+		return nil
+	}
+	p.fields.Store(sch, list)
+	return list
+}
+
+func (p *Plugin) create(db *gorm.DB) {
+	fields := p.encryptedFields(db)
+	if len(fields) == 0 {
+		return
+	}
+	stmt := db.Statement
+	switch rv := reflect.Indirect(stmt.ReflectValue); rv.Kind() {
+	case reflect.Struct:
+		p.setIndexes(db, fields, rv)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			p.setIndexes(db, fields, reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Map:
+		p.encryptMap(db, fields)
+	}
+}
+
+func (p *Plugin) update(db *gorm.DB) {
+	fields := p.encryptedFields(db)
+	if len(fields) == 0 {
+		return
+	}
+	stmt := db.Statement
+	if _, ok := stmt.Dest.(map[string]any); ok {
+		p.encryptMap(db, fields)
+		return
+	}
+	// Model(&u).Updates(UcUser{...}) 更新的值在Dest中
+	rv := reflect.Indirect(reflect.ValueOf(stmt.Dest))
+	if rv.Kind() != reflect.Struct || rv.Type() != stmt.Schema.ModelType {
+		return
+	}
+	for _, ef := range fields {
+		if ef.index == nil || !selected(stmt, ef.field) {
+			continue
+		}
+		plain := ef.field.ReflectValueOf(stmt.Context, rv).String()
+		// 没有Select时只更新非零值字段, 加密字段为空时不更新盲索引
+		if plain == "" && len(stmt.Selects) == 0 {
+			continue
+		}
+		index, err := blindIndex(ef.field.DBName, plain)
+		if err != nil {
+			_ = db.AddError(err)
+			return
+		}
+		stmt.SetColumn(ef.index.DBName, index)
+		if len(stmt.Selects) > 0 {
+			stmt.Selects = append(stmt.Selects, ef.index.DBName)
+		}
+	}
+}
+
+// setIndexes 创建时按结构体中的明文设置盲索引
+func (p *Plugin) setIndexes(db *gorm.DB, fields []encryptedField, rv reflect.Value) {
+	ctx := db.Statement.Context
+	for _, ef := range fields {
+		if ef.index == nil {
+			continue
+		}
+		index, err := blindIndex(ef.field.DBName, ef.field.ReflectValueOf(ctx, rv).String())
+		if err != nil {
+			_ = db.AddError(err)
+			return
+		}
+		if err = ef.index.Set(ctx, rv, index); err != nil {
+			_ = db.AddError(errors.WithStack(err))
+			return
+		}
+	}
+}
+
+// encryptMap 复制map, 加密字段的值替换为密文, 并设置盲索引
+func (p *Plugin) encryptMap(db *gorm.DB, fields []encryptedField) {
+	stmt := db.Statement
+	src, ok := stmt.Dest.(map[string]any)
+	if !ok {
+		return
+	}
+	values := make(map[string]any, len(src)+len(fields))
+	for k, v := range src {
+		values[k] = v
+	}
+	for _, ef := range fields {
+		key := ef.field.DBName
+		v, ok := values[key]
+		if !ok {
+			if v, ok = values[ef.field.Name]; !ok {
+				continue
+			}
+			key = ef.field.Name
+		}
+		plain, ok := v.(string)
+		if !ok {
+			_ = db.AddError(errors.Errorf("encrypt: %s must be a string", ef.field.Name))
+			return
+		}
+		cipherText, err := encryptString(plain)
+		if err != nil {
+			_ = db.AddError(err)
+			return
+		}
+		values[key] = cipherText
+		if ef.index == nil {
+			continue
+		}
+		index, err := blindIndex(ef.field.DBName, plain)
+		if err != nil {
+			_ = db.AddError(err)
+			return
+		}
+		values[ef.index.DBName] = index
+		if len(stmt.Selects) > 0 {
+			stmt.Selects = append(stmt.Selects, ef.index.DBName)
+		}
+	}
+	stmt.Dest = values
+}
+
+// selected 字段是否会被更新, 没有Select时都会更新
+func selected(stmt *gorm.Statement, field *schema.Field) bool {
+	if len(stmt.Selects) == 0 {
+		return true
+	}
+	for _, s := range stmt.Selects {
+		if s == "*" || s == field.Name || s == field.DBName {
+			return true
+		}
+	}
+	return false
+}
+
+// Eq 按盲索引等值查询加密字段, name为加密字段的字段名或列名, 需要先调用Model; value为空时不匹配任何数据
+//
+//	db.Model(&model.UcUser{}).Scopes(encrypt.Eq("phone", "13800000000")).Take(&u)
+func Eq(name, value string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		stmt := db.Statement
+		if stmt.Schema == nil {
+			if err := stmt.Parse(stmt.Model); err != nil {
+				_ = db.AddError(errors.WithStack(err))
+				return db
+			}
+		}
+		var indexField *schema.Field
+		field := stmt.Schema.LookUpField(name)
+		if field != nil {
+			indexField = stmt.Schema.LookUpField(field.Tag.Get(BlindIndexTag))
+		}
+		if indexField == nil {
+			_ = db.AddError(errors.Errorf("encrypt: %s.%s has no blind index", stmt.Schema.Name, name))
+			return db
+		}
+		// 空值不加密也没有盲索引, 不能匹配盲索引为空的数据
+		if value == "" {
+			return db.Where(clause.Expr{SQL: "1 = 0"})
+		}
+		index, err := blindIndex(field.DBName, value)
+		if err != nil {
+			_ = db.AddError(err)
+			return db
+		}
+		return db.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: indexField.DBName}, Value: index})
+	}
+}
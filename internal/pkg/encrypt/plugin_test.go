@@ -0,0 +1,43 @@
+package encrypt
+
+import (
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestEq(t *testing.T) {
+	k, err := NewKeyring("k1", map[string][]byte{"k1": []byte("0123456789abcdef")}, []byte("index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetKeyring(k)
+	t.Cleanup(func() { SetKeyring(nil) })
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err = db.Use(New()); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&sealedRow{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Create([]*sealedRow{{ID: 1, Phone: "13800138000"}, {ID: 2}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	for phone, want := range map[string]int{"13800138000": 1, "13900139000": 0, "": 0} {
+		var rows []sealedRow
+		if err = db.Model(&sealedRow{}).Scopes(Eq("phone", phone)).Find(&rows).Error; err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != want || (want == 1 && rows[0].Phone != phone) {
+			t.Errorf("eq %q got %+v", phone, rows)
+		}
+	}
+}
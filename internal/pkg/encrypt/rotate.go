@@ -0,0 +1,145 @@
+package encrypt
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RotateResult 一张表重新加密的结果
+type RotateResult struct {
+	Table   string
+	Scanned int64 // 读取的行数
+	Updated int64 // 重新加密或重建盲索引的行数
+	Skipped int64 // 读取后被其他请求修改, 跳过的行数, 可以再执行一次
+}
+
+// Rotate 按主键分批遍历model的表, 把不是current加密的字段用current重新加密, 并重建不一致的盲索引
+// 直接读写表, 不经过serializer和其他插件(软删除、租户、审计), 包含已软删除的数据;
+// 更新时带上读取到的密文作为条件, 与业务的并发修改冲突时跳过该行
+func Rotate(ctx context.Context, db *gorm.DB, model any, batchSize int, progress func(*RotateResult)) (*RotateResult, error) {
+	k := Default()
+	if k == nil {
+		return nil, errors.WithStack(ErrNoKeyring)
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	sch := stmt.Schema
+	if sch.PrioritizedPrimaryField == nil {
+		return nil, errors.Errorf("encrypt: %s has no primary key", sch.Name)
+	}
+	fields, err := encryptedFields(sch)
+	if err != nil {
+		return nil, err
+	}
+	res := &RotateResult{Table: sch.Table}
+	if len(fields) == 0 {
+		return res, nil
+	}
+	pk := sch.PrioritizedPrimaryField.DBName
+	columns := []string{pk}
+	for _, ef := range fields {
+		columns = append(columns, ef.field.DBName)
+		if ef.index != nil {
+			columns = append(columns, ef.index.DBName)
+		}
+	}
+
+	session := db.Session(&gorm.Session{NewDB: true, Context: ctx})
+	var last any
+	for {
+		if err = ctx.Err(); err != nil {
+			return res, errors.WithStack(err)
+		}
+		rows := make([]map[string]any, 0, batchSize)
+		q := session.Table(sch.Table).Select(columns).Order(pk).Limit(batchSize)
+		if last != nil {
+			q = q.Where(clause.Gt{Column: clause.Column{Name: pk}, Value: last})
+		}
+		if err = q.Find(&rows).Error; err != nil {
+			return res, errors.WithStack(err)
+		}
+		for _, row := range rows {
+			updated, err := rotateRow(session, k, sch.Table, pk, fields, row)
+			if err != nil {
+				return res, errors.WithMessagef(err, "%s %s=%v", sch.Table, pk, row[pk])
+			}
+			switch updated {
+			case 1:
+				res.Updated++
+			case -1:
+				res.Skipped++
+			}
+		}
+		res.Scanned += int64(len(rows))
+		if progress != nil && len(rows) > 0 {
+			progress(res)
+		}
+		if len(rows) < batchSize {
+			return res, nil
+		}
+		last = rows[len(rows)-1][pk]
+	}
+}
+
+// rotateRow 返回1为已更新, 0为不需要更新, -1为并发修改跳过
+func rotateRow(db *gorm.DB, k *Keyring, table, pk string, fields []encryptedField, row map[string]any) (int, error) {
+	updates := map[string]any{}
+	where := []clause.Expression{clause.Eq{Column: clause.Column{Name: pk}, Value: row[pk]}}
+	for _, ef := range fields {
+		column := ef.field.DBName
+		stored := toString(row[column])
+		plain, err := k.Decrypt(stored)
+		if err != nil {
+			return 0, errors.WithMessage(err, column)
+		}
+		if stored != "" && KeyID(stored) != k.Current() {
+			if updates[column], err = k.Encrypt(plain); err != nil {
+				return 0, err
+			}
+		}
+		if ef.index != nil {
+			index, err := k.BlindIndex(column, plain)
+			if err != nil {
+				return 0, err
+			}
+			if index != toString(row[ef.index.DBName]) {
+				updates[ef.index.DBName] = index
+			}
+		}
+		if row[column] == nil {
+			where = append(where, clause.Expr{SQL: "? IS NULL", Vars: []any{clause.Column{Name: column}}})
+		} else {
+			where = append(where, clause.Eq{Column: clause.Column{Name: column}, Value: row[column]})
+		}
+	}
+	if len(updates) == 0 {
+		return 0, nil
+	}
+	res := db.Table(table).Where(clause.And(where...)).Updates(updates)
+	if res.Error != nil {
+		return 0, errors.WithStack(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return -1, nil
+	}
+	return 1, nil
+}
+
+func toString(v any) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	default:
+		return fmt.Sprint(v)
+	}
+}
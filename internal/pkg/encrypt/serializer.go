@@ -0,0 +1,151 @@
+package encrypt
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	// SerializerName 字段tag serializer:encrypt
+	SerializerName = "encrypt"
+	// BlindIndexTag 盲索引字段的列名, 写入加密字段时同时写入盲索引
+	BlindIndexTag = "blind_index"
+)
+
+func init() {
+	schema.RegisterSerializer(SerializerName, Serializer{})
+}
+
+// Serializer gorm serializer, 加密string字段, 模型中添加tag即可:
+//
+//	type UcUser struct {
+//		Phone     string `gorm:"column:phone;serializer:encrypt" blind_index:"phone_bidx"`
+//		PhoneBidx string `gorm:"column:phone_bidx"`
+//	}
+//
+// 加密字段不能直接作为查询条件, 等值查询使用盲索引, 见Eq;
+// 模型写入缓存等数据库以外的地方时用Seal加密, 读取后用Open解密
+type Serializer struct{}
+
+// Scan 解密
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue any) error {
+	var s string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("encrypt: unsupported scan type %T for %s", dbValue, field.Name)
+	}
+	plain, err := decrypt(s)
+	if err != nil {
+		return errors.WithMessagef(err, "decrypt %s", field.Name)
+	}
+	fv := field.ReflectValueOf(ctx, dst)
+	if fv.Kind() != reflect.String {
+		return fmt.Errorf("encrypt: %s is not a string field", field.Name)
+	}
+	fv.SetString(plain)
+	return nil
+}
+
+// Value 加密
+func (Serializer) Value(_ context.Context, field *schema.Field, _ reflect.Value, fieldValue any) (any, error) {
+	plain, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("encrypt: %s is not a string field", field.Name)
+	}
+	return encryptString(plain)
+}
+
+func encryptString(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	k := Default()
+	if k == nil {
+		return "", errors.WithStack(ErrNoKeyring)
+	}
+	return k.Encrypt(plain)
+}
+
+func decrypt(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	k := Default()
+	if k == nil {
+		return "", errors.WithStack(ErrNoKeyring)
+	}
+	return k.Decrypt(s)
+}
+
+func blindIndex(column, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	k := Default()
+	if k == nil {
+		return "", errors.WithStack(ErrNoKeyring)
+	}
+	return k.BlindIndex(column, value)
+}
+
+// encryptedField 使用Serializer的字段和它的盲索引字段
+type encryptedField struct {
+	field *schema.Field
+	index *schema.Field // 没有盲索引时为nil
+}
+
+func encryptedFields(sch *schema.Schema) ([]encryptedField, error) {
+	list := make([]encryptedField, 0)
+	for _, f := range sch.Fields {
+		if _, ok := f.Serializer.(Serializer); !ok || f.DBName == "" {
+			continue
+		}
+		ef := encryptedField{field: f}
+		if name := f.Tag.Get(BlindIndexTag); name != "" {
+			if ef.index = sch.LookUpField(name); ef.index == nil {
+				return nil, errors.Errorf("encrypt: blind index %s of %s.%s not found", name, sch.Name, f.Name)
+			}
+		}
+		list = append(list, ef)
+	}
+	return list, nil
+}
+
+// Seal 加密模型v中使用Serializer的字段, v为模型的指针, 用于把模型写入缓存等数据库以外的地方
+func Seal(ctx context.Context, sch *schema.Schema, v any) error {
+	return convertFields(ctx, sch, v, encryptString)
+}
+
+// Open 解密Seal加密的字段
+func Open(ctx context.Context, sch *schema.Schema, v any) error {
+	return convertFields(ctx, sch, v, decrypt)
+}
+
+func convertFields(ctx context.Context, sch *schema.Schema, v any, convert func(string) (string, error)) error {
+	fields, err := encryptedFields(sch)
+	if err != nil {
+		return err
+	}
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	for _, ef := range fields {
+		fv := ef.field.ReflectValueOf(ctx, rv)
+		if fv.Kind() != reflect.String {
+			return fmt.Errorf("encrypt: %s is not a string field", ef.field.Name)
+		}
+		s, err := convert(fv.String())
+		if err != nil {
+			return errors.WithMessagef(err, "convert %s", ef.field.Name)
+		}
+		fv.SetString(s)
+	}
+	return nil
+}
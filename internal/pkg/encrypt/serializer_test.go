@@ -0,0 +1,56 @@
+package encrypt
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm/schema"
+)
+
+type sealedRow struct {
+	ID        uint64
+	Name      string
+	Phone     string `gorm:"column:phone;serializer:encrypt" blind_index:"phone_bidx"`
+	PhoneBidx string `gorm:"column:phone_bidx"`
+	Note      string `gorm:"serializer:encrypt"`
+}
+
+func TestSealOpen(t *testing.T) {
+	k, err := NewKeyring("k1", map[string][]byte{"k1": []byte("0123456789abcdef")}, []byte("index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetKeyring(k)
+	t.Cleanup(func() { SetKeyring(nil) })
+	sch, err := schema.Parse(&sealedRow{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	row := &sealedRow{ID: 1, Name: "n", Phone: "13800138000", PhoneBidx: "bidx"}
+	if err = Seal(ctx, sch, row); err != nil {
+		t.Fatal(err)
+	}
+	// 只加密serializer:encrypt的字段, 空字符串不加密
+	if !strings.HasPrefix(row.Phone, "k1:") || row.Name != "n" || row.PhoneBidx != "bidx" || row.Note != "" {
+		t.Fatalf("sealed got %+v", row)
+	}
+	if err = Open(ctx, sch, row); err != nil {
+		t.Fatal(err)
+	}
+	if *row != (sealedRow{ID: 1, Name: "n", Phone: "13800138000", PhoneBidx: "bidx"}) {
+		t.Fatalf("opened got %+v", row)
+	}
+
+	// 明文或其他密钥的密文不能解密
+	for _, phone := range []string{"13800138000", "k2:AAAA"} {
+		row = &sealedRow{Phone: phone}
+		if err = Open(ctx, sch, row); !errors.Is(err, ErrMalformed) && !errors.Is(err, ErrUnknownKey) {
+			t.Errorf("open %q got %v", phone, err)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"gin-layout/internal/pkg/redisx"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	logs "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultPrefix        = "gin_layout:lock:"
+	DefaultTTL           = 30 * time.Second
+	DefaultRetryInterval = 100 * time.Millisecond
+	DefaultWaitTimeout   = 10 * time.Second
+
+	// driftFactor redlock中各节点时钟漂移的比例
+	driftFactor = 0.01
+)
+
+var (
+	// ErrNotObtained 锁被其他持有者占用, 等待超时
+	ErrNotObtained = errors.New("lock: not obtained")
+	// ErrLost 续期失败, 锁已过期或被其他持有者获取
+	ErrLost = errors.New("lock: lost")
+)
+
+var (
+	// 只删除自己持有的锁, 防止锁过期被其他持有者获取后误删
+	releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+	// 只续期自己持有的锁
+	renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+)
+
+// Options 为零值的字段使用默认值
+type Options struct {
+	Prefix        string        // key的前缀
+	TTL           time.Duration // 锁的过期时间, 持有期间由watchdog每TTL/3续期一次, 进程退出后最多TTL后释放
+	RetryInterval time.Duration // 阻塞获取和续期出错时的重试间隔
+	WaitTimeout   time.Duration // WithLock的ctx没有deadline时最多等待的时间
+	Logger        *logs.Logger  // 记录续期、释放的错误
+}
+
+// Locker 基于redis的分布式锁, 传入多个相互独立的redis主节点时使用redlock算法,
+// 超过半数节点加锁成功才算获取成功
+//
+//	err := locker.WithLock(ctx, "uc_user:serial_number", func(ctx context.Context) error {
+//		...
+//	})
+type Locker struct {
+	clients []redisx.Client
+	opts    Options
+}
+
+// New clients为1个时为单节点锁, 多个时为redlock
+func New(opts Options, clients ...redisx.Client) *Locker {
+	if len(clients) == 0 {
+		panic("lock: no redis client")
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = DefaultPrefix
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTTL
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = DefaultRetryInterval
+	}
+	if opts.WaitTimeout <= 0 {
+		opts.WaitTimeout = DefaultWaitTimeout
+	}
+	return &Locker{clients: clients, opts: opts}
+}
+
+// Lock 已获取的锁, 获取后自动续期, 直到Release或续期失败
+type Lock struct {
+	locker *Locker
+	key    string
+	token  string
+
+	lost     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// TryAcquire 只尝试一次, 锁被占用时返回ErrNotObtained
+func (l *Locker) TryAcquire(ctx context.Context, key string) (*Lock, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	key = l.opts.Prefix + key
+	ok, err := l.acquire(ctx, key, token)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.WithStack(ErrNotObtained)
+	}
+	lock := &Lock{
+		locker: l,
+		key:    key,
+		token:  token,
+		lost:   make(chan struct{}),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go lock.watchdog()
+	return lock, nil
+}
+
+// Acquire 阻塞获取, 直到获取成功或ctx结束, ctx结束时返回ErrNotObtained
+func (l *Locker) Acquire(ctx context.Context, key string) (*Lock, error) {
+	ticker := time.NewTicker(l.opts.RetryInterval)
+	defer ticker.Stop()
+	for {
+		lock, err := l.TryAcquire(ctx, key)
+		if !errors.Is(err, ErrNotObtained) {
+			return lock, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, errors.WithMessage(ErrNotObtained, ctx.Err().Error())
+		case <-ticker.C:
+		}
+	}
+}
+
+// WithLock 获取锁后执行fn, fn返回后释放; 锁丢失时fn的ctx被取消
+// ctx没有deadline时最多等待WaitTimeout
+func (l *Locker) WithLock(ctx context.Context, key string, fn func(ctx context.Context) error) error {
+	waitCtx := ctx
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, l.opts.WaitTimeout)
+		defer cancel()
+	}
+	lock, err := l.Acquire(waitCtx, key)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// ctx可能已经取消, 使用新的ctx释放
+		releaseCtx, cancel := context.WithTimeout(context.Background(), l.opts.TTL/3)
+		defer cancel()
+		if err := lock.Release(releaseCtx); err != nil {
+			l.errorf("lock: release %s error: %v", lock.key, err)
+		}
+	}()
+
+	fnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-lock.Lost():
+			cancel()
+		case <-fnCtx.Done():
+		}
+	}()
+	if err = fn(fnCtx); err != nil {
+		return err
+	}
+	select {
+	case <-lock.Lost():
+		// fn执行期间锁已经丢失, 可能有其他持有者同时执行
+		return errors.WithStack(ErrLost)
+	default:
+		return nil
+	}
+}
+
+// Key 带前缀的key
+func (lk *Lock) Key() string {
+	return lk.key
+}
+
+// Lost 锁丢失时关闭: 锁已被其他持有者获取, 或在过期前一直续期失败
+func (lk *Lock) Lost() <-chan struct{} {
+	return lk.lost
+}
+
+// Release 停止续期并释放锁, 锁已经丢失时不报错
+func (lk *Lock) Release(ctx context.Context) error {
+	lk.stopOnce.Do(func() {
+		close(lk.stop)
+	})
+	<-lk.done
+	var err error
+	for _, c := range lk.locker.clients {
+		if e := releaseScript.Run(c.WithContext(ctx), []string{lk.key}, lk.token).Err(); e != nil {
+			err = e
+		}
+	}
+	return errors.WithStack(err)
+}
+
+// watchdog 每TTL/3续期一次; 节点出错时在锁过期前按RetryInterval重试,
+// 锁已被其他持有者获取或重试到过期仍失败时关闭lost
+func (lk *Lock) watchdog() {
+	defer close(lk.done)
+	opts := lk.locker.opts
+	ticker := time.NewTicker(opts.TTL / 3)
+	defer ticker.Stop()
+	// 最近一次加锁或续期成功后, 锁在redis中的过期时间
+	expiry := time.Now().Add(opts.TTL - lk.locker.drift())
+	for {
+		select {
+		case <-lk.stop:
+			return
+		case <-ticker.C:
+		}
+		for {
+			start := time.Now()
+			timeout := opts.TTL / 3
+			if remaining := time.Until(expiry); remaining < timeout {
+				timeout = remaining
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			ok, err := lk.locker.renew(ctx, lk.key, lk.token)
+			cancel()
+			if ok {
+				expiry = start.Add(opts.TTL - lk.locker.drift())
+				break
+			}
+			if err == nil || time.Until(expiry) <= opts.RetryInterval {
+				lk.locker.errorf("lock: renew %s failed, lock lost: %v", lk.key, err)
+				close(lk.lost)
+				return
+			}
+			lk.locker.errorf("lock: renew %s error, retry: %v", lk.key, err)
+			select {
+			case <-lk.stop:
+				return
+			case <-time.After(opts.RetryInterval):
+			}
+		}
+	}
+}
+
+// acquire 在所有节点上加锁, 单节点时加锁成功即可;
+// redlock需要超过半数节点成功, 且剩余的有效期为正, 否则释放已加的锁
+func (l *Locker) acquire(ctx context.Context, key, token string) (bool, error) {
+	if len(l.clients) == 1 {
+		ok, err := l.clients[0].WithContext(ctx).SetNX(key, token, l.opts.TTL).Result()
+		return ok, errors.WithStack(err)
+	}
+	start := time.Now()
+	n, failed := 0, 0
+	var err error
+	for _, c := range l.clients {
+		ok, e := c.WithContext(ctx).SetNX(key, token, l.opts.TTL).Result()
+		if e != nil {
+			err, failed = e, failed+1
+			continue
+		}
+		if ok {
+			n++
+		}
+	}
+	validity := l.opts.TTL - time.Since(start) - l.drift()
+	if n >= l.quorum() && validity > 0 {
+		return true, nil
+	}
+	for _, c := range l.clients {
+		releaseScript.Run(c.WithContext(ctx), []string{key}, token)
+	}
+	// 可用的节点不足半数时返回错误, 而不是当作锁被占用一直重试
+	if len(l.clients)-failed < l.quorum() {
+		return false, errors.WithStack(err)
+	}
+	return false, nil
+}
+
+// renew 续期, redlock需要超过半数节点成功;
+// 失败时, 超过半数节点上的锁已不属于自己返回nil, 否则返回节点的错误, 可以重试
+func (l *Locker) renew(ctx context.Context, key, token string) (bool, error) {
+	n, denied := 0, 0
+	var err error
+	for _, c := range l.clients {
+		res, e := renewScript.Run(c.WithContext(ctx), []string{key}, token, l.opts.TTL.Milliseconds()).Int64()
+		switch {
+		case e != nil:
+			err = e
+		case res == 1:
+			n++
+		default:
+			denied++
+		}
+	}
+	if n >= l.quorum() {
+		return true, nil
+	}
+	if len(l.clients)-denied < l.quorum() {
+		return false, nil
+	}
+	return false, errors.WithStack(err)
+}
+
+func (l *Locker) quorum() int {
+	return len(l.clients)/2 + 1
+}
+
+// drift 时钟漂移, 计算锁的有效期时减去
+func (l *Locker) drift() time.Duration {
+	return time.Duration(float64(l.opts.TTL)*driftFactor) + 2*time.Millisecond
+}
+
+func (l *Locker) errorf(format string, args ...any) {
+	if l.opts.Logger != nil {
+		l.opts.Logger.Errorf(format, args...)
+	}
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return hex.EncodeToString(b), nil
+}
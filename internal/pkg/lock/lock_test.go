@@ -0,0 +1,99 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"gin-layout/internal/pkg/redisx"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+)
+
+func newClient(t *testing.T) (*miniredis.Miniredis, redisx.Client) {
+	t.Helper()
+	m := miniredis.RunT(t)
+	c := redisx.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { _ = c.Close() })
+	return m, c
+}
+
+func TestTryAcquire(t *testing.T) {
+	m, c := newClient(t)
+	locker := New(Options{}, c)
+	ctx := context.Background()
+	a, err := locker.TryAcquire(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = locker.TryAcquire(ctx, "k"); !errors.Is(err, ErrNotObtained) {
+		t.Fatalf("got %v, want ErrNotObtained", err)
+	}
+	// 锁过期后被其他持有者获取, 原持有者释放时不能删除
+	m.FastForward(DefaultTTL)
+	b, err := locker.TryAcquire(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.Get(DefaultPrefix + "k"); got != b.token {
+		t.Fatalf("got %q, want the token of the new holder", got)
+	}
+	if err = b.Release(ctx); err != nil || m.Exists(DefaultPrefix+"k") {
+		t.Fatalf("release got %v", err)
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	m, c := newClient(t)
+	ttl := 300 * time.Millisecond
+	locker := New(Options{TTL: ttl, RetryInterval: 10 * time.Millisecond}, c)
+	err := locker.WithLock(context.Background(), "k", func(ctx context.Context) error {
+		// miniredis只在FastForward时减少过期时间, 续期后恢复为TTL
+		m.FastForward(200 * time.Millisecond)
+		time.Sleep(ttl / 3 * 2)
+		if got := m.TTL(DefaultPrefix + "k"); got <= 200*time.Millisecond {
+			t.Errorf("not renewed, ttl %v", got)
+		}
+		// 锁被删除后续期失败, fn的ctx被取消
+		m.Del(DefaultPrefix + "k")
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Error("ctx not canceled after the lock is lost")
+		}
+		return nil
+	})
+	if !errors.Is(err, ErrLost) {
+		t.Fatalf("got %v, want ErrLost", err)
+	}
+}
+
+func TestRedlock(t *testing.T) {
+	var ms []*miniredis.Miniredis
+	var clients []redisx.Client
+	for i := 0; i < 3; i++ {
+		m, c := newClient(t)
+		ms, clients = append(ms, m), append(clients, c)
+	}
+	locker := New(Options{}, clients...)
+	ctx := context.Background()
+	// 超过半数节点可用时可以获取
+	ms[0].Close()
+	lock, err := locker.TryAcquire(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = locker.TryAcquire(ctx, "k"); !errors.Is(err, ErrNotObtained) {
+		t.Fatalf("got %v, want ErrNotObtained", err)
+	}
+	_ = lock.Release(ctx)
+	// 可用的节点不足半数时返回节点的错误
+	ms[1].Close()
+	if _, err = locker.TryAcquire(ctx, "k"); err == nil || errors.Is(err, ErrNotObtained) {
+		t.Fatalf("got %v, want a redis error", err)
+	}
+}
@@ -0,0 +1,310 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"gin-layout/internal/pkg/dbresolver"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+const (
+	DefaultTable       = "schema_migrations"
+	DefaultLockTimeout = time.Minute
+
+	versionLayout = "20060102150405"
+)
+
+// Status 迁移状态
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+	Missing   bool // 已执行但代码中不存在
+}
+
+// record schema_migrations中的一行
+type record struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"size:255;not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// Migrator 执行迁移, 执行前获取数据库锁, 多个实例同时执行时串行
+//
+//	m := migrate.New(db, src)
+//	applied, err := m.Up(ctx, 0)
+type Migrator struct {
+	db          *gorm.DB
+	source      *Source
+	table       string
+	lockTimeout time.Duration
+	dryRun      io.Writer
+}
+
+// New .
+func New(db *gorm.DB, source *Source) *Migrator {
+	return &Migrator{
+		db:          db,
+		source:      source,
+		table:       DefaultTable,
+		lockTimeout: DefaultLockTimeout,
+	}
+}
+
+// DryRun 只把要执行的SQL输出到out, 不修改数据库
+func (m *Migrator) DryRun(out io.Writer) *Migrator {
+	c := *m
+	c.dryRun = out
+	return &c
+}
+
+// Up 按版本号升序执行未执行的迁移, steps<=0时执行全部, 返回执行的迁移
+func (m *Migrator) Up(ctx context.Context, steps int) ([]*Migration, error) {
+	done := make([]*Migration, 0)
+	err := m.locked(ctx, func(db *gorm.DB) error {
+		applied, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+		for _, mg := range m.source.List() {
+			if _, ok := applied[mg.Version]; ok {
+				continue
+			}
+			if steps > 0 && len(done) >= steps {
+				break
+			}
+			if !mg.hasSQL(db.Dialector.Name(), true) && mg.Up == nil {
+				return errors.Errorf("migrate: %d_%s has no up migration", mg.Version, mg.Name)
+			}
+			if err = m.apply(db, mg, true); err != nil {
+				return err
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down 按版本号降序回滚已执行的迁移, steps<=0时回滚1个, 返回回滚的迁移
+func (m *Migrator) Down(ctx context.Context, steps int) ([]*Migration, error) {
+	if steps <= 0 {
+		steps = 1
+	}
+	done := make([]*Migration, 0)
+	err := m.locked(ctx, func(db *gorm.DB) error {
+		applied, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+		list := m.source.List()
+		for i := len(list) - 1; i >= 0 && len(done) < steps; i-- {
+			mg := list[i]
+			if _, ok := applied[mg.Version]; !ok {
+				continue
+			}
+			if !mg.hasSQL(db.Dialector.Name(), false) && mg.Down == nil {
+				return errors.Errorf("migrate: %d_%s is irreversible", mg.Version, mg.Name)
+			}
+			if err = m.apply(db, mg, false); err != nil {
+				return err
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status 所有迁移的执行状态, 按版本号升序
+func (m *Migrator) Status(ctx context.Context) ([]*Status, error) {
+	applied, err := m.applied(m.session(ctx))
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*Status, 0)
+	for _, mg := range m.source.List() {
+		s := &Status{Version: mg.Version, Name: mg.Name}
+		if r, ok := applied[mg.Version]; ok {
+			s.Applied, s.AppliedAt = true, &r.AppliedAt
+			delete(applied, mg.Version)
+		}
+		list = append(list, s)
+	}
+	for _, r := range applied {
+		appliedAt := r.AppliedAt
+		list = append(list, &Status{Version: r.Version, Name: r.Name, Applied: true, AppliedAt: &appliedAt, Missing: true})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+	return list, nil
+}
+
+// Create 在dir下创建空的up/down迁移文件, 版本号为当前时间, 返回创建的文件
+func Create(dir, name string) ([]string, error) {
+	if !nameRegexp.MatchString(name) {
+		return nil, errors.Errorf("migrate: name must match %s", nameRegexp)
+	}
+	version := time.Now().Format(versionLayout)
+	files := make([]string, 0, 2)
+	for _, direction := range []string{"up", "down"} {
+		file := filepath.Join(dir, fmt.Sprintf("%s_%s.%s.sql", version, name, direction))
+		content := fmt.Sprintf("-- %s %s\n", name, direction)
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			return files, errors.WithStack(err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// session 迁移始终使用主库
+func (m *Migrator) session(ctx context.Context) *gorm.DB {
+	return m.db.WithContext(dbresolver.UsePrimary(ctx))
+}
+
+// locked 在同一个连接上获取锁后执行fn, dry-run时不加锁也不创建迁移表
+func (m *Migrator) locked(ctx context.Context, fn func(db *gorm.DB) error) error {
+	db := m.session(ctx)
+	if m.dryRun != nil {
+		return fn(db)
+	}
+	return errors.WithStack(db.Connection(func(conn *gorm.DB) error {
+		unlock, err := m.lock(conn)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		if err = conn.Table(m.table).AutoMigrate(&record{}); err != nil {
+			return err
+		}
+		return fn(conn)
+	}))
+}
+
+// lock 获取数据库级别的锁, 锁与连接绑定
+func (m *Migrator) lock(conn *gorm.DB) (func(), error) {
+	switch conn.Dialector.Name() {
+	case "mysql":
+		var got int
+		if err := conn.Raw("SELECT GET_LOCK(?, ?)", m.table, int(m.lockTimeout/time.Second)).Scan(&got).Error; err != nil {
+			return nil, err
+		}
+		if got != 1 {
+			return nil, errors.Errorf("migrate: wait for lock %s timeout", m.table)
+		}
+		return func() {
+			conn.Exec("SELECT RELEASE_LOCK(?)", m.table)
+		}, nil
+	case "postgres":
+		// pg_advisory_lock没有超时, 使用pg_try_advisory_lock轮询
+		deadline := time.Now().Add(m.lockTimeout)
+		for {
+			var got bool
+			if err := conn.Raw("SELECT pg_try_advisory_lock(hashtext(?))", m.table).Scan(&got).Error; err != nil {
+				return nil, err
+			}
+			if got {
+				break
+			}
+			if time.Now().After(deadline) {
+				return nil, errors.Errorf("migrate: wait for lock %s timeout", m.table)
+			}
+			time.Sleep(time.Second)
+		}
+		return func() {
+			conn.Exec("SELECT pg_advisory_unlock(hashtext(?))", m.table)
+		}, nil
+	default:
+		// sqlite为单文件数据库, 不需要跨实例加锁
+		return func() {}, nil
+	}
+}
+
+// applied 已执行的迁移, 迁移表不存在时为空
+func (m *Migrator) applied(db *gorm.DB) (map[int64]*record, error) {
+	res := make(map[int64]*record)
+	// HasTable不返回错误, 先确认数据库可用, 避免把连接失败当成没有执行过迁移
+	var one int
+	if err := db.Raw("SELECT 1").Scan(&one).Error; err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !db.Migrator().HasTable(m.table) {
+		return res, nil
+	}
+	list := make([]*record, 0)
+	if err := db.Table(m.table).Find(&list).Error; err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, r := range list {
+		res[r.Version] = r
+	}
+	return res, nil
+}
+
+// apply 在事务中执行一个迁移并记录版本, mysql的DDL会隐式提交, 无法随事务回滚
+func (m *Migrator) apply(db *gorm.DB, mg *Migration, up bool) error {
+	content, fn := mg.SQL(db.Dialector.Name(), up), mg.Up
+	if !up {
+		fn = mg.Down
+	}
+	run := func(tx *gorm.DB) error {
+		for _, statement := range splitStatements(content) {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		if fn != nil {
+			if err := fn(tx); err != nil {
+				return err
+			}
+		}
+		if up {
+			return tx.Table(m.table).Create(&record{Version: mg.Version, Name: mg.Name, AppliedAt: time.Now()}).Error
+		}
+		return tx.Table(m.table).Where("version = ?", mg.Version).Delete(&record{}).Error
+	}
+
+	if m.dryRun != nil {
+		direction := "up"
+		if !up {
+			direction = "down"
+		}
+		fmt.Fprintf(m.dryRun, "-- %d_%s %s\n", mg.Version, mg.Name, direction)
+		return run(db.Session(&gorm.Session{DryRun: true, SkipDefaultTransaction: true, Logger: &dryRunLogger{out: m.dryRun}}))
+	}
+	if err := db.Transaction(run); err != nil {
+		return errors.WithMessagef(err, "migrate: %d_%s", mg.Version, mg.Name)
+	}
+	return nil
+}
+
+// dryRunLogger dry-run时输出生成的SQL
+type dryRunLogger struct {
+	out io.Writer
+}
+
+func (l *dryRunLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return l
+}
+
+func (l *dryRunLogger) Info(context.Context, string, ...interface{}) {}
+
+func (l *dryRunLogger) Warn(context.Context, string, ...interface{}) {}
+
+func (l *dryRunLogger) Error(context.Context, string, ...interface{}) {}
+
+func (l *dryRunLogger) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	fmt.Fprintf(l.out, "%s;\n", sql)
+}
@@ -0,0 +1,176 @@
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Func Go编写的迁移, tx为事务, dry-run时为不执行的会话
+type Func func(tx *gorm.DB) error
+
+// Migration 一个版本的迁移, Up/Down为Go迁移, UpSQL/DownSQL为SQL迁移, 同时存在时先执行SQL
+type Migration struct {
+	Version int64
+	Name    string
+	UpSQL   string
+	DownSQL string
+	Up      Func
+	Down    Func
+
+	// dialects 指定方言的SQL, 优先于UpSQL/DownSQL, key为gorm方言名称
+	dialects map[string]*dialectSQL
+}
+
+type dialectSQL struct {
+	up, down string
+}
+
+// SQL 返回指定方言的SQL, 没有该方言的文件时使用通用的SQL
+func (mg *Migration) SQL(dialect string, up bool) string {
+	if d, ok := mg.dialects[dialect]; ok {
+		if up {
+			return d.up
+		}
+		return d.down
+	}
+	if up {
+		return mg.UpSQL
+	}
+	return mg.DownSQL
+}
+
+// hasSQL 指定方言是否有SQL迁移
+func (mg *Migration) hasSQL(dialect string, up bool) bool {
+	return mg.SQL(dialect, up) != ""
+}
+
+// Source 迁移集合, 按版本号排序执行
+type Source struct {
+	migrations map[int64]*Migration
+}
+
+var (
+	// 20260101120000_create_uc_users.up.sql, 指定方言: 20260101120000_create_uc_users.up.postgres.sql
+	fileRegexp = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)(?:\.(mysql|postgres|sqlite))?\.sql$`)
+	nameRegexp = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// NewSource .
+func NewSource() *Source {
+	return &Source{migrations: make(map[int64]*Migration)}
+}
+
+// AddFS 添加目录下的SQL迁移, 文件名格式为 {version}_{name}.up.sql 和 {version}_{name}.down.sql,
+// 不同数据库的SQL不同时使用 {version}_{name}.up.{dialect}.sql, dialect为 mysql postgres sqlite
+func (s *Source) AddFS(fsys fs.FS) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		m := fileRegexp.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return fmt.Errorf("migrate: invalid file name %s", entry.Name())
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("migrate: invalid version %s", entry.Name())
+		}
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return err
+		}
+		mg, err := s.get(version, m[2])
+		if err != nil {
+			return err
+		}
+		target := &mg.UpSQL
+		if m[3] == "down" {
+			target = &mg.DownSQL
+		}
+		if dialect := m[4]; dialect != "" {
+			if mg.dialects == nil {
+				mg.dialects = make(map[string]*dialectSQL)
+			}
+			if mg.dialects[dialect] == nil {
+				mg.dialects[dialect] = &dialectSQL{}
+			}
+			target = &mg.dialects[dialect].up
+			if m[3] == "down" {
+				target = &mg.dialects[dialect].down
+			}
+		}
+		*target = string(content)
+	}
+	return nil
+}
+
+// Add 添加Go迁移
+func (s *Source) Add(version int64, name string, up, down Func) error {
+	if !nameRegexp.MatchString(name) {
+		return fmt.Errorf("migrate: invalid name %s", name)
+	}
+	mg, err := s.get(version, name)
+	if err != nil {
+		return err
+	}
+	mg.Up, mg.Down = up, down
+	return nil
+}
+
+// List 按版本号升序
+func (s *Source) List() []*Migration {
+	list := make([]*Migration, 0, len(s.migrations))
+	for _, mg := range s.migrations {
+		list = append(list, mg)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+	return list
+}
+
+func (s *Source) get(version int64, name string) (*Migration, error) {
+	mg, ok := s.migrations[version]
+	if !ok {
+		mg = &Migration{Version: version, Name: name}
+		s.migrations[version] = mg
+		return mg, nil
+	}
+	if mg.Name != name {
+		return nil, fmt.Errorf("migrate: version %d is used by both %s and %s", version, mg.Name, name)
+	}
+	return mg, nil
+}
+
+// splitStatements 按行尾的分号拆分多条语句, mysql驱动默认不允许一次执行多条
+// 以 -- 开头的注释行会被忽略
+func splitStatements(content string) []string {
+	statements := make([]string, 0)
+	var sb strings.Builder
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(sb.String()), ";"))
+			sb.Reset()
+		}
+	}
+	if last := strings.TrimSpace(sb.String()); last != "" {
+		statements = append(statements, last)
+	}
+	return statements
+}
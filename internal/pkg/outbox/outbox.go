@@ -0,0 +1,80 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+const (
+	StatusPending int8 = 0 // 等待投递
+	StatusSent    int8 = 1 // 已投递
+	StatusDead    int8 = 2 // 超过最大次数仍然失败, 不再投递
+)
+
+// Record outbox表中的一条事件
+type Record struct {
+	ID            uint64     `gorm:"primaryKey"`
+	Topic         string     `gorm:"column:topic"`
+	Key           string     `gorm:"column:msg_key"` // 业务主键, 例如用户id, 消费方可以按key分区
+	Payload       string     `gorm:"column:payload"` // json
+	Status        int8       `gorm:"column:status"`
+	Attempts      int        `gorm:"column:attempts"`
+	NextAttemptAt time.Time  `gorm:"column:next_attempt_at"` // 下次投递时间, 被认领时为认领的过期时间
+	LockedBy      string     `gorm:"column:locked_by"`       // 认领的relay
+	LastError     string     `gorm:"column:last_error"`
+	CreatedAt     time.Time  `gorm:"column:created_at"`
+	SentAt        *time.Time `gorm:"column:sent_at"`
+}
+
+func (*Record) TableName() string {
+	return "outbox"
+}
+
+// Message 投递给Publisher的消息, 投递至少一次, 消费方需要按ID去重
+type Message struct {
+	ID        uint64
+	Topic     string
+	Key       string
+	Payload   []byte
+	CreatedAt time.Time
+}
+
+// Publisher 投递消息, 返回错误时按退避时间重试
+type Publisher interface {
+	Publish(ctx context.Context, msg *Message) error
+}
+
+// Add 写入一条待投递的事件, db一般为业务的事务, 与业务数据一起提交或回滚
+func Add(db *gorm.DB, topic, key string, payload any) (*Record, error) {
+	data, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(payload)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	now := time.Now()
+	r := &Record{
+		Topic:         topic,
+		Key:           key,
+		Payload:       string(data),
+		Status:        StatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	if err = db.Create(r).Error; err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return r, nil
+}
+
+func (r *Record) message() *Message {
+	return &Message{
+		ID:        r.ID,
+		Topic:     r.Topic,
+		Key:       r.Key,
+		Payload:   []byte(r.Payload),
+		CreatedAt: r.CreatedAt,
+	}
+}
@@ -0,0 +1,96 @@
+package outbox
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	fasthttp "gin-layout/internal/pkg/httpRequest"
+	"gin-layout/internal/pkg/redisx"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultStreamPrefix   = "gin_layout:events:"
+	DefaultWebhookTimeout = 3 * time.Second
+)
+
+// RedisStreamPublisher 每个topic一个stream, 消费方使用XREADGROUP消费
+type RedisStreamPublisher struct {
+	rdb    redisx.Client
+	prefix string
+	maxLen int64
+}
+
+// NewRedisStreamPublisher prefix为空时使用DefaultStreamPrefix, maxLen>0时近似裁剪stream的长度
+func NewRedisStreamPublisher(rdb redisx.Client, prefix string, maxLen int64) *RedisStreamPublisher {
+	if prefix == "" {
+		prefix = DefaultStreamPrefix
+	}
+	return &RedisStreamPublisher{rdb: rdb, prefix: prefix, maxLen: maxLen}
+}
+
+func (p *RedisStreamPublisher) Publish(ctx context.Context, msg *Message) error {
+	return errors.WithStack(p.rdb.WithContext(ctx).XAdd(&redis.XAddArgs{
+		Stream:       p.prefix + msg.Topic,
+		MaxLenApprox: p.maxLen,
+		Values: map[string]any{
+			"id":         msg.ID,
+			"topic":      msg.Topic,
+			"key":        msg.Key,
+			"payload":    string(msg.Payload),
+			"created_at": msg.CreatedAt.UnixMilli(),
+		},
+	}).Err())
+}
+
+// WebhookPublisher 以json POST到url, 返回2xx为成功
+// 配置了secret时, X-Outbox-Signature为body的hmac-sha256(hex)
+type WebhookPublisher struct {
+	url     string
+	secret  string
+	timeout time.Duration
+}
+
+// NewWebhookPublisher timeout<=0时使用DefaultWebhookTimeout
+func NewWebhookPublisher(url, secret string, timeout time.Duration) *WebhookPublisher {
+	if timeout <= 0 {
+		timeout = DefaultWebhookTimeout
+	}
+	return &WebhookPublisher{url: url, secret: secret, timeout: timeout}
+}
+
+func (p *WebhookPublisher) Publish(_ context.Context, msg *Message) error {
+	body, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(map[string]any{
+		"id":         msg.ID,
+		"topic":      msg.Topic,
+		"key":        msg.Key,
+		"payload":    jsoniter.RawMessage(msg.Payload),
+		"created_at": msg.CreatedAt.UnixMilli(),
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	client := fasthttp.NewClient().
+		SetTimeout(p.timeout).
+		AddHeader("X-Outbox-Id", strconv.FormatUint(msg.ID, 10)).
+		AddBodyBytes(body)
+	if p.secret != "" {
+		mac := hmac.New(sha256.New, []byte(p.secret))
+		mac.Write(body)
+		client.AddHeader("X-Outbox-Signature", hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := client.PostJson(p.url)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("webhook status %d: %s", resp.StatusCode, resp.Body)
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"gin-layout/internal/pkg/dbresolver"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	logs "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+const (
+	DefaultInterval    = time.Second
+	DefaultBatchSize   = 100
+	DefaultMaxAttempts = 10
+	DefaultBackoff     = time.Second
+	DefaultMaxBackoff  = 10 * time.Minute
+	DefaultLease       = time.Minute
+	DefaultRetention   = 7 * 24 * time.Hour
+
+	cleanupInterval = time.Hour
+	maxErrorLength  = 1024
+)
+
+// Options 为零值的字段使用默认值
+type Options struct {
+	Interval    time.Duration // 轮询间隔
+	BatchSize   int           // 每次认领的条数
+	MaxAttempts int           // 投递失败的最大次数, 超过后标记为StatusDead
+	Backoff     time.Duration // 第一次重试的间隔, 之后每次翻倍
+	MaxBackoff  time.Duration // 重试间隔的上限
+	Lease       time.Duration // 认领后的处理时限, relay崩溃时超过后由其他relay重新认领
+	Retention   time.Duration // 已投递的事件保留的时间, <0时不清理
+}
+
+// Relay 轮询outbox表, 把待投递的事件交给Publisher
+// 多个实例同时运行时通过更新locked_by认领, 同一条事件同时只有一个relay处理;
+// 投递至少一次, 失败重试时不保证顺序
+//
+//	relay := outbox.NewRelay(db, outbox.NewRedisStreamPublisher(rdb, "", 0), outbox.Options{}, logger)
+//	relay.Start()
+//	defer relay.Stop()
+type Relay struct {
+	db        *gorm.DB
+	publisher Publisher
+	opts      Options
+	logger    *logs.Entry
+	id        string
+
+	notify    chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewRelay .
+func NewRelay(db *gorm.DB, publisher Publisher, opts Options, logger *logs.Logger) *Relay {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = DefaultLease
+	}
+	if opts.Retention == 0 {
+		opts.Retention = DefaultRetention
+	}
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return &Relay{
+		db:        db,
+		publisher: publisher,
+		opts:      opts,
+		logger:    logger.WithField("job", "outbox_relay"),
+		id:        hex.EncodeToString(b),
+		notify:    make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start 开始轮询, 重复调用只启动一次
+func (r *Relay) Start() {
+	r.startOnce.Do(func() {
+		go r.run()
+	})
+}
+
+// Stop 停止轮询, 等待正在投递的批次完成
+func (r *Relay) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+	started := true
+	r.startOnce.Do(func() {
+		started = false
+	})
+	if started {
+		<-r.done
+	}
+}
+
+// Notify 有新的事件提交, 立即投递而不用等下一次轮询
+func (r *Relay) Notify() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Relay) run() {
+	defer close(r.done)
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), "logger", r.logger))
+	defer cancel()
+	go func() {
+		select {
+		case <-r.stop:
+			cancel()
+		case <-r.done:
+		}
+	}()
+
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+	lastCleanup := time.Time{}
+	for {
+		// 一批满了说明还有积压, 继续投递
+		for ctx.Err() == nil {
+			n, err := r.RunOnce(ctx)
+			if err != nil {
+				r.logger.Errorf("outbox relay error: %+v", err)
+				break
+			}
+			if n < r.opts.BatchSize {
+				break
+			}
+		}
+		if r.opts.Retention > 0 && time.Since(lastCleanup) > cleanupInterval {
+			lastCleanup = time.Now()
+			if n, err := r.cleanup(ctx); err != nil {
+				r.logger.Errorf("outbox cleanup error: %+v", err)
+			} else if n > 0 {
+				r.logger.Infof("outbox cleanup: %d sent events deleted", n)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.notify:
+		}
+	}
+}
+
+// RunOnce 认领一批到期的事件并投递, 返回认领的条数
+func (r *Relay) RunOnce(ctx context.Context) (int, error) {
+	list, err := r.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, record := range list {
+		if ctx.Err() != nil {
+			// 未投递的事件在认领过期后重新投递
+			break
+		}
+		r.deliver(ctx, record)
+	}
+	return len(list), nil
+}
+
+// claim 先查出到期的id, 再带着相同的条件更新locked_by, 只有更新成功的才属于当前relay
+// 更新时把next_attempt_at推后Lease, relay崩溃时事件在Lease后被重新认领
+func (r *Relay) claim(ctx context.Context) ([]*Record, error) {
+	db := r.session(ctx)
+	now := time.Now()
+	var ids []uint64
+	err := db.Model(&Record{}).
+		Where("status = ? AND next_attempt_at <= ?", StatusPending, now).
+		Order("id").Limit(r.opts.BatchSize).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return nil, errors.WithStack(err)
+	}
+	token := r.id + "-" + strconv.FormatInt(now.UnixNano(), 36)
+	err = db.Model(&Record{}).
+		Where("id IN ? AND status = ? AND next_attempt_at <= ?", ids, StatusPending, now).
+		Updates(map[string]any{"locked_by": token, "next_attempt_at": now.Add(r.opts.Lease)}).Error
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	list := make([]*Record, 0, len(ids))
+	err = db.Where("id IN ? AND locked_by = ? AND status = ?", ids, token, StatusPending).
+		Order("id").Find(&list).Error
+	return list, errors.WithStack(err)
+}
+
+// deliver 投递一条事件, 成功标记为已投递, 失败按指数退避重试, 超过MaxAttempts标记为StatusDead
+func (r *Relay) deliver(ctx context.Context, record *Record) {
+	err := r.publisher.Publish(ctx, record.message())
+	now := time.Now()
+	updates := map[string]any{"attempts": record.Attempts + 1}
+	switch {
+	case err == nil:
+		updates["status"], updates["sent_at"], updates["last_error"] = StatusSent, now, ""
+	case record.Attempts+1 >= r.opts.MaxAttempts:
+		updates["status"], updates["last_error"] = StatusDead, truncate(err.Error())
+		r.logger.Errorf("outbox event %d (%s) dead after %d attempts: %v", record.ID, record.Topic, record.Attempts+1, err)
+	default:
+		updates["next_attempt_at"], updates["last_error"] = now.Add(r.backoff(record.Attempts)), truncate(err.Error())
+		r.logger.Warnf("outbox event %d (%s) attempt %d failed: %v", record.ID, record.Topic, record.Attempts+1, err)
+	}
+	// locked_by不变说明认领没有过期, 没有被其他relay重新认领; 停止时ctx已取消, 仍然要记录投递结果
+	e := r.session(context.Background()).Model(&Record{}).
+		Where("id = ? AND locked_by = ?", record.ID, record.LockedBy).
+		Updates(updates).Error
+	if e != nil {
+		r.logger.Errorf("outbox event %d update error: %+v", record.ID, e)
+	}
+}
+
+// cleanup 分批删除超过保留时间的已投递事件
+func (r *Relay) cleanup(ctx context.Context) (int64, error) {
+	db := r.session(ctx)
+	before := time.Now().Add(-r.opts.Retention)
+	var total int64
+	for ctx.Err() == nil {
+		var ids []uint64
+		err := db.Model(&Record{}).
+			Where("status = ? AND sent_at < ?", StatusSent, before).
+			Limit(r.opts.BatchSize).Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return total, errors.WithStack(err)
+		}
+		res := db.Where("id IN ?", ids).Delete(&Record{})
+		total += res.RowsAffected
+		if res.Error != nil {
+			return total, errors.WithStack(res.Error)
+		}
+	}
+	return total, nil
+}
+
+// session 使用主库, 认领后立即读取不能读从库; 轮询的SQL只记录警告以上的日志
+func (r *Relay) session(ctx context.Context) *gorm.DB {
+	return r.db.Session(&gorm.Session{
+		Context: dbresolver.UsePrimary(ctx),
+		Logger:  r.db.Logger.LogMode(gormlogger.Warn),
+	})
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	backoff := r.opts.Backoff
+	for i := 0; i < attempts && backoff < r.opts.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > r.opts.MaxBackoff {
+		backoff = r.opts.MaxBackoff
+	}
+	return backoff
+}
+
+func truncate(s string) string {
+	if len(s) > maxErrorLength {
+		return s[:maxErrorLength]
+	}
+	return s
+}
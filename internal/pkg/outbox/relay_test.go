@@ -0,0 +1,105 @@
+package outbox
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	logs "github.com/sirupsen/logrus"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type fakePublisher struct {
+	fail map[string]bool
+	sent []uint64
+}
+
+func (p *fakePublisher) Publish(_ context.Context, msg *Message) error {
+	if p.fail[msg.Topic] {
+		return errors.New("down")
+	}
+	p.sent = append(p.sent, msg.ID)
+	return nil
+}
+
+func TestRelay(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err = db.AutoMigrate(&Record{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, topic := range []string{"ok", "bad"} {
+		if _, err = Add(db, topic, "1", map[string]any{"topic": topic}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l := logs.New()
+	l.SetOutput(io.Discard)
+	pub := &fakePublisher{fail: map[string]bool{"bad": true}}
+	relay := NewRelay(db, pub, Options{MaxAttempts: 2, Backoff: time.Nanosecond, MaxBackoff: time.Nanosecond}, l)
+
+	status := func() map[string]Record {
+		var list []Record
+		if err := db.Find(&list).Error; err != nil {
+			t.Fatal(err)
+		}
+		m := make(map[string]Record, len(list))
+		for _, r := range list {
+			m[r.Topic] = r
+		}
+		return m
+	}
+	// 第一次投递失败后按退避时间重试, 超过MaxAttempts标记为StatusDead
+	for i, want := range []int8{StatusPending, StatusDead} {
+		if n, err := relay.RunOnce(context.Background()); err != nil || n != 2-i {
+			t.Fatalf("run %d: claimed %d, %v", i, n, err)
+		}
+		time.Sleep(time.Millisecond)
+		m := status()
+		if m["ok"].Status != StatusSent || m["ok"].SentAt == nil {
+			t.Fatalf("run %d: ok got %+v", i, m["ok"])
+		}
+		if bad := m["bad"]; bad.Status != want || bad.Attempts != i+1 || bad.LastError != "down" {
+			t.Fatalf("run %d: bad got %+v", i, bad)
+		}
+	}
+	if n, err := relay.RunOnce(context.Background()); err != nil || n != 0 || len(pub.sent) != 1 {
+		t.Fatalf("claimed %d, sent %v, %v", n, pub.sent, err)
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	var body []byte
+	var signature, id string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature, id = r.Header.Get("X-Outbox-Signature"), r.Header.Get("X-Outbox-Id")
+	}))
+	defer srv.Close()
+	msg := &Message{ID: 7, Topic: "t", Key: "k", Payload: []byte(`{"a":1}`), CreatedAt: time.UnixMilli(1000)}
+	if err := NewWebhookPublisher(srv.URL, "secret", 0).Publish(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	if id != "7" || signature != hex.EncodeToString(mac.Sum(nil)) {
+		t.Fatalf("got id %q signature %q body %s", id, signature, body)
+	}
+	if string(body) != `{"created_at":1000,"id":7,"key":"k","payload":{"a":1},"topic":"t"}` {
+		t.Fatalf("got body %s", body)
+	}
+}
@@ -0,0 +1,207 @@
+package page
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
+)
+
+const (
+	// CountConcurrent count and select run concurrently, fallback to sequential inside transaction
+	CountConcurrent = "concurrent"
+	// CountCached cache the total by the fingerprint of count sql, requires UseCountCache on the db
+	CountCached = "cached"
+	// CountEstimated use rows estimated by mysql when it is greater than EstimateThreshold, otherwise exact count.
+	// other dialects always use exact count
+	CountEstimated = "estimated"
+
+	DefaultCountCacheTTL     = time.Minute
+	DefaultEstimateThreshold = 100000
+
+	countCacheKeyPrefix  = "page:count:"
+	countCachePluginName = "page:count_cache"
+)
+
+// CountCache cache for CountCached, data layer implements it with redis
+type CountCache interface {
+	Get(ctx context.Context, key string) (int64, bool)
+	Set(ctx context.Context, key string, total int64, ttl time.Duration)
+}
+
+// countCachePlugin registered to gorm.DB, each db has its own cache and key prefix
+type countCachePlugin struct {
+	cache  CountCache
+	prefix string
+}
+
+func (p *countCachePlugin) Name() string {
+	return countCachePluginName
+}
+
+func (p *countCachePlugin) Initialize(*gorm.DB) error {
+	return nil
+}
+
+// UseCountCache set cache used by CountCached on db, CountCached works as exact count when not set.
+// namespace distinguishes databases, the same sql on different databases does not share the total
+func UseCountCache(db *gorm.DB, c CountCache, namespace string) error {
+	return db.Use(&countCachePlugin{cache: c, prefix: countCacheKeyPrefix + namespace + ":"})
+}
+
+// countCacheOf the cache registered by UseCountCache, nil if not set
+func countCacheOf(db *gorm.DB) *countCachePlugin {
+	p, _ := db.Config.Plugins[countCachePluginName].(*countCachePlugin)
+	return p
+}
+
+// count set page.Total according to page.CountStrategy
+func (q *Query) count(db *gorm.DB) (err error) {
+	page := q.page
+	switch page.CountStrategy {
+	case CountCached:
+		cc := countCacheOf(db)
+		if cc == nil {
+			break
+		}
+		ctx := q.context(db)
+		key := cc.prefix + countCacheKey(db)
+		if total, ok := cc.cache.Get(ctx, key); ok {
+			page.Total = total
+			return nil
+		}
+		if err = db.Count(&page.Total).Error; err != nil {
+			return
+		}
+		ttl := page.CountCacheTTL
+		if ttl <= 0 {
+			ttl = DefaultCountCacheTTL
+		}
+		cc.cache.Set(ctx, key, page.Total, ttl)
+		return nil
+	case CountEstimated:
+		threshold := page.EstimateThreshold
+		if threshold <= 0 {
+			threshold = DefaultEstimateThreshold
+		}
+		// 估算失败时使用精确count
+		if total, err := estimate(db); err == nil && total > threshold {
+			page.Total, page.Estimated = total, true
+			return nil
+		}
+	}
+	return db.Count(&page.Total).Error
+}
+
+// concurrent run count and select at the same time
+// the window is calculated once before the count and not corrected by total,
+// so Num is the page the rows belong to, page beyond the last one returns empty data
+func (q *Query) concurrent(db *gorm.DB, model any, exec execFunc) error {
+	page := q.page
+	page.Total = 0
+	limit, offset := page.Limit()
+	// 先解析model, 避免两个协程同时解析
+	if db.Statement.Model != nil {
+		if err := db.Statement.Parse(db.Statement.Model); err != nil {
+			return errors.New("parse model failed")
+		}
+	}
+
+	// 设置Context时Session会复制Statement, 每个协程使用独立的Statement
+	ctx := q.context(db)
+	countDB, listDB := db.Session(&gorm.Session{Context: ctx}), db.Session(&gorm.Session{Context: ctx})
+	var total int64
+	g := errgroup.Group{}
+	g.Go(func() error {
+		return countDB.Count(&total).Error
+	})
+	g.Go(func() error {
+		return q.list(listDB, model, exec, limit, offset)
+	})
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	page.Total = total
+	return nil
+}
+
+func (q *Query) context(db *gorm.DB) context.Context {
+	if db.Statement.Context != nil {
+		return db.Statement.Context
+	}
+	return q.page.ctx
+}
+
+// countCacheKey fingerprint of the count sql with vars
+func countCacheKey(db *gorm.DB) string {
+	sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		var n int64
+		return tx.Count(&n)
+	})
+	sum := sha1.Sum([]byte(sql))
+	return hex.EncodeToString(sum[:])
+}
+
+// estimate rows estimated by mysql: information_schema for the whole table, EXPLAIN for queries with conditions
+func estimate(db *gorm.DB) (int64, error) {
+	if db.Dialector.Name() != "mysql" {
+		return 0, fmt.Errorf("estimate is not supported by %s", db.Dialector.Name())
+	}
+	if db.Statement.Table == "" && db.Statement.Model != nil {
+		if err := db.Statement.Parse(db.Statement.Model); err != nil {
+			return 0, err
+		}
+	}
+	raw := db.Session(&gorm.Session{NewDB: true})
+
+	_, where := db.Statement.Clauses["WHERE"]
+	// 模型有软删除等默认查询条件时, 执行时才会加上where, 不能按整表估算
+	if !where && db.Statement.Schema != nil && len(db.Statement.Schema.QueryClauses) > 0 && !db.Statement.Unscoped {
+		where = true
+	}
+	if !where && len(db.Statement.Joins) == 0 && db.Statement.Table != "" {
+		var total int64
+		err := raw.Raw(
+			"SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?",
+			db.Statement.Table,
+		).Scan(&total).Error
+		return total, err
+	}
+
+	stmt := db.Session(&gorm.Session{DryRun: true}).Count(new(int64)).Statement
+	rows := make([]map[string]any, 0)
+	if err := raw.Raw("EXPLAIN "+stmt.SQL.String(), stmt.Vars...).Scan(&rows).Error; err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, fmt.Errorf("empty explain result")
+	}
+	// 第一行是驱动表, 估算行数 = rows * filtered%
+	total, err := strconv.ParseFloat(fmt.Sprint(bytesToString(rows[0]["rows"])), 64)
+	if err != nil {
+		return 0, err
+	}
+	if filtered, err := strconv.ParseFloat(fmt.Sprint(bytesToString(rows[0]["filtered"])), 64); err == nil && filtered > 0 {
+		total = total * filtered / 100
+	}
+	return int64(total), nil
+}
+
+func bytesToString(v any) any {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+// inTransaction the db is bound to a transaction, which can not be used concurrently
+func inTransaction(db *gorm.DB) bool {
+	_, ok := db.Statement.ConnPool.(gorm.TxCommitter)
+	return ok
+}
@@ -0,0 +1,118 @@
+package page
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mapCountCache struct {
+	mu   sync.Mutex
+	data map[string]int64
+}
+
+func (c *mapCountCache) Get(_ context.Context, key string) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	total, ok := c.data[key]
+	return total, ok
+}
+
+func (c *mapCountCache) Set(_ context.Context, key string, total int64, _ time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = total
+}
+
+func TestConcurrentWindow(t *testing.T) {
+	db := openTestDB(t)
+	seedItems(t, db, 25)
+	cases := []struct {
+		num, size uint64
+		wantNum   uint64
+		wantSize  uint64
+		wantIds   []uint64
+	}{
+		{num: 1, size: 10, wantNum: 1, wantSize: 10, wantIds: []uint64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{num: 3, size: 10, wantNum: 3, wantSize: 10, wantIds: []uint64{21, 22, 23, 24, 25}},
+		{num: 0, size: 0, wantNum: 1, wantSize: Size, wantIds: []uint64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		// 超出最后一页时页码保持请求的值, 与返回的空数据一致
+		{num: 5, size: 10, wantNum: 5, wantSize: 10},
+		{num: 30, size: 10, wantNum: 30, wantSize: 10},
+	}
+	for _, c := range cases {
+		p := &Page{Num: c.num, Size: c.size, CountStrategy: CountConcurrent}
+		var items []*cursorItem
+		if err := p.Query(db.Model(&cursorItem{}).Order("id")).Find(&items); err != nil {
+			t.Fatal(err)
+		}
+		if p.Total != 25 || p.Num != c.wantNum || p.Size != c.wantSize {
+			t.Errorf("num=%d size=%d: got total=%d num=%d size=%d", c.num, c.size, p.Total, p.Num, p.Size)
+		}
+		if got := idsOf(items); !equalIds(got, c.wantIds) {
+			t.Errorf("num=%d size=%d: got ids %v, want %v", c.num, c.size, got, c.wantIds)
+		}
+	}
+}
+
+func TestCountCachePerDB(t *testing.T) {
+	cache := &mapCountCache{data: map[string]int64{}}
+	for name, n := range map[string]int{"a": 3, "b": 7} {
+		t.Run(name, func(t *testing.T) {
+			db := openTestDB(t)
+			seedItems(t, db, n)
+			if err := UseCountCache(db, cache, name); err != nil {
+				t.Fatal(err)
+			}
+			// 第二次查询命中缓存, 新插入的数据不影响total
+			for i := 0; i < 2; i++ {
+				p := &Page{Num: 1, Size: 10, CountStrategy: CountCached}
+				var items []*cursorItem
+				if err := p.Query(db.Model(&cursorItem{})).Find(&items); err != nil {
+					t.Fatal(err)
+				}
+				if p.Total != int64(n) {
+					t.Fatalf("query %d: got total %d, want %d", i, p.Total, n)
+				}
+				if err := db.Create(&cursorItem{ID: uint64(100 + i)}).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+	// 两个db的SQL相同, key按db区分
+	if len(cache.data) != 2 {
+		t.Fatalf("want one key per db, got %v", cache.data)
+	}
+	for key := range cache.data {
+		if !strings.HasPrefix(key, countCacheKeyPrefix+"a:") && !strings.HasPrefix(key, countCacheKeyPrefix+"b:") {
+			t.Errorf("key %s is not scoped to the db", key)
+		}
+	}
+
+	// 未设置缓存的db使用精确count
+	db := openTestDB(t)
+	seedItems(t, db, 4)
+	p := &Page{Num: 1, Size: 10, CountStrategy: CountCached}
+	var items []*cursorItem
+	if err := p.Query(db.Model(&cursorItem{})).Find(&items); err != nil {
+		t.Fatal(err)
+	}
+	if p.Total != 4 || len(cache.data) != 2 {
+		t.Fatalf("got total %d, cache %v", p.Total, cache.data)
+	}
+}
+
+func equalIds(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,390 @@
+package page
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"gin-layout/pkg/errResponse"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	directionNext = "n"
+	directionPrev = "p"
+
+	valueTypeTime = "time"
+)
+
+var (
+	cursorSecret = randomSecret()
+	// 解析Scan目标结构体时使用的schema缓存
+	scanSchemaCache = &sync.Map{}
+)
+
+// SetCursorSecret 设置游标签名的密钥, 多实例部署时必须设置为相同的值
+// 不设置时使用进程启动时生成的随机密钥, 重启后之前的游标失效
+func SetCursorSecret(secret string) {
+	if secret != "" {
+		cursorSecret = []byte(secret)
+	}
+}
+
+func randomSecret() []byte {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return b
+}
+
+// sortKey 游标分页的一个排序字段
+type sortKey struct {
+	column clause.Column
+	desc   bool
+}
+
+// cursorPayload 游标的内容, 签名后base64编码
+type cursorPayload struct {
+	Direction string        `json:"d"`
+	Order     string        `json:"o"` // 排序字段的签名, 防止游标用在不同排序的查询上
+	Values    []cursorValue `json:"v"`
+}
+
+type cursorValue struct {
+	Type  string `json:"t,omitempty"`
+	Value any    `json:"v"`
+}
+
+// invalidCursor 游标无法解析或签名不正确
+func invalidCursor() error {
+	return errResponse.SetCustomizeErrMsgByReason(errResponse.ReasonParamsError, "invalid cursor")
+}
+
+// cursorFind 游标分页: 根据游标中上一页边界行的排序字段值生成WHERE, 多取一条判断是否还有数据, 不执行count
+func (q *Query) cursorFind(dest any, exec func(db *gorm.DB, dest any) *gorm.DB) (err error) {
+	page := q.page
+	db := q.db
+
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || (rv.IsNil() || rv.Elem().Kind() != reflect.Slice) {
+		return errors.New("model must be a pointer")
+	}
+	keys, err := sortKeys(db)
+	if err != nil {
+		return err
+	}
+	signature := orderSignature(keys)
+
+	direction := directionNext
+	var values []any
+	if page.Cursor != "" {
+		payload, err := decodeCursor(page.Cursor)
+		if err != nil || payload.Order != signature || len(payload.Values) != len(keys) {
+			return invalidCursor()
+		}
+		direction = payload.Direction
+		values = payload.values()
+	}
+	backward := direction == directionPrev
+
+	// 去掉原有的排序, 按游标方向重新排序
+	size := page.size()
+	tx := db.Session(&gorm.Session{}).Limit(size + 1)
+	delete(tx.Statement.Clauses, "ORDER BY")
+	if values != nil {
+		tx = tx.Where(keysetCondition(keys, values, backward))
+	}
+	for _, k := range keys {
+		tx = tx.Order(clause.OrderByColumn{Column: k.column, Desc: k.desc != backward})
+	}
+	if err = exec(tx, dest).Error; err != nil {
+		return
+	}
+
+	rows := rv.Elem()
+	more := rows.Len() > size
+	if more {
+		rows.Set(rows.Slice(0, size))
+	}
+	if backward {
+		reverse(rows)
+	}
+
+	page.Num, page.Size, page.Total = 0, uint64(size), 0
+	page.NextCursor, page.PrevCursor = "", ""
+	if rows.Len() > 0 {
+		first, last := rows.Index(0), rows.Index(rows.Len()-1)
+		// 向后翻页时, 有更多数据或者是从后一页翻过来的, 都说明后面还有数据
+		if (!backward && more) || (backward && values != nil) {
+			if page.NextCursor, err = encodeCursor(db, keys, last, directionNext, signature); err != nil {
+				return
+			}
+		}
+		if (backward && more) || (!backward && values != nil) {
+			if page.PrevCursor, err = encodeCursor(db, keys, first, directionPrev, signature); err != nil {
+				return
+			}
+		}
+	}
+	page.HasMore = more
+	return
+}
+
+// size 每页条数, 规则与Limit一致
+func (page *Page) size() int {
+	if page.Size < MinSize || page.Size > MaxSize {
+		return int(Size)
+	}
+	return int(page.Size)
+}
+
+// sortKeys 从查询的ORDER BY中解析排序字段, 没有排序时使用主键升序
+// 排序字段中不包含主键时追加主键, 保证排序唯一
+func sortKeys(db *gorm.DB) ([]sortKey, error) {
+	var keys []sortKey
+	if c, ok := db.Statement.Clauses["ORDER BY"]; ok {
+		if orderBy, ok := c.Expression.(clause.OrderBy); ok {
+			for _, col := range orderBy.Columns {
+				if !col.Column.Raw {
+					keys = append(keys, sortKey{column: col.Column, desc: col.Desc})
+					continue
+				}
+				raw, err := parseRawOrder(col.Column.Name)
+				if err != nil {
+					return nil, err
+				}
+				keys = append(keys, raw...)
+			}
+		}
+	}
+
+	primary := "id"
+	if db.Statement.Model != nil {
+		if err := db.Statement.Parse(db.Statement.Model); err != nil {
+			return nil, errors.New("parse model failed")
+		}
+		if f := db.Statement.Schema.PrioritizedPrimaryField; f != nil {
+			primary = f.DBName
+		}
+	}
+	for _, k := range keys {
+		if k.column.Name == primary {
+			return keys, nil
+		}
+	}
+	desc := len(keys) > 0 && keys[len(keys)-1].desc
+	return append(keys, sortKey{column: clause.Column{Table: db.Statement.Table, Name: primary}, desc: desc}), nil
+}
+
+// parseRawOrder 解析 "created_at DESC, `uc_users`.`id`" 这种字符串排序, 不支持表达式
+func parseRawOrder(raw string) ([]sortKey, error) {
+	var keys []sortKey
+	for _, item := range strings.Split(raw, ",") {
+		fields := strings.Fields(strings.NewReplacer("`", "", `"`, "").Replace(item))
+		if len(fields) == 0 || len(fields) > 2 || strings.ContainsAny(fields[0], "()") {
+			return nil, errors.New("cursor pagination only supports plain column ordering")
+		}
+		k := sortKey{}
+		if i := strings.LastIndexByte(fields[0], '.'); i >= 0 {
+			k.column = clause.Column{Table: fields[0][:i], Name: fields[0][i+1:]}
+		} else {
+			k.column = clause.Column{Name: fields[0]}
+		}
+		if len(fields) == 2 {
+			switch strings.ToUpper(fields[1]) {
+			case "ASC":
+			case "DESC":
+				k.desc = true
+			default:
+				return nil, errors.New("cursor pagination only supports plain column ordering")
+			}
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// keysetCondition (c1, c2, c3) 在游标之后的条件:
+// c1 > v1 OR (c1 = v1 AND c2 > v2) OR (c1 = v1 AND c2 = v2 AND c3 > v3), 降序字段使用 <, 向前翻页时反过来
+func keysetCondition(keys []sortKey, values []any, backward bool) clause.Expression {
+	ors := make([]clause.Expression, 0, len(keys))
+	for i, k := range keys {
+		ands := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, clause.Eq{Column: keys[j].column, Value: values[j]})
+		}
+		if k.desc != backward {
+			ands = append(ands, clause.Lt{Column: k.column, Value: values[i]})
+		} else {
+			ands = append(ands, clause.Gt{Column: k.column, Value: values[i]})
+		}
+		ors = append(ors, clause.And(ands...))
+	}
+	// 用And包一层, 否则gorm会把OrConditions和前面的where条件用OR连接
+	return clause.And(clause.Or(ors...))
+}
+
+func orderSignature(keys []sortKey) string {
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		part := k.column.Name
+		if k.desc {
+			part += " desc"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ",")
+}
+
+// encodeCursor 取行中排序字段的值生成游标
+func encodeCursor(db *gorm.DB, keys []sortKey, row reflect.Value, direction, signature string) (string, error) {
+	values, err := rowValues(db, keys, row)
+	if err != nil {
+		return "", err
+	}
+	payload := cursorPayload{Direction: direction, Order: signature}
+	for _, v := range values {
+		if t, ok := v.(time.Time); ok {
+			payload.Values = append(payload.Values, cursorValue{Type: valueTypeTime, Value: t.Format(time.RFC3339Nano)})
+			continue
+		}
+		payload.Values = append(payload.Values, cursorValue{Value: v})
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data) + "." + base64.RawURLEncoding.EncodeToString(sign(data)), nil
+}
+
+func decodeCursor(cursor string) (*cursorPayload, error) {
+	parts := strings.SplitN(cursor, ".", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("malformed cursor")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(mac, sign(data)) {
+		return nil, errors.New("cursor signature mismatch")
+	}
+	payload := &cursorPayload{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err = decoder.Decode(payload); err != nil {
+		return nil, err
+	}
+	if payload.Direction != directionNext && payload.Direction != directionPrev {
+		return nil, errors.New("malformed cursor")
+	}
+	return payload, nil
+}
+
+// values 还原游标中的值, 数字还原为int64/uint64/float64, 时间还原为time.Time
+func (p *cursorPayload) values() []any {
+	values := make([]any, 0, len(p.Values))
+	for _, cv := range p.Values {
+		switch v := cv.Value.(type) {
+		case json.Number:
+			values = append(values, numberValue(v))
+		case string:
+			if cv.Type == valueTypeTime {
+				if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+					values = append(values, t)
+					continue
+				}
+			}
+			values = append(values, v)
+		default:
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func numberValue(n json.Number) any {
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	if u, err := strconv.ParseUint(n.String(), 10, 64); err == nil {
+		return u
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return n.String()
+}
+
+func sign(data []byte) []byte {
+	h := hmac.New(sha256.New, cursorSecret)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// rowValues 取一行数据中排序字段的值, 行可以是结构体(指针)或map
+func rowValues(db *gorm.DB, keys []sortKey, row reflect.Value) ([]any, error) {
+	for row.Kind() == reflect.Ptr || row.Kind() == reflect.Interface {
+		row = row.Elem()
+	}
+	values := make([]any, 0, len(keys))
+	switch row.Kind() {
+	case reflect.Map:
+		for _, k := range keys {
+			v := row.MapIndex(reflect.ValueOf(k.column.Name))
+			if !v.IsValid() {
+				return nil, errors.New("cursor column " + k.column.Name + " not found in result")
+			}
+			values = append(values, driverValue(v.Interface()))
+		}
+	case reflect.Struct:
+		sch, err := schema.Parse(row.Addr().Interface(), scanSchemaCache, db.NamingStrategy)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			f := sch.LookUpField(k.column.Name)
+			if f == nil {
+				return nil, errors.New("cursor column " + k.column.Name + " not found in result")
+			}
+			v, _ := f.ValueOf(context.Background(), row)
+			values = append(values, driverValue(v))
+		}
+	default:
+		return nil, errors.New("cursor pagination only supports struct or map rows")
+	}
+	return values, nil
+}
+
+// driverValue 实现了driver.Valuer的类型(例如carbon.DateTime)转为数据库的值
+func driverValue(v any) any {
+	if valuer, ok := v.(driver.Valuer); ok {
+		if dv, err := valuer.Value(); err == nil {
+			return dv
+		}
+	}
+	return v
+}
+
+func reverse(rows reflect.Value) {
+	swap := reflect.Swapper(rows.Interface())
+	for i, j := 0, rows.Len()-1; i < j; i, j = i+1, j-1 {
+		swap(i, j)
+	}
+}
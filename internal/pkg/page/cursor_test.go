@@ -0,0 +1,363 @@
+package page
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+type cursorItem struct {
+	ID        uint64 `gorm:"primaryKey"`
+	Name      string
+	Score     int64
+	CreatedAt time.Time
+}
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	// 每个连接是独立的内存数据库, 只使用一个连接
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err = db.AutoMigrate(&cursorItem{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func seedItems(t *testing.T, db *gorm.DB, n int) {
+	t.Helper()
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	items := make([]*cursorItem, 0, n)
+	for i := 1; i <= n; i++ {
+		// name和score有重复, 需要靠主键保证排序唯一
+		items = append(items, &cursorItem{
+			ID:        uint64(i),
+			Name:      fmt.Sprintf("name-%d", i%4),
+			Score:     int64(i % 3),
+			CreatedAt: base.Add(time.Duration(i%5) * time.Hour),
+		})
+	}
+	if err := db.Create(items).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCursorEncodeDecode(t *testing.T) {
+	db := openTestDB(t)
+	created := time.Date(2026, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	cases := []struct {
+		name string
+		row  any
+		keys []sortKey
+		want []any
+	}{
+		{
+			name: "struct int and string",
+			row:  &cursorItem{ID: 7, Name: "a.b,c"},
+			keys: []sortKey{{column: clause.Column{Name: "name"}, desc: true}, {column: clause.Column{Name: "id"}}},
+			want: []any{"a.b,c", int64(7)},
+		},
+		{
+			name: "struct time keeps nanoseconds",
+			row:  &cursorItem{ID: 1, CreatedAt: created},
+			keys: []sortKey{{column: clause.Column{Name: "created_at"}}, {column: clause.Column{Name: "id"}}},
+			want: []any{created, int64(1)},
+		},
+		{
+			name: "map uint64 beyond int64",
+			row:  map[string]any{"id": uint64(math.MaxUint64)},
+			keys: []sortKey{{column: clause.Column{Name: "id"}}},
+			want: []any{uint64(math.MaxUint64)},
+		},
+		{
+			name: "map float",
+			row:  map[string]any{"score": 1.5, "id": int64(-3)},
+			keys: []sortKey{{column: clause.Column{Name: "score"}}, {column: clause.Column{Name: "id"}}},
+			want: []any{1.5, int64(-3)},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			signature := orderSignature(c.keys)
+			cursor, err := encodeCursor(db, c.keys, reflect.ValueOf(c.row), directionPrev, signature)
+			if err != nil {
+				t.Fatal(err)
+			}
+			payload, err := decodeCursor(cursor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if payload.Direction != directionPrev || payload.Order != signature {
+				t.Fatalf("got direction %q order %q", payload.Direction, payload.Order)
+			}
+			got := payload.values()
+			if len(got) != len(c.want) {
+				t.Fatalf("got %v, want %v", got, c.want)
+			}
+			for i := range got {
+				if gt, ok := got[i].(time.Time); ok {
+					if !gt.Equal(c.want[i].(time.Time)) {
+						t.Errorf("value %d: got %v, want %v", i, gt, c.want[i])
+					}
+					continue
+				}
+				if got[i] != c.want[i] {
+					t.Errorf("value %d: got %#v, want %#v", i, got[i], c.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCursorMissingColumn(t *testing.T) {
+	db := openTestDB(t)
+	keys := []sortKey{{column: clause.Column{Name: "missing"}}}
+	if _, err := encodeCursor(db, keys, reflect.ValueOf(&cursorItem{}), directionNext, ""); err == nil {
+		t.Fatal("want error for column not in struct")
+	}
+	if _, err := encodeCursor(db, keys, reflect.ValueOf(map[string]any{}), directionNext, ""); err == nil {
+		t.Fatal("want error for column not in map")
+	}
+}
+
+func TestDecodeCursorTampered(t *testing.T) {
+	db := openTestDB(t)
+	keys := []sortKey{{column: clause.Column{Name: "id"}}}
+	valid, err := encodeCursor(db, keys, reflect.ValueOf(&cursorItem{ID: 10}), directionNext, "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, mac, _ := strings.Cut(valid, ".")
+	raw, _ := base64.RawURLEncoding.DecodeString(data)
+
+	// 修改内容后重新编码, 签名不变
+	forged := strings.Replace(string(raw), "10", "11", 1)
+	// 正确签名但方向不合法
+	badDirection, _ := json.Marshal(cursorPayload{Direction: "x", Order: "id", Values: []cursorValue{{Value: 1}}})
+	signedBadDirection := base64.RawURLEncoding.EncodeToString(badDirection) + "." + base64.RawURLEncoding.EncodeToString(sign(badDirection))
+
+	cases := []struct {
+		name   string
+		cursor string
+	}{
+		{"empty", ""},
+		{"no separator", data},
+		{"bad payload base64", "!!!." + mac},
+		{"bad signature base64", data + ".!!!"},
+		{"forged payload", base64.RawURLEncoding.EncodeToString([]byte(forged)) + "." + mac},
+		{"forged signature", data + "." + base64.RawURLEncoding.EncodeToString(sign([]byte("other")))},
+		{"truncated signature", data + "." + mac[:len(mac)-2]},
+		{"signed bad direction", signedBadDirection},
+		{"signed not json", base64.RawURLEncoding.EncodeToString([]byte("x")) + "." + base64.RawURLEncoding.EncodeToString(sign([]byte("x")))},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := decodeCursor(c.cursor); err == nil {
+				t.Fatalf("cursor %q should be rejected", c.cursor)
+			}
+		})
+	}
+
+	t.Run("other secret", func(t *testing.T) {
+		old := cursorSecret
+		defer func() { cursorSecret = old }()
+		SetCursorSecret("another-secret")
+		if _, err := decodeCursor(valid); err == nil {
+			t.Fatal("cursor signed with another secret should be rejected")
+		}
+	})
+}
+
+func TestParseRawOrder(t *testing.T) {
+	cases := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{raw: "id", want: "id"},
+		{raw: "created_at DESC, `uc_users`.`id`", want: "created_at desc,id"},
+		{raw: `"name" asc`, want: "name"},
+		{raw: "LENGTH(name)", wantErr: true},
+		{raw: "name DESC NULLS LAST", wantErr: true},
+		{raw: "name sideways", wantErr: true},
+		{raw: "name,", wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.raw, func(t *testing.T) {
+			keys, err := parseRawOrder(c.raw)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got %v", keys)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := orderSignature(keys); got != c.want {
+				t.Fatalf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestKeysetCondition(t *testing.T) {
+	db := openTestDB(t)
+	keys := []sortKey{{column: clause.Column{Name: "name"}, desc: true}, {column: clause.Column{Name: "id"}, desc: true}}
+	cases := []struct {
+		name     string
+		backward bool
+		want     string
+	}{
+		{"forward", false, "(`name` < ? OR (`name` = ? AND `id` < ?))"},
+		{"backward", true, "(`name` > ? OR (`name` = ? AND `id` > ?))"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+				return tx.Model(&cursorItem{}).Where("score = ?", 1).
+					Where(keysetCondition(keys, []any{"n", int64(5)}, c.backward)).Find(&[]cursorItem{})
+			})
+			// 游标条件需要用括号包起来, 不能和前面的条件用OR连接
+			if !strings.Contains(sql, "score = 1 AND") {
+				t.Fatalf("cursor condition is not ANDed with the query: %s", sql)
+			}
+			want := strings.NewReplacer("?", "%v").Replace(c.want)
+			want = fmt.Sprintf(want, `"n"`, `"n"`, 5)
+			if !strings.Contains(sql, want) {
+				t.Fatalf("got %s, want it to contain %s", sql, want)
+			}
+		})
+	}
+}
+
+func TestCursorPagination(t *testing.T) {
+	db := openTestDB(t)
+	seedItems(t, db, 23)
+
+	orders := []struct {
+		name  string
+		order func(*gorm.DB) *gorm.DB
+		want  func(db *gorm.DB) []uint64
+	}{
+		{
+			name:  "primary key only",
+			order: func(db *gorm.DB) *gorm.DB { return db },
+			want:  func(db *gorm.DB) []uint64 { return pluckIds(t, db.Order("id")) },
+		},
+		{
+			name:  "duplicate name desc",
+			order: func(db *gorm.DB) *gorm.DB { return db.Order("name DESC") },
+			want:  func(db *gorm.DB) []uint64 { return pluckIds(t, db.Order("name DESC, id DESC")) },
+		},
+		{
+			name: "time and score mixed",
+			order: func(db *gorm.DB) *gorm.DB {
+				return db.Order("created_at").Order(clause.OrderByColumn{Column: clause.Column{Name: "score"}, Desc: true})
+			},
+			want: func(db *gorm.DB) []uint64 { return pluckIds(t, db.Order("created_at, score DESC, id DESC")) },
+		},
+	}
+	for _, o := range orders {
+		t.Run(o.name, func(t *testing.T) {
+			want := o.want(db.Model(&cursorItem{}))
+			query := func(p *Page) []*cursorItem {
+				var rows []*cursorItem
+				if err := p.Query(o.order(db.Model(&cursorItem{}))).Find(&rows); err != nil {
+					t.Fatal(err)
+				}
+				return rows
+			}
+
+			// 向后翻到最后一页
+			var pages [][]*cursorItem
+			p := &Page{Mode: ModeCursor, Size: 10}
+			for i := 0; ; i++ {
+				if i > 5 {
+					t.Fatal("too many pages")
+				}
+				rows := query(p)
+				pages = append(pages, rows)
+				if (i == 0) != (p.PrevCursor == "") {
+					t.Fatalf("page %d: prev cursor %q", i, p.PrevCursor)
+				}
+				if p.NextCursor == "" {
+					if p.HasMore {
+						t.Fatal("has_more without next cursor")
+					}
+					break
+				}
+				p = &Page{Cursor: p.NextCursor, Size: 10}
+			}
+			if got := idsOf(pages...); !reflect.DeepEqual(got, want) {
+				t.Fatalf("forward got %v, want %v", got, want)
+			}
+
+			// 从最后一页向前翻回第一页, 每页与向后翻时相同
+			for i := len(pages) - 2; i >= 0; i-- {
+				p = &Page{Cursor: p.PrevCursor, Size: 10}
+				rows := query(p)
+				if !reflect.DeepEqual(idsOf(rows), idsOf(pages[i])) {
+					t.Fatalf("backward page %d got %v, want %v", i, idsOf(rows), idsOf(pages[i]))
+				}
+				if (i == 0) != (p.PrevCursor == "") || p.NextCursor == "" {
+					t.Fatalf("backward page %d: prev %q next %q", i, p.PrevCursor, p.NextCursor)
+				}
+			}
+		})
+	}
+
+	t.Run("cursor from another order is rejected", func(t *testing.T) {
+		p := &Page{Mode: ModeCursor, Size: 5}
+		var rows []*cursorItem
+		if err := p.Query(db.Model(&cursorItem{}).Order("name")).Find(&rows); err != nil {
+			t.Fatal(err)
+		}
+		p = &Page{Cursor: p.NextCursor, Size: 5}
+		if err := p.Query(db.Model(&cursorItem{}).Order("score")).Find(&rows); err == nil {
+			t.Fatal("want invalid cursor error")
+		}
+	})
+
+	t.Run("expression order is rejected", func(t *testing.T) {
+		p := &Page{Mode: ModeCursor}
+		var rows []*cursorItem
+		if err := p.Query(db.Model(&cursorItem{}).Order("LENGTH(name)")).Find(&rows); err == nil {
+			t.Fatal("want error for expression order")
+		}
+	})
+}
+
+func pluckIds(t *testing.T, db *gorm.DB) []uint64 {
+	t.Helper()
+	var ids []uint64
+	if err := db.Pluck("id", &ids).Error; err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func idsOf(pages ...[]*cursorItem) []uint64 {
+	ids := make([]uint64, 0)
+	for _, rows := range pages {
+		for _, r := range rows {
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids
+}
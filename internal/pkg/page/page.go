@@ -4,8 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"gin-layout/pkg/errResponse"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"reflect"
+	"regexp"
+	"time"
 )
 
 const (
@@ -13,8 +17,18 @@ const (
 	MinSize uint64 = 1
 	Size    uint64 = 10
 	MaxSize uint64 = 5000
+
+	// ModeCursor 游标分页, 按上一页最后一行的排序字段值查询下一页, 不执行count
+	ModeCursor = "cursor"
+
+	// Primary优化时子查询的别名
+	offsetTable = "OFFSET_T"
+	offsetKey   = "OFFSET_KEY"
 )
 
+// primaryRegexp Primary只能是字段名, 防止拼接进SQL时注入
+var primaryRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 // Page array data page info
 type Page struct {
 	ctx     context.Context
@@ -24,6 +38,33 @@ type Page struct {
 	Disable bool   `json:"disable"` // disable pagination, query all data
 	Count   bool   `json:"count"`   // not use 'SELECT count(*) FROM ...' before 'SELECT * FROM ...'
 	Primary string `json:"primary"` // When there is a large amount of data, limit is optimized by specifying a field (the field is usually self incremented ID or indexed), which can improve the query efficiency (if it is not transmitted, it will not be optimized)
+
+	// cursor mode: Mode is ModeCursor or Cursor is not empty, sort keys come from the ORDER BY of the query (primary key is appended if missing)
+	Mode       string `json:"mode"`        // pagination mode, "" is limit/offset, ModeCursor is keyset
+	Cursor     string `json:"cursor"`      // opaque cursor from next_cursor/prev_cursor of the previous query, empty means first page
+	NextCursor string `json:"next_cursor"` // cursor of the next page, empty if there is no next page
+	PrevCursor string `json:"prev_cursor"` // cursor of the previous page, empty if there is no previous page
+	HasMore    bool   `json:"has_more"`    // there is more data in the requested direction
+
+	// count strategy, set by the data layer for expensive list queries
+	CountStrategy     string        `json:"-"`         // "" is count then select, see CountConcurrent/CountCached/CountEstimated
+	CountCacheTTL     time.Duration `json:"-"`         // CountCached: ttl of cached total, default DefaultCountCacheTTL
+	EstimateThreshold int64         `json:"-"`         // CountEstimated: use estimated total when it is greater than threshold, default DefaultEstimateThreshold
+	Estimated         bool          `json:"estimated"` // Total is estimated, not exact
+}
+
+// validPrimary Primary is empty or a plain column name
+func (page *Page) validPrimary() bool {
+	return page.Primary == "" || primaryRegexp.MatchString(page.Primary)
+}
+
+func invalidPrimary() error {
+	return errResponse.SetCustomizeErrMsgByReason(errResponse.ReasonParamsError, "invalid primary")
+}
+
+// IsCursor use keyset pagination
+func (page *Page) IsCursor() bool {
+	return page.Mode == ModeCursor || page.Cursor != ""
 }
 
 func (page *Page) WithContext(ctx context.Context) *Page {
@@ -92,126 +133,98 @@ type Query struct {
 	page *Page
 }
 
-// Find exec gorm Find method with limit/offset
+// Find exec gorm Find method with limit/offset, or keyset when page.IsCursor()
 // Must use .Model() or .Table()
 func (q *Query) Find(model any) (err error) {
+	return q.exec(model, func(db *gorm.DB, dest any) *gorm.DB {
+		return db.Find(dest)
+	})
+}
+
+// Scan exec gorm Scan method with limit/offset, or keyset when page.IsCursor()
+// Must use .Model() or .Table()
+func (q *Query) Scan(model any) (err error) {
+	return q.exec(model, func(db *gorm.DB, dest any) *gorm.DB {
+		return db.Scan(dest)
+	})
+}
+
+type execFunc func(db *gorm.DB, dest any) *gorm.DB
+
+func (q *Query) exec(model any, exec execFunc) (err error) {
 	db := q.db
 	page := q.page
-	if _, ok := db.Statement.Clauses["ORDER BY"]; !ok {
-		db = db.Order(page.Primary)
+	if page.IsCursor() && !page.Disable {
+		return q.cursorFind(model, exec)
+	}
+	if !page.validPrimary() {
+		return invalidPrimary()
+	}
+	if _, ok := db.Statement.Clauses["ORDER BY"]; !ok && page.Primary != "" {
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: page.Primary}})
 	}
 	rv := reflect.ValueOf(model)
 	if rv.Kind() != reflect.Ptr || (rv.IsNil() || rv.Elem().Kind() != reflect.Slice) {
-		return errors.New(`model must be a pointer`)
+		return errors.New("model must be a pointer")
 	}
+	page.Estimated = false
 
-	if !page.Disable {
-		if !page.Count {
-			if err = db.Count(&page.Total).Error; err != nil {
-				return
-			}
-		}
-		if page.Total > 0 || page.Count {
-			limit, offset := page.Limit()
-			if page.Primary == "" {
-				err = db.Limit(limit).Offset(offset).Find(model).Error
-			} else {
-				// parse model
-				if db.Statement.Model != nil {
-					err = db.Statement.Parse(db.Statement.Model)
-					if err != nil {
-						return errors.New(`parse model failed`)
-					}
-				}
-				err = db.Joins(
-					// add Primary index before join, improve query efficiency
-					fmt.Sprintf(
-						"JOIN (?) AS `OFFSET_T` ON `%s`.`%s` = `OFFSET_T`.`OFFSET_KEY`",
-						db.Statement.Table,
-						page.Primary,
-					),
-					db.
-						Session(&gorm.Session{}).
-						Select(
-							fmt.Sprintf("`%s`.`%s` AS `OFFSET_KEY`", db.Statement.Table, page.Primary),
-						).
-						Limit(limit).
-						Offset(offset),
-				).Find(model).Error
-			}
-			if err != nil {
-				return
-			}
-		}
-	} else {
+	if page.Disable {
 		// no pagination
-		if err = db.Find(model).Error; err != nil {
+		if err = exec(db, model).Error; err != nil {
 			return
 		}
 		page.Total = int64(rv.Elem().Len())
 		page.Limit()
+		return
+	}
+
+	if page.Count {
+		limit, offset := page.Limit()
+		return q.list(db, model, exec, limit, offset)
+	}
+	if page.CountStrategy == CountConcurrent && !inTransaction(db) {
+		return q.concurrent(db, model, exec)
+	}
+	if err = q.count(db); err != nil {
+		return
+	}
+	if page.Total > 0 {
+		limit, offset := page.Limit()
+		return q.list(db, model, exec, limit, offset)
 	}
 	return
 }
 
-// Scan exec gorm Scan method with limit/offset
-// Must use .Model() or .Table()
-func (q *Query) Scan(model any) (err error) {
-	db := q.db
+// list query one page data
+func (q *Query) list(db *gorm.DB, model any, exec execFunc, limit, offset int) (err error) {
 	page := q.page
-	if _, ok := db.Statement.Clauses["ORDER BY"]; !ok {
-		db = db.Order(page.Primary)
-	}
-	rv := reflect.ValueOf(model)
-	if rv.Kind() != reflect.Ptr || (rv.IsNil() || rv.Elem().Kind() != reflect.Slice) {
-		return errors.New("model must be a pointer")
+	if page.Primary == "" {
+		return exec(db.Limit(limit).Offset(offset), model).Error
 	}
-
-	if !page.Disable {
-		if !page.Count {
-			if err = db.Count(&page.Total).Error; err != nil {
-				return
-			}
-		}
-		if page.Total > 0 || page.Count {
-			limit, offset := page.Limit()
-			if page.Primary == "" {
-				err = db.Limit(limit).Offset(offset).Scan(model).Error
-			} else {
-				// parse model
-				if db.Statement.Model != nil {
-					err = db.Statement.Parse(db.Statement.Model)
-					if err != nil {
-						return errors.New("parse model failed")
-					}
-				}
-				err = db.Joins(
-					// add Primary index before join, improve query efficiency
-					fmt.Sprintf(
-						"JOIN (?) AS `OFFSET_T` ON `%s`.`%s` = `OFFSET_T`.`OFFSET_KEY`",
-						db.Statement.Table,
-						page.Primary,
-					),
-					db.
-						Session(&gorm.Session{}).
-						Select(
-							fmt.Sprintf("`%s`.`%s` AS `OFFSET_KEY`", db.Statement.Table, page.Primary),
-						).
-						Limit(limit).
-						Offset(offset),
-				).Scan(model).Error
-			}
-			if err != nil {
-				return
-			}
+	// parse model
+	if db.Statement.Model != nil {
+		err = db.Statement.Parse(db.Statement.Model)
+		if err != nil {
+			return errors.New("parse model failed")
 		}
-	} else {
-		// no pagination
-		if err = db.Scan(model).Error; err != nil {
-			return
-		}
-		page.Total = int64(rv.Elem().Len())
-		page.Limit()
 	}
-	return
+	return exec(db.Joins(
+		// add Primary index before join, improve query efficiency
+		fmt.Sprintf(
+			"JOIN (?) AS %s ON %s = %s",
+			db.Statement.Quote(offsetTable),
+			db.Statement.Quote(clause.Column{Table: db.Statement.Table, Name: page.Primary}),
+			db.Statement.Quote(clause.Column{Table: offsetTable, Name: offsetKey}),
+		),
+		db.
+			Session(&gorm.Session{}).
+			Select(
+				"? AS ?",
+				clause.Column{Table: db.Statement.Table, Name: page.Primary},
+				clause.Column{Name: offsetKey},
+			).
+			Limit(limit).
+			Offset(offset),
+	), model).Error
 }
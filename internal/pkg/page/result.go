@@ -0,0 +1,95 @@
+package page
+
+import (
+	"gorm.io/gorm"
+)
+
+// Result typed pagination result
+type Result[T any] struct {
+	List       []T    `json:"list"`
+	Num        uint64 `json:"num"`         // current page, 0 in cursor mode
+	Size       uint64 `json:"size"`        // page per count
+	Total      int64  `json:"total"`       // all data count, 0 when count is skipped (Page.Count or cursor mode)
+	TotalPages uint64 `json:"total_pages"` // 0 when count is skipped
+	Estimated  bool   `json:"estimated"`   // Total is estimated (CountEstimated), not exact
+	HasNext    bool   `json:"has_next"`
+	HasPrev    bool   `json:"has_prev"`
+	NextCursor string `json:"next_cursor,omitempty"` // cursor mode only
+	PrevCursor string `json:"prev_cursor,omitempty"` // cursor mode only
+}
+
+// Find exec Query.Find and return typed result
+//
+//	res, err := page.Find[*model.UcUser](condition.Page, db.Model(&model.UcUser{}))
+func Find[T any](page *Page, db *gorm.DB) (*Result[T], error) {
+	list := make([]T, 0)
+	if err := page.Query(db).Find(&list); err != nil {
+		return nil, err
+	}
+	return NewResult(page, list), nil
+}
+
+// Scan exec Query.Scan and return typed result
+func Scan[T any](page *Page, db *gorm.DB) (*Result[T], error) {
+	list := make([]T, 0)
+	if err := page.Query(db).Scan(&list); err != nil {
+		return nil, err
+	}
+	return NewResult(page, list), nil
+}
+
+// NewResult build result from page after query
+func NewResult[T any](page *Page, list []T) *Result[T] {
+	if list == nil {
+		list = make([]T, 0)
+	}
+	res := &Result[T]{
+		List:      list,
+		Total:     page.Total,
+		Estimated: page.Estimated,
+	}
+	switch {
+	case page.IsCursor() && !page.Disable:
+		res.Size = uint64(page.size())
+		res.NextCursor, res.PrevCursor = page.NextCursor, page.PrevCursor
+		res.HasNext, res.HasPrev = page.NextCursor != "", page.PrevCursor != ""
+	case page.Disable:
+		res.Num, res.Size, res.TotalPages = MinNum, uint64(len(list)), MinNum
+	default:
+		res.Num, res.Size = page.Num, uint64(page.size())
+		if res.Num < MinNum {
+			res.Num = MinNum
+		}
+		res.HasPrev = res.Num > MinNum
+		if page.Count {
+			// 没有count时只能根据本页是否取满判断是否有下一页
+			res.HasNext = uint64(len(list)) == res.Size
+		} else {
+			res.TotalPages = (uint64(page.Total) + res.Size - 1) / res.Size
+			res.HasNext = res.Num < res.TotalPages
+		}
+	}
+	return res
+}
+
+// Map convert list item type, keep pagination info
+//
+//	return page.Map(res, (*model.UcUser).ToDomain), nil
+func Map[T, R any](res *Result[T], fn func(T) R) *Result[R] {
+	list := make([]R, 0, len(res.List))
+	for _, v := range res.List {
+		list = append(list, fn(v))
+	}
+	return &Result[R]{
+		List:       list,
+		Num:        res.Num,
+		Size:       res.Size,
+		Total:      res.Total,
+		TotalPages: res.TotalPages,
+		Estimated:  res.Estimated,
+		HasNext:    res.HasNext,
+		HasPrev:    res.HasPrev,
+		NextCursor: res.NextCursor,
+		PrevCursor: res.PrevCursor,
+	}
+}
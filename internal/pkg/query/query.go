@@ -0,0 +1,308 @@
+package query
+
+import (
+	"fmt"
+	"gin-layout/pkg/errResponse"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Op 筛选操作符
+type Op string
+
+const (
+	OpEq   Op = "eq"
+	OpNe   Op = "ne"
+	OpGt   Op = "gt"
+	OpGte  Op = "gte"
+	OpLt   Op = "lt"
+	OpLte  Op = "lte"
+	OpLike Op = "like" // 包含, 值中的 % _ 会被转义
+	OpIn   Op = "in"   // 多个值以逗号分隔
+	OpNin  Op = "nin"  // not in, 多个值以逗号分隔
+	OpNull Op = "null" // true: IS NULL, false: IS NOT NULL
+)
+
+// Kind 筛选值的类型, 解析失败时返回参数错误
+type Kind int
+
+const (
+	KindString Kind = iota
+	KindInt
+	KindUint
+	KindFloat
+	KindBool
+	KindTime // 2006-01-02 15:04:05 或 2006-01-02
+)
+
+const (
+	ParamSort   = "sort"
+	ParamFilter = "filter"
+
+	// MaxInValues in/nin最多允许的值个数
+	MaxInValues = 100
+)
+
+var (
+	// filter[name][like]=x 或 filter[name]=x
+	filterKeyRegexp = regexp.MustCompile(`^filter\[([A-Za-z0-9_.]+)\](?:\[([a-z]+)\])?$`)
+)
+
+// Field 资源允许排序/筛选的字段
+type Field struct {
+	Column   string // 数据库列名, 为空时使用字段名
+	Kind     Kind
+	Sortable bool
+	Ops      []Op // 允许的筛选操作符, 为空表示不允许筛选
+}
+
+// Spec 资源的排序和筛选声明, 只有声明过的字段和操作符可以使用
+//
+//	var userSpec = &query.Spec{
+//		Fields: map[string]query.Field{
+//			"id":   {Kind: query.KindUint, Sortable: true, Ops: []query.Op{query.OpEq, query.OpIn}},
+//			"name": {Ops: []query.Op{query.OpEq, query.OpLike}},
+//		},
+//		DefaultSort: "-id",
+//	}
+type Spec struct {
+	Fields      map[string]Field
+	DefaultSort string // 没有传sort时使用, 格式同sort参数
+}
+
+// Sort 一个排序字段
+type Sort struct {
+	Column string
+	Desc   bool
+}
+
+// Filter 一个筛选条件
+type Filter struct {
+	Column string
+	Op     Op
+	Value  any // in/nin时为[]any
+}
+
+// Query 解析后的排序和筛选
+type Query struct {
+	Sorts   []Sort
+	Filters []Filter
+}
+
+// Parse 解析 sort=-created_at,id 和 filter[name][like]=x&filter[id][in]=1,2
+// 未声明的字段或操作符返回参数错误
+func (s *Spec) Parse(values url.Values) (*Query, error) {
+	q := &Query{}
+	sortValue := values.Get(ParamSort)
+	if sortValue == "" {
+		sortValue = s.DefaultSort
+	}
+	if err := s.parseSort(q, sortValue); err != nil {
+		return nil, err
+	}
+
+	// 按key排序, 保证生成的SQL稳定
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if strings.HasPrefix(key, ParamFilter+"[") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		m := filterKeyRegexp.FindStringSubmatch(key)
+		if m == nil {
+			return nil, paramsError("invalid filter: %s", key)
+		}
+		op := Op(m[2])
+		if op == "" {
+			op = OpEq
+		}
+		if err := s.AddFilter(q, m[1], op, values.Get(key)); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// AddFilter 按声明校验后添加筛选条件, 用于兼容旧的独立查询参数
+func (s *Spec) AddFilter(q *Query, name string, op Op, raw string) error {
+	field, ok := s.Fields[name]
+	if !ok || !field.allow(op) {
+		return paramsError("unsupported filter: %s[%s]", name, op)
+	}
+	value, err := field.parseValue(op, raw)
+	if err != nil {
+		return paramsError("invalid filter value: %s[%s]", name, op)
+	}
+	q.Filters = append(q.Filters, Filter{Column: field.column(name), Op: op, Value: value})
+	return nil
+}
+
+func (s *Spec) parseSort(q *Query, value string) error {
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		desc := strings.HasPrefix(item, "-")
+		name := strings.TrimLeft(item, "+-")
+		field, ok := s.Fields[name]
+		if !ok || !field.Sortable {
+			return paramsError("unsupported sort: %s", name)
+		}
+		q.Sorts = append(q.Sorts, Sort{Column: field.column(name), Desc: desc})
+	}
+	return nil
+}
+
+// Apply 立即添加筛选和排序, 与page.Page一起使用时需要用Apply而不是Scopes,
+// 因为gorm的Scopes在执行时才生效, page需要在执行前读取排序
+func (q *Query) Apply(db *gorm.DB) *gorm.DB {
+	if q == nil {
+		return db
+	}
+	return q.SortScope(q.FilterScope(db))
+}
+
+// Scopes 转换为gorm的scope, 用法: db.Scopes(q.Scopes()...)
+func (q *Query) Scopes() []func(*gorm.DB) *gorm.DB {
+	if q == nil {
+		return nil
+	}
+	return []func(*gorm.DB) *gorm.DB{q.FilterScope, q.SortScope}
+}
+
+// FilterScope 添加筛选条件, 列名由gorm按方言转义, 值使用参数绑定
+func (q *Query) FilterScope(db *gorm.DB) *gorm.DB {
+	for _, f := range q.Filters {
+		db = db.Where(f.expression(db.Dialector.Name()))
+	}
+	return db
+}
+
+// SortScope 添加排序
+func (q *Query) SortScope(db *gorm.DB) *gorm.DB {
+	for _, s := range q.Sorts {
+		db = db.Order(clause.OrderByColumn{Column: column(s.Column), Desc: s.Desc})
+	}
+	return db
+}
+
+func (f Filter) expression(dialect string) clause.Expression {
+	col := column(f.Column)
+	switch f.Op {
+	case OpNe:
+		return clause.Neq{Column: col, Value: f.Value}
+	case OpGt:
+		return clause.Gt{Column: col, Value: f.Value}
+	case OpGte:
+		return clause.Gte{Column: col, Value: f.Value}
+	case OpLt:
+		return clause.Lt{Column: col, Value: f.Value}
+	case OpLte:
+		return clause.Lte{Column: col, Value: f.Value}
+	case OpLike:
+		// sqlite的like没有默认的转义符
+		if dialect == "sqlite" {
+			return clause.Expr{SQL: `? LIKE ? ESCAPE '\'`, Vars: []any{col, f.Value}}
+		}
+		return clause.Like{Column: col, Value: f.Value}
+	case OpIn:
+		return clause.IN{Column: col, Values: f.Value.([]any)}
+	case OpNin:
+		return clause.Not(clause.IN{Column: col, Values: f.Value.([]any)})
+	case OpNull:
+		if f.Value.(bool) {
+			return clause.Eq{Column: col, Value: nil}
+		}
+		return clause.Neq{Column: col, Value: nil}
+	default:
+		return clause.Eq{Column: col, Value: f.Value}
+	}
+}
+
+// column 支持 table.column 形式
+func column(name string) clause.Column {
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		return clause.Column{Table: name[:i], Name: name[i+1:]}
+	}
+	return clause.Column{Name: name}
+}
+
+func (f Field) column(name string) string {
+	if f.Column != "" {
+		return f.Column
+	}
+	return name
+}
+
+func (f Field) allow(op Op) bool {
+	for _, o := range f.Ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (f Field) parseValue(op Op, raw string) (any, error) {
+	switch op {
+	case OpIn, OpNin:
+		items := strings.Split(raw, ",")
+		if len(items) > MaxInValues {
+			return nil, fmt.Errorf("too many values")
+		}
+		values := make([]any, 0, len(items))
+		for _, item := range items {
+			v, err := f.parseOne(strings.TrimSpace(item))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	case OpNull:
+		return strconv.ParseBool(raw)
+	case OpLike:
+		return "%" + escapeLike(raw) + "%", nil
+	default:
+		return f.parseOne(raw)
+	}
+}
+
+func (f Field) parseOne(raw string) (any, error) {
+	switch f.Kind {
+	case KindInt:
+		return strconv.ParseInt(raw, 10, 64)
+	case KindUint:
+		return strconv.ParseUint(raw, 10, 64)
+	case KindFloat:
+		return strconv.ParseFloat(raw, 64)
+	case KindBool:
+		return strconv.ParseBool(raw)
+	case KindTime:
+		if t, err := time.ParseInLocation("2006-01-02 15:04:05", raw, time.Local); err == nil {
+			return t, nil
+		}
+		return time.ParseInLocation("2006-01-02", raw, time.Local)
+	default:
+		return raw, nil
+	}
+}
+
+// escapeLike 转义like中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func paramsError(format string, a ...any) error {
+	return errResponse.SetCustomizeErrMsgByReason(errResponse.ReasonParamsError, fmt.Sprintf(format, a...))
+}
@@ -0,0 +1,247 @@
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var testSpec = &Spec{
+	Fields: map[string]Field{
+		"id":         {Kind: KindUint, Sortable: true, Ops: []Op{OpEq, OpIn, OpNin, OpGt}},
+		"name":       {Ops: []Op{OpEq, OpLike}},
+		"score":      {Kind: KindFloat, Sortable: true, Ops: []Op{OpGte, OpLt}},
+		"active":     {Kind: KindBool, Ops: []Op{OpEq}},
+		"deleted_at": {Kind: KindTime, Ops: []Op{OpNull, OpLte}},
+		"owner":      {Column: "users.name", Sortable: true, Ops: []Op{OpNe}},
+	},
+	DefaultSort: "-id",
+}
+
+func TestParse(t *testing.T) {
+	day := time.Date(2026, 1, 31, 0, 0, 0, 0, time.Local)
+	cases := []struct {
+		name    string
+		query   string
+		sorts   []Sort
+		filters []Filter
+	}{
+		{
+			name:  "default sort",
+			query: "",
+			sorts: []Sort{{Column: "id", Desc: true}},
+		},
+		{
+			name:  "multiple sorts and column mapping",
+			query: "sort=score,-owner,+id",
+			sorts: []Sort{{Column: "score"}, {Column: "users.name", Desc: true}, {Column: "id"}},
+		},
+		{
+			name:    "eq is the default op",
+			query:   "sort=id&filter[name]=bob",
+			sorts:   []Sort{{Column: "id"}},
+			filters: []Filter{{Column: "name", Op: OpEq, Value: "bob"}},
+		},
+		{
+			name:    "filters are sorted by key",
+			query:   "filter[score][lt]=9.5&filter[id][in]=1,%202,3&filter[active]=true",
+			sorts:   []Sort{{Column: "id", Desc: true}},
+			filters: []Filter{{Column: "active", Op: OpEq, Value: true}, {Column: "id", Op: OpIn, Value: []any{uint64(1), uint64(2), uint64(3)}}, {Column: "score", Op: OpLt, Value: 9.5}},
+		},
+		{
+			name:    "like escapes wildcards",
+			query:   `filter[name][like]=50%25_off%5C`,
+			sorts:   []Sort{{Column: "id", Desc: true}},
+			filters: []Filter{{Column: "name", Op: OpLike, Value: `%50\%\_off\\%`}},
+		},
+		{
+			name:    "time and null",
+			query:   "filter[deleted_at][lte]=2026-01-31&filter[deleted_at][null]=false",
+			sorts:   []Sort{{Column: "id", Desc: true}},
+			filters: []Filter{{Column: "deleted_at", Op: OpLte, Value: day}, {Column: "deleted_at", Op: OpNull, Value: false}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			values, err := url.ParseQuery(c.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q, err := testSpec.Parse(values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(q.Sorts, c.sorts) {
+				t.Errorf("sorts got %+v, want %+v", q.Sorts, c.sorts)
+			}
+			if len(q.Filters) != len(c.filters) {
+				t.Fatalf("filters got %+v, want %+v", q.Filters, c.filters)
+			}
+			for i, f := range q.Filters {
+				want := c.filters[i]
+				if tm, ok := f.Value.(time.Time); ok {
+					if f.Column != want.Column || f.Op != want.Op || !tm.Equal(want.Value.(time.Time)) {
+						t.Errorf("filter %d got %+v, want %+v", i, f, want)
+					}
+					continue
+				}
+				if !reflect.DeepEqual(f, want) {
+					t.Errorf("filter %d got %+v, want %+v", i, f, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	cases := []struct {
+		name  string
+		query string
+	}{
+		{"unknown sort field", "sort=password"},
+		{"field not sortable", "sort=name"},
+		{"unknown filter field", "filter[password]=x"},
+		{"op not allowed", "filter[name][gt]=x"},
+		{"unknown op", "filter[name][regex]=x"},
+		{"malformed key", "filter[name"},
+		{"injection in field", "filter[name%60%20OR%201=1]=x"},
+		{"bad uint", "filter[id]=-1"},
+		{"bad float", "filter[score][gte]=abc"},
+		{"bad bool", "filter[active]=maybe"},
+		{"bad time", "filter[deleted_at][lte]=31/01/2026"},
+		{"bad null", "filter[deleted_at][null]=yes"},
+		{"bad value in list", "filter[id][in]=1,x"},
+		{"too many values", "filter[id][in]=" + strings.Repeat("1,", MaxInValues) + "1"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			values, err := url.ParseQuery(c.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q, err := testSpec.Parse(values); err == nil {
+				t.Fatalf("want error, got %+v", q)
+			}
+		})
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	cases := map[string]string{
+		"plain":  "plain",
+		"100%":   `100\%`,
+		"a_b":    `a\_b`,
+		`c:\dir`: `c:\\dir`,
+		`\%_`:    `\\\%\_`,
+		"":       "",
+		"中文%名字_": `中文\%名字\_`,
+	}
+	for in, want := range cases {
+		if got := escapeLike(in); got != want {
+			t.Errorf("escapeLike(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+type queryRow struct {
+	ID     uint64 `gorm:"primaryKey"`
+	Name   string
+	Score  float64
+	Active bool
+}
+
+func TestApply(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err = db.AutoMigrate(&queryRow{}); err != nil {
+		t.Fatal(err)
+	}
+	rows := []*queryRow{
+		{ID: 1, Name: "50% off", Score: 1, Active: true},
+		{ID: 2, Name: "500 off", Score: 2},
+		{ID: 3, Name: "a_b", Score: 3, Active: true},
+		{ID: 4, Name: "axb", Score: 4},
+		{ID: 5, Name: `back\slash`, Score: 5, Active: true},
+		{ID: 6, Name: "backslash", Score: 6},
+	}
+	if err = db.Create(rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	spec := &Spec{Fields: map[string]Field{
+		"id":     {Kind: KindUint, Sortable: true, Ops: []Op{OpIn, OpNin}},
+		"name":   {Ops: []Op{OpLike}},
+		"score":  {Kind: KindFloat, Sortable: true, Ops: []Op{OpGte, OpLt}},
+		"active": {Kind: KindBool, Ops: []Op{OpEq}},
+	}}
+	cases := []struct {
+		query string
+		want  []uint64
+	}{
+		// 通配符按字面匹配
+		{"filter[name][like]=" + url.QueryEscape("0%"), []uint64{1}},
+		{"filter[name][like]=" + url.QueryEscape("a_b"), []uint64{3}},
+		{"filter[name][like]=" + url.QueryEscape(`k\s`), []uint64{5}},
+		{"filter[name][like]=off&sort=-id", []uint64{2, 1}},
+		{"filter[id][in]=1,3,5&filter[active]=true", []uint64{1, 3, 5}},
+		{"filter[id][nin]=1,3,5&sort=-score", []uint64{6, 4, 2}},
+		{"filter[score][gte]=2&filter[score][lt]=4", []uint64{2, 3}},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			values, _ := url.ParseQuery(c.query)
+			q, err := spec.Parse(values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []uint64
+			if err = q.Apply(db.Model(&queryRow{})).Pluck("id", &ids).Error; err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(c.want) {
+				t.Fatalf("got %v, want %v", ids, c.want)
+			}
+		})
+	}
+}
+
+func TestFilterExpressionSQL(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	cases := []struct {
+		filter Filter
+		want   string
+	}{
+		{Filter{Column: "users.name", Op: OpNe, Value: "x"}, "`users`.`name` <> \"x\""},
+		{Filter{Column: "id", Op: OpNin, Value: []any{1, 2}}, "`id` NOT IN (1,2)"},
+		{Filter{Column: "deleted_at", Op: OpNull, Value: true}, "`deleted_at` IS NULL"},
+		{Filter{Column: "deleted_at", Op: OpNull, Value: false}, "`deleted_at` IS NOT NULL"},
+		{Filter{Column: "name", Op: OpLike, Value: `%a\_%`}, "`name` LIKE \"%a\\_%\" ESCAPE '\\'"},
+	}
+	for _, c := range cases {
+		t.Run(string(c.filter.Op), func(t *testing.T) {
+			q := &Query{Filters: []Filter{c.filter}}
+			sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+				return q.Apply(tx.Table("users")).Find(&[]map[string]any{})
+			})
+			if !strings.Contains(sql, c.want) {
+				t.Fatalf("got %s, want it to contain %s", sql, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"gin-layout/internal/pkg/redisx"
+	"gin-layout/internal/pkg/tenant"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+// 字段名, stream中每条消息只有一个字段
+const fieldJob = "job"
+
+// keys 同一个队列使用的key
+type keys struct {
+	stream  string // 待执行的任务
+	delayed string // 延迟和重试的任务, zset, score为执行时间的毫秒时间戳
+	dead    string // 死信
+}
+
+func newKeys(prefix string) keys {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return keys{stream: prefix + "stream", delayed: prefix + "delayed", dead: prefix + "dead"}
+}
+
+// Client 任务入队, 到期的任务写入stream, 延迟的任务写入zset, 由Worker到期后移到stream
+//
+//	id, err := client.Enqueue(ctx, "uc_user.welcome", payload, queue.Delay(time.Minute))
+type Client struct {
+	rdb        redisx.Client
+	keys       keys
+	maxRetries int
+}
+
+// NewClient prefix为空时使用DefaultPrefix, maxRetries<0时使用DefaultMaxRetries
+func NewClient(rdb redisx.Client, prefix string, maxRetries int) *Client {
+	if maxRetries < 0 {
+		maxRetries = DefaultMaxRetries
+	}
+	return &Client{rdb: rdb, keys: newKeys(prefix), maxRetries: maxRetries}
+}
+
+// NewJob 创建任务, 记录ctx中的租户和请求id, 执行时恢复到处理函数的ctx中
+func (c *Client) NewJob(ctx context.Context, jobType string, payload any, opts ...Option) (*Job, error) {
+	job := &Job{
+		ID:         newId(),
+		Type:       jobType,
+		MaxRetries: c.maxRetries,
+		EnqueuedAt: time.Now(),
+		TenantID:   tenant.FromContext(ctx),
+	}
+	job.RequestID, _ = ctx.Value("request_id").(string)
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		job.Payload = b
+	}
+	for _, opt := range opts {
+		opt(job)
+	}
+	return job, nil
+}
+
+// Push 写入redis
+func (c *Client) Push(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	rdb := c.rdb.WithContext(ctx)
+	if job.RunAt.After(time.Now()) {
+		err = rdb.ZAdd(c.keys.delayed, redis.Z{Score: float64(job.RunAt.UnixMilli()), Member: data}).Err()
+	} else {
+		err = rdb.XAdd(&redis.XAddArgs{Stream: c.keys.stream, Values: map[string]any{fieldJob: data}}).Err()
+	}
+	return errors.WithStack(err)
+}
+
+// Enqueue 创建任务并入队, 返回任务id
+func (c *Client) Enqueue(ctx context.Context, jobType string, payload any, opts ...Option) (string, error) {
+	job, err := c.NewJob(ctx, jobType, payload, opts...)
+	if err != nil {
+		return "", err
+	}
+	return job.ID, c.Push(ctx, job)
+}
+
+func decodeJob(msg redis.XMessage) (*Job, error) {
+	s, ok := msg.Values[fieldJob].(string)
+	if !ok {
+		return nil, errors.Errorf("queue: message %s has no job", msg.ID)
+	}
+	job := &Job{}
+	if err := json.Unmarshal([]byte(s), job); err != nil {
+		return nil, errors.Wrapf(err, "queue: message %s", msg.ID)
+	}
+	return job, nil
+}
+
+func newId() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return strconv.FormatInt(time.Now().UnixMilli(), 36) + "-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,122 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultPrefix key的前缀, 使用hash tag保证集群模式下所有key在同一个slot
+	DefaultPrefix = "{gin_layout:jobs}:"
+	// DefaultMaxRetries 任务失败后的最大重试次数
+	DefaultMaxRetries = 3
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// Job 后台任务, 入队后以json保存在redis中
+type Job struct {
+	ID         string              `json:"id"`
+	Type       string              `json:"type"`
+	Payload    jsoniter.RawMessage `json:"payload,omitempty"`
+	Attempts   int                 `json:"attempts"`    // 已经失败的次数
+	MaxRetries int                 `json:"max_retries"` // 失败后最多重试的次数, 超过后进入死信
+	LastError  string              `json:"last_error,omitempty"`
+	EnqueuedAt time.Time           `json:"enqueued_at"`
+	RunAt      time.Time           `json:"run_at"` // 延迟任务的执行时间
+	TenantID   string              `json:"tenant_id,omitempty"`
+	RequestID  string              `json:"request_id,omitempty"` // 入队的请求, 用于关联日志
+}
+
+// Decode 把payload解码到v
+func (j *Job) Decode(v any) error {
+	if len(j.Payload) == 0 {
+		return nil
+	}
+	return errors.WithStack(json.Unmarshal(j.Payload, v))
+}
+
+// Option 入队选项
+type Option func(*Job)
+
+// Delay 延迟d后执行
+func Delay(d time.Duration) Option {
+	return func(j *Job) {
+		j.RunAt = time.Now().Add(d)
+	}
+}
+
+// At 在t执行, t早于当前时间时立即执行
+func At(t time.Time) Option {
+	return func(j *Job) {
+		j.RunAt = t
+	}
+}
+
+// MaxRetries 失败后最多重试n次, 0为不重试
+func MaxRetries(n int) Option {
+	return func(j *Job) {
+		j.MaxRetries = n
+	}
+}
+
+// Handler 一种任务的处理函数, 任务至少执行一次, 需要幂等
+type Handler interface {
+	Type() string
+	Handle(ctx context.Context, job *Job) error
+}
+
+type handlerFunc[T any] struct {
+	jobType string
+	fn      func(ctx context.Context, payload T) error
+}
+
+// HandlerFunc payload解码为T后调用fn, 解码失败时不重试
+//
+//	queue.HandlerFunc("uc_user.welcome", func(ctx context.Context, p *WelcomePayload) error {
+//		...
+//	})
+func HandlerFunc[T any](jobType string, fn func(ctx context.Context, payload T) error) Handler {
+	return &handlerFunc[T]{jobType: jobType, fn: fn}
+}
+
+func (h *handlerFunc[T]) Type() string {
+	return h.jobType
+}
+
+func (h *handlerFunc[T]) Handle(ctx context.Context, job *Job) error {
+	var payload T
+	if err := job.Decode(&payload); err != nil {
+		return Permanent(err)
+	}
+	return h.fn(ctx, payload)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent 处理函数返回该错误时不再重试, 直接进入死信
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent .
+func IsPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
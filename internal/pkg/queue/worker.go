@@ -0,0 +1,449 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"gin-layout/internal/pkg/redisx"
+	"gin-layout/internal/pkg/tenant"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	logs "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultConcurrency  = 10
+	DefaultBackoff      = time.Second
+	DefaultMaxBackoff   = 10 * time.Minute
+	DefaultTimeout      = 5 * time.Minute
+	DefaultPollInterval = time.Second
+	DefaultBlock        = 2 * time.Second
+	DefaultDeadMaxLen   = 10000
+
+	// Group 所有worker使用同一个消费组, 每个任务只被一个worker处理
+	Group = "workers"
+
+	fieldError     = "error"
+	promoteBatch   = 100
+	reclaimBatch   = 100
+	maxErrorLength = 1024
+)
+
+// ErrReclaimed 任务超过ClaimIdle没有确认, 认为worker已经崩溃, 记为一次失败
+var ErrReclaimed = errors.New("queue: job reclaimed from a crashed or timed out worker")
+
+// promoteScript 把到期的延迟任务移到stream, 多个worker同时执行时每个任务只移动一次
+var promoteScript = redis.NewScript(`
+redis.replicate_commands()
+local jobs = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+for _, job in ipairs(jobs) do
+	redis.call("XADD", KEYS[2], "*", "job", job)
+	redis.call("ZREM", KEYS[1], job)
+end
+return #jobs
+`)
+
+// Options 为零值的字段使用默认值
+type Options struct {
+	Prefix       string        // key的前缀, 与Client相同
+	Concurrency  int           // 同时执行的任务数
+	Backoff      time.Duration // 第一次重试的间隔, 之后每次翻倍
+	MaxBackoff   time.Duration // 重试间隔的上限
+	Timeout      time.Duration // 单个任务的执行时限, 超过后取消处理函数的ctx
+	ClaimIdle    time.Duration // 任务超过该时间没有确认时由其他worker认领, 默认Timeout+1分钟
+	PollInterval time.Duration // 检查延迟任务的间隔
+	Block        time.Duration // 读取stream的阻塞时间
+	DeadMaxLen   int64         // 死信stream的近似最大长度
+}
+
+// Worker 使用消费组读取stream中的任务并执行, 多个实例同时运行时共同消费
+// 失败按指数退避重试, 超过MaxRetries或返回Permanent错误时写入死信stream;
+// worker崩溃后未确认的任务在ClaimIdle后被其他worker认领, 记为一次失败后重试
+//
+//	worker, err := queue.NewWorker(rdb, handlers, queue.Options{}, logger)
+//	worker.Start()
+//	defer worker.Stop()
+type Worker struct {
+	rdb      redisx.Client
+	keys     keys
+	opts     Options
+	handlers map[string]Handler
+	logger   *logs.Entry
+	consumer string
+
+	sem       chan struct{}
+	jobs      sync.WaitGroup
+	stop      chan struct{}
+	done      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewWorker 同一种任务只能有一个处理函数
+func NewWorker(rdb redisx.Client, handlers []Handler, opts Options, logger *logs.Logger) (*Worker, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.ClaimIdle <= 0 {
+		opts.ClaimIdle = opts.Timeout + time.Minute
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.Block <= 0 {
+		opts.Block = DefaultBlock
+	}
+	if opts.DeadMaxLen <= 0 {
+		opts.DeadMaxLen = DefaultDeadMaxLen
+	}
+	m := make(map[string]Handler, len(handlers))
+	for _, h := range handlers {
+		if h.Type() == "" {
+			return nil, errors.New("queue: empty job type")
+		}
+		if _, ok := m[h.Type()]; ok {
+			return nil, errors.Errorf("queue: duplicate handler for %q", h.Type())
+		}
+		m[h.Type()] = h
+	}
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return &Worker{
+		rdb:      rdb,
+		keys:     newKeys(opts.Prefix),
+		opts:     opts,
+		handlers: m,
+		logger:   logs.NewEntry(logger).WithField("job", "queue_worker"),
+		consumer: host + "-" + hex.EncodeToString(b),
+		sem:      make(chan struct{}, opts.Concurrency),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Start 开始消费, 重复调用只启动一次
+func (w *Worker) Start() {
+	w.startOnce.Do(func() {
+		go w.run()
+	})
+}
+
+// Stop 停止读取新的任务, 等待正在执行的任务完成
+func (w *Worker) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	started := true
+	w.startOnce.Do(func() {
+		started = false
+	})
+	if started {
+		<-w.done
+	}
+}
+
+func (w *Worker) run() {
+	defer close(w.done)
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), "logger", w.logger))
+	defer cancel()
+	go func() {
+		select {
+		case <-w.stop:
+			cancel()
+		case <-w.done:
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.schedule(ctx)
+	}()
+	w.fetch(ctx)
+	wg.Wait()
+	w.jobs.Wait()
+}
+
+// fetch 有空闲的并发数时读取一个新任务
+func (w *Worker) fetch(ctx context.Context) {
+	groupReady := false
+	for {
+		select {
+		case w.sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		var msgs []redis.XMessage
+		err := w.ensureGroup(ctx, &groupReady)
+		if err == nil {
+			msgs, err = w.read(ctx)
+		}
+		if len(msgs) == 0 {
+			<-w.sem
+		} else {
+			w.dispatch(msgs[0], nil)
+		}
+		if err != nil {
+			w.logger.Errorf("queue read error: %+v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(w.opts.PollInterval):
+			}
+		}
+	}
+}
+
+// ensureGroup 创建消费组, stream不存在时一起创建
+func (w *Worker) ensureGroup(ctx context.Context, ready *bool) error {
+	if *ready {
+		return nil
+	}
+	err := w.rdb.WithContext(ctx).XGroupCreateMkStream(w.keys.stream, Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return errors.WithStack(err)
+	}
+	*ready = true
+	return nil
+}
+
+func (w *Worker) read(ctx context.Context) ([]redis.XMessage, error) {
+	streams, err := w.rdb.WithContext(ctx).XReadGroup(&redis.XReadGroupArgs{
+		Group:    Group,
+		Consumer: w.consumer,
+		Streams:  []string{w.keys.stream, ">"},
+		Count:    1,
+		Block:    w.opts.Block,
+	}).Result()
+	if err == redis.Nil || len(streams) == 0 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return streams[0].Messages, nil
+}
+
+// dispatch 已经占用了一个并发数, 执行完成后释放; cause不为nil时不执行, 直接记为失败
+func (w *Worker) dispatch(msg redis.XMessage, cause error) {
+	w.jobs.Add(1)
+	go func() {
+		defer func() {
+			<-w.sem
+			w.jobs.Done()
+		}()
+		w.process(msg, cause)
+	}()
+}
+
+// schedule 定期把到期的延迟任务移到stream, 并认领崩溃的worker未确认的任务
+func (w *Worker) schedule(ctx context.Context) {
+	ticker := time.NewTicker(w.opts.PollInterval)
+	defer ticker.Stop()
+	reclaimInterval := w.opts.ClaimIdle / 2
+	lastReclaim := time.Now()
+	for {
+		for ctx.Err() == nil {
+			n, err := w.promote(ctx)
+			if err != nil {
+				w.logger.Errorf("queue promote error: %+v", err)
+				break
+			}
+			if n < promoteBatch {
+				break
+			}
+		}
+		if time.Since(lastReclaim) >= reclaimInterval {
+			lastReclaim = time.Now()
+			if err := w.reclaim(ctx); err != nil {
+				w.logger.Errorf("queue reclaim error: %+v", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Worker) promote(ctx context.Context) (int64, error) {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	n, err := promoteScript.Run(w.rdb.WithContext(ctx), []string{w.keys.delayed, w.keys.stream}, now, promoteBatch).Int64()
+	return n, errors.WithStack(err)
+}
+
+// reclaim 认领超过ClaimIdle没有确认的任务
+func (w *Worker) reclaim(ctx context.Context) error {
+	rdb := w.rdb.WithContext(ctx)
+	pending, err := rdb.XPendingExt(&redis.XPendingExtArgs{
+		Stream: w.keys.stream,
+		Group:  Group,
+		Start:  "-",
+		End:    "+",
+		Count:  reclaimBatch,
+	}).Result()
+	if err == redis.Nil || err != nil && strings.HasPrefix(err.Error(), "NOGROUP") {
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	ids := make([]string, 0, len(pending))
+	for _, p := range pending {
+		if p.Idle >= w.opts.ClaimIdle {
+			ids = append(ids, p.Id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	msgs, err := rdb.XClaim(&redis.XClaimArgs{
+		Stream:   w.keys.stream,
+		Group:    Group,
+		Consumer: w.consumer,
+		MinIdle:  w.opts.ClaimIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, msg := range msgs {
+		select {
+		case w.sem <- struct{}{}:
+		case <-ctx.Done():
+			// 已认领的任务在ClaimIdle后再次被认领
+			return nil
+		}
+		w.logger.Warnf("queue reclaimed message %s", msg.ID)
+		w.dispatch(msg, ErrReclaimed)
+	}
+	return nil
+}
+
+// process 执行任务, 结果的写入不受Stop影响
+func (w *Worker) process(msg redis.XMessage, cause error) {
+	ctx := context.Background()
+	job, err := decodeJob(msg)
+	if err != nil {
+		w.logger.Errorf("queue decode error: %+v", err)
+		raw, _ := msg.Values[fieldJob].(string)
+		w.finish(ctx, msg.ID, w.deadPipe(raw, err.Error()))
+		return
+	}
+	if cause == nil {
+		start := time.Now()
+		cause = w.call(job)
+		if cause == nil {
+			w.finish(ctx, msg.ID, nil)
+			w.logger.Infof("queue job %s (%s) done in %s", job.ID, job.Type, time.Since(start))
+			return
+		}
+	}
+
+	job.Attempts++
+	job.LastError = truncate(cause.Error())
+	data, err := json.Marshal(job)
+	if err != nil {
+		w.logger.Errorf("queue job %s encode error: %+v", job.ID, err)
+		return
+	}
+	if IsPermanent(cause) || job.Attempts > job.MaxRetries {
+		w.logger.Errorf("queue job %s (%s) dead after %d attempts: %v", job.ID, job.Type, job.Attempts, cause)
+		w.finish(ctx, msg.ID, w.deadPipe(string(data), job.LastError))
+		return
+	}
+	backoff := w.backoff(job.Attempts - 1)
+	w.logger.Warnf("queue job %s (%s) attempt %d failed, retry in %s: %v", job.ID, job.Type, job.Attempts, backoff, cause)
+	score := float64(time.Now().Add(backoff).UnixMilli())
+	w.finish(ctx, msg.ID, func(pipe redis.Pipeliner) {
+		pipe.ZAdd(w.keys.delayed, redis.Z{Score: score, Member: data})
+	})
+}
+
+func (w *Worker) deadPipe(data, reason string) func(redis.Pipeliner) {
+	return func(pipe redis.Pipeliner) {
+		pipe.XAdd(&redis.XAddArgs{
+			Stream:       w.keys.dead,
+			MaxLenApprox: w.opts.DeadMaxLen,
+			Values:       map[string]any{fieldJob: data, fieldError: reason},
+		})
+	}
+}
+
+// finish 在同一个事务中执行fn、确认并删除消息
+func (w *Worker) finish(ctx context.Context, id string, fn func(redis.Pipeliner)) {
+	_, err := w.rdb.WithContext(ctx).TxPipelined(func(pipe redis.Pipeliner) error {
+		if fn != nil {
+			fn(pipe)
+		}
+		pipe.XAck(w.keys.stream, Group, id)
+		pipe.XDel(w.keys.stream, id)
+		return nil
+	})
+	if err != nil {
+		w.logger.Errorf("queue finish message %s error: %+v", id, err)
+	}
+}
+
+// call 执行处理函数, 恢复入队时的租户和请求id, panic记为失败
+func (w *Worker) call(job *Job) (err error) {
+	h, ok := w.handlers[job.Type]
+	if !ok {
+		return Permanent(errors.Errorf("queue: no handler for %q", job.Type))
+	}
+	entry := w.logger.WithFields(logs.Fields{"job_id": job.ID, "job_type": job.Type})
+	ctx := context.Background()
+	if job.RequestID != "" {
+		entry = entry.WithField("request_id", job.RequestID)
+		ctx = context.WithValue(ctx, "request_id", job.RequestID)
+	}
+	if job.TenantID != "" {
+		ctx = tenant.WithTenant(ctx, job.TenantID)
+	}
+	ctx, cancel := context.WithTimeout(context.WithValue(ctx, "logger", entry), w.opts.Timeout)
+	defer cancel()
+	defer func() {
+		if e := recover(); e != nil {
+			err = errors.Errorf("panic: %v", e)
+			entry.Errorf("queue job panic: %v\n%s", e, debug.Stack())
+		}
+	}()
+	return h.Handle(ctx, job)
+}
+
+func (w *Worker) backoff(attempts int) time.Duration {
+	backoff := w.opts.Backoff
+	for i := 0; i < attempts && backoff < w.opts.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > w.opts.MaxBackoff {
+		backoff = w.opts.MaxBackoff
+	}
+	return backoff
+}
+
+func truncate(s string) string {
+	if len(s) > maxErrorLength {
+		return s[:maxErrorLength]
+	}
+	return s
+}
@@ -0,0 +1,180 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"gin-layout/internal/pkg/redisx"
+	"gin-layout/internal/pkg/tenant"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	logs "github.com/sirupsen/logrus"
+)
+
+type testPayload struct {
+	Name string `json:"name"`
+}
+
+func newClient(t *testing.T) (*miniredis.Miniredis, redisx.Client) {
+	t.Helper()
+	m := miniredis.RunT(t)
+	c := redisx.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { _ = c.Close() })
+	return m, c
+}
+
+func startWorker(t *testing.T, rdb redisx.Client, handlers ...Handler) {
+	t.Helper()
+	logger := logs.New()
+	logger.SetOutput(io.Discard)
+	w, err := NewWorker(rdb, handlers, Options{
+		Backoff:      10 * time.Millisecond,
+		PollInterval: 10 * time.Millisecond,
+		Block:        50 * time.Millisecond,
+	}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Start()
+	t.Cleanup(w.Stop)
+}
+
+func wait[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	var zero T
+	return zero
+}
+
+// deadJobs 等待死信stream中出现n个任务
+func deadJobs(t *testing.T, m *miniredis.Miniredis, n int) []*Job {
+	t.Helper()
+	key := newKeys("").dead
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		entries, err := m.Stream(key)
+		if err != nil || len(entries) < n {
+			continue
+		}
+		jobs := make([]*Job, 0, len(entries))
+		for _, e := range entries {
+			// Values为字段和值交替的列表
+			values := map[string]any{}
+			for i := 0; i+1 < len(e.Values); i += 2 {
+				values[e.Values[i]] = e.Values[i+1]
+			}
+			job, err := decodeJob(redis.XMessage{ID: e.ID, Values: values})
+			if err != nil {
+				t.Fatal(err)
+			}
+			jobs = append(jobs, job)
+		}
+		return jobs
+	}
+	t.Fatalf("dead jobs less than %d", n)
+	return nil
+}
+
+func TestWorker(t *testing.T) {
+	_, rdb := newClient(t)
+	type result struct {
+		payload   testPayload
+		tenant    string
+		requestID string
+	}
+	results := make(chan result, 1)
+	startWorker(t, rdb, HandlerFunc("test.run", func(ctx context.Context, p testPayload) error {
+		requestID, _ := ctx.Value("request_id").(string)
+		results <- result{payload: p, tenant: tenant.FromContext(ctx), requestID: requestID}
+		return nil
+	}))
+
+	// 入队时的租户和请求id在处理函数中恢复
+	ctx := context.WithValue(tenant.WithTenant(context.Background(), "a"), "request_id", "r1")
+	if _, err := NewClient(rdb, "", -1).Enqueue(ctx, "test.run", testPayload{Name: "n"}); err != nil {
+		t.Fatal(err)
+	}
+	got := wait(t, results)
+	if got != (result{payload: testPayload{Name: "n"}, tenant: "a", requestID: "r1"}) {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	m, rdb := newClient(t)
+	client := NewClient(rdb, "", -1)
+	ctx := context.Background()
+	if _, err := client.Enqueue(ctx, "test.run", nil, Delay(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Enqueue(ctx, "test.run", nil, At(time.Now().Add(-time.Minute))); err != nil {
+		t.Fatal(err)
+	}
+	// 延迟的任务写入zset, 已经到期的直接写入stream
+	k := newKeys("")
+	delayed, err := m.ZMembers(k.delayed)
+	if err != nil || len(delayed) != 1 {
+		t.Fatalf("delayed got %d, %v", len(delayed), err)
+	}
+	entries, err := m.Stream(k.stream)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("stream got %d, %v", len(entries), err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	m, rdb := newClient(t)
+	calls := make(chan string, 10)
+	startWorker(t, rdb,
+		HandlerFunc("test.fail", func(ctx context.Context, p testPayload) error {
+			calls <- "fail"
+			return errors.New("boom")
+		}),
+		HandlerFunc("test.permanent", func(ctx context.Context, p testPayload) error {
+			calls <- "permanent"
+			return Permanent(errors.New("bad"))
+		}),
+	)
+	client := NewClient(rdb, "", -1)
+	ctx := context.Background()
+	if _, err := client.Enqueue(ctx, "test.fail", nil, MaxRetries(2)); err != nil {
+		t.Fatal(err)
+	}
+	// 失败后经过延迟zset重试, 超过MaxRetries后进入死信
+	dead := deadJobs(t, m, 1)
+	if dead[0].Type != "test.fail" || dead[0].Attempts != 3 || dead[0].LastError != "boom" {
+		t.Fatalf("dead got %+v", dead[0])
+	}
+
+	// Permanent不重试, 没有处理函数的任务也直接进入死信
+	if _, err := client.Enqueue(ctx, "test.permanent", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Enqueue(ctx, "test.unknown", nil); err != nil {
+		t.Fatal(err)
+	}
+	dead = deadJobs(t, m, 3)
+	for _, job := range dead[1:] {
+		if job.Attempts != 1 {
+			t.Fatalf("dead got %+v", job)
+		}
+	}
+	close(calls)
+	n := map[string]int{}
+	for c := range calls {
+		n[c]++
+	}
+	if n["fail"] != 3 || n["permanent"] != 1 {
+		t.Fatalf("calls got %v", n)
+	}
+	if entries, _ := m.Stream(newKeys("").stream); len(entries) != 0 {
+		t.Fatalf("stream left %d", len(entries))
+	}
+}
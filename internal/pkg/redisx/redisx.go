@@ -0,0 +1,54 @@
+package redisx
+
+import (
+	"context"
+
+	"github.com/go-redis/redis"
+)
+
+// Client 单节点、哨兵、集群的redis客户端, 用法与*redis.Client相同
+//
+//	rdb.WithContext(ctx).Get(key)
+//
+// 集群模式下一条命令的多个key需要在同一个slot, 否则使用Pipeline逐个执行
+type Client interface {
+	redis.UniversalClient
+	Context() context.Context
+	WithContext(ctx context.Context) Client
+}
+
+var (
+	_ Client = client{}
+	_ Client = clusterClient{}
+)
+
+// NewClient 单节点
+func NewClient(opt *redis.Options) Client {
+	return client{redis.NewClient(opt)}
+}
+
+// NewFailoverClient 哨兵, 通过哨兵获取主节点地址, 主从切换后自动连接新的主节点
+func NewFailoverClient(opt *redis.FailoverOptions) Client {
+	return client{redis.NewFailoverClient(opt)}
+}
+
+// NewClusterClient 集群
+func NewClusterClient(opt *redis.ClusterOptions) Client {
+	return clusterClient{redis.NewClusterClient(opt)}
+}
+
+type client struct {
+	*redis.Client
+}
+
+func (c client) WithContext(ctx context.Context) Client {
+	return client{c.Client.WithContext(ctx)}
+}
+
+type clusterClient struct {
+	*redis.ClusterClient
+}
+
+func (c clusterClient) WithContext(ctx context.Context) Client {
+	return clusterClient{c.ClusterClient.WithContext(ctx)}
+}
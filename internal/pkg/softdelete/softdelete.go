@@ -0,0 +1,278 @@
+package softdelete
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	NotDeleted Flag = 0
+	Deleted    Flag = 1
+
+	// DeletedAtField DeletedByField 删除时一并记录的字段, 模型中没有这些字段时忽略
+	DeletedAtField = "deleted_at"
+	DeletedByField = "deleted_by"
+
+	// loginUserKey gin.Context中登录用户id的key, 没有通过WithOperator指定操作人时使用
+	loginUserKey = "login_user_id"
+)
+
+// Flag 软删除标记, 模型中使用该类型的字段后:
+// 查询和更新默认只处理未删除的数据, Delete改为 is_del=1 并记录 deleted_at/deleted_by,
+// 需要处理已删除数据时使用Unscoped或OnlyTrashed
+//
+//	type Model struct {
+//		IsDel     softdelete.Flag `gorm:"column:is_del"`
+//		DeletedAt *time.Time      `gorm:"column:deleted_at"`
+//		DeletedBy uint64          `gorm:"column:deleted_by"`
+//	}
+type Flag int8
+
+type operatorKey struct{}
+
+// WithOperator 指定删除操作人, 不指定时使用gin.Context中的login_user_id
+func WithOperator(ctx context.Context, userId uint64) context.Context {
+	return context.WithValue(ctx, operatorKey{}, userId)
+}
+
+func operator(ctx context.Context) uint64 {
+	if ctx == nil {
+		return 0
+	}
+	if id, ok := ctx.Value(operatorKey{}).(uint64); ok {
+		return id
+	}
+	id, _ := ctx.Value(loginUserKey).(uint64)
+	return id
+}
+
+// Scan implements the Scanner interface.
+func (f *Flag) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*f = NotDeleted
+	case int64:
+		*f = Flag(v)
+	case []byte:
+		return f.parse(string(v))
+	case string:
+		return f.parse(v)
+	default:
+		return fmt.Errorf("softdelete: unsupported scan type %T", value)
+	}
+	return nil
+}
+
+func (f *Flag) parse(s string) error {
+	var v int8
+	if _, err := fmt.Sscan(s, &v); err != nil {
+		return err
+	}
+	*f = Flag(v)
+	return nil
+}
+
+// Value implements the driver Valuer interface.
+func (f Flag) Value() (driver.Value, error) {
+	return int64(f), nil
+}
+
+// QueryClauses 查询时添加 is_del=0
+func (Flag) QueryClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{queryClause{Field: f}}
+}
+
+// UpdateClauses 更新时添加 is_del=0
+func (Flag) UpdateClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{updateClause{Field: f}}
+}
+
+// DeleteClauses 删除改为更新删除标记
+func (Flag) DeleteClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{deleteClause{Field: f}}
+}
+
+type queryClause struct {
+	Field *schema.Field
+}
+
+func (queryClause) Name() string               { return "" }
+func (queryClause) Build(clause.Builder)       {}
+func (queryClause) MergeClause(*clause.Clause) {}
+
+func (sd queryClause) ModifyStatement(stmt *gorm.Statement) {
+	if _, ok := stmt.Clauses["soft_delete_enabled"]; ok || stmt.Unscoped {
+		return
+	}
+	// 已有的单个OR条件需要先用括号包起来, 否则会和 is_del=0 组成 a OR b AND is_del=0
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) >= 1 {
+			for _, expr := range where.Exprs {
+				if orCond, ok := expr.(clause.OrConditions); ok && len(orCond.Exprs) == 1 {
+					where.Exprs = []clause.Expression{clause.And(where.Exprs...)}
+					c.Expression = where
+					stmt.Clauses["WHERE"] = c
+					break
+				}
+			}
+		}
+	}
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: sd.Field.DBName}, Value: NotDeleted},
+	}})
+	stmt.Clauses["soft_delete_enabled"] = clause.Clause{}
+}
+
+type updateClause struct {
+	Field *schema.Field
+}
+
+func (updateClause) Name() string               { return "" }
+func (updateClause) Build(clause.Builder)       {}
+func (updateClause) MergeClause(*clause.Clause) {}
+
+func (sd updateClause) ModifyStatement(stmt *gorm.Statement) {
+	if stmt.SQL.Len() == 0 && !stmt.Unscoped {
+		queryClause(sd).ModifyStatement(stmt)
+	}
+}
+
+type deleteClause struct {
+	Field *schema.Field
+}
+
+func (deleteClause) Name() string               { return "" }
+func (deleteClause) Build(clause.Builder)       {}
+func (deleteClause) MergeClause(*clause.Clause) {}
+
+func (sd deleteClause) ModifyStatement(stmt *gorm.Statement) {
+	if stmt.SQL.Len() > 0 || stmt.Unscoped {
+		return
+	}
+	set := clause.Set{{Column: clause.Column{Name: sd.Field.DBName}, Value: Deleted}}
+	stmt.SetColumn(sd.Field.DBName, Deleted, true)
+	if field := stmt.Schema.LookUpField(DeletedAtField); field != nil {
+		now := stmt.DB.NowFunc()
+		set = append(set, clause.Assignment{Column: clause.Column{Name: field.DBName}, Value: now})
+		stmt.SetColumn(field.DBName, now, true)
+	}
+	if field := stmt.Schema.LookUpField(DeletedByField); field != nil {
+		by := operator(stmt.Context)
+		set = append(set, clause.Assignment{Column: clause.Column{Name: field.DBName}, Value: by})
+		stmt.SetColumn(field.DBName, by, true)
+	}
+	stmt.AddClause(set)
+
+	// 与gorm.DeletedAt一致, 使用传入对象的主键作为条件
+	_, queryValues := schema.GetIdentityFieldValuesMap(stmt.Context, stmt.ReflectValue, stmt.Schema.PrimaryFields)
+	column, values := schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, queryValues)
+	if len(values) > 0 {
+		stmt.AddClause(clause.Where{Exprs: []clause.Expression{clause.IN{Column: column, Values: values}}})
+	}
+	if stmt.ReflectValue.CanAddr() && stmt.Dest != stmt.Model && stmt.Model != nil {
+		_, queryValues = schema.GetIdentityFieldValuesMap(stmt.Context, reflect.ValueOf(stmt.Model), stmt.Schema.PrimaryFields)
+		column, values = schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, queryValues)
+		if len(values) > 0 {
+			stmt.AddClause(clause.Where{Exprs: []clause.Expression{clause.IN{Column: column, Values: values}}})
+		}
+	}
+
+	queryClause(sd).ModifyStatement(stmt)
+	stmt.AddClauseIfNotExists(clause.Update{})
+	stmt.Build(stmt.DB.Callback().Update().Clauses...)
+}
+
+// OnlyTrashed 只查询已删除的数据, 用于回收站列表, 需要先调用Model
+//
+//	db.Model(&model.UcUser{}).Scopes(softdelete.OnlyTrashed)
+func OnlyTrashed(db *gorm.DB) *gorm.DB {
+	field, err := flagField(db)
+	if err != nil {
+		_ = db.AddError(err)
+		return db
+	}
+	return db.Unscoped().Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: Deleted})
+}
+
+// WithTrashed 同时查询已删除和未删除的数据
+func WithTrashed(db *gorm.DB) *gorm.DB {
+	return db.Unscoped()
+}
+
+// Restore 恢复db条件匹配的已删除数据, 清空 deleted_at/deleted_by
+//
+//	softdelete.Restore(db.Model(&model.UcUser{}).Where("id IN ?", ids))
+func Restore(db *gorm.DB) *gorm.DB {
+	field, err := flagField(db)
+	if err != nil {
+		_ = db.AddError(err)
+		return db
+	}
+	values := map[string]any{field.DBName: NotDeleted}
+	if f := db.Statement.Schema.LookUpField(DeletedAtField); f != nil {
+		values[f.DBName] = nil
+	}
+	if f := db.Statement.Schema.LookUpField(DeletedByField); f != nil {
+		values[f.DBName] = 0
+	}
+	return OnlyTrashed(db).UpdateColumns(values)
+}
+
+// Purge 物理删除 deleted_at 早于before的已删除数据, 每次最多删除limit条, 返回删除的条数
+// 需要模型有 deleted_at 字段, 调用方循环调用直到返回0
+func Purge(db *gorm.DB, before time.Time, limit int) (int64, error) {
+	field, err := flagField(db)
+	if err != nil {
+		return 0, err
+	}
+	sch := db.Statement.Schema
+	deletedAt := sch.LookUpField(DeletedAtField)
+	if deletedAt == nil || sch.PrioritizedPrimaryField == nil {
+		return 0, fmt.Errorf("softdelete: %s has no %s or primary key", sch.Name, DeletedAtField)
+	}
+	pk := sch.PrioritizedPrimaryField.DBName
+
+	// 先查出主键再按主键删除, 避免大范围的 DELETE ... WHERE 长时间锁表
+	dest := reflect.New(reflect.SliceOf(sch.PrioritizedPrimaryField.FieldType))
+	err = db.Session(&gorm.Session{}).Unscoped().
+		Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: Deleted}).
+		Where(clause.Lt{Column: clause.Column{Table: clause.CurrentTable, Name: deletedAt.DBName}, Value: before}).
+		Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: pk}}).
+		Limit(limit).
+		Pluck(pk, dest.Interface()).Error
+	if err != nil || dest.Elem().Len() == 0 {
+		return 0, err
+	}
+	ids := make([]any, 0, dest.Elem().Len())
+	for i := 0; i < dest.Elem().Len(); i++ {
+		ids = append(ids, dest.Elem().Index(i).Interface())
+	}
+	res := db.Session(&gorm.Session{NewDB: true}).Unscoped().Model(db.Statement.Model).
+		Where(clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: pk}, Values: ids}).
+		Delete(db.Statement.Model)
+	return res.RowsAffected, res.Error
+}
+
+// flagField 解析db.Statement.Model, 找到Flag类型的字段
+func flagField(db *gorm.DB) (*schema.Field, error) {
+	if db.Statement.Model == nil {
+		return nil, fmt.Errorf("softdelete: model is required")
+	}
+	if err := db.Statement.Parse(db.Statement.Model); err != nil {
+		return nil, err
+	}
+	flagType := reflect.TypeOf(Flag(0))
+	for _, field := range db.Statement.Schema.Fields {
+		if field.FieldType == flagType {
+			return field, nil
+		}
+	}
+	return nil, fmt.Errorf("softdelete: %s has no soft delete field", db.Statement.Schema.Name)
+}
@@ -0,0 +1,133 @@
+package tenant
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// enabledClause 语句已经添加过租户条件
+const enabledClause = "tenant_enabled"
+
+var scopedType = reflect.TypeOf((*Scoped)(nil)).Elem()
+
+// Plugin gorm插件, 嵌入Mixin的模型按ctx中的租户隔离
+// 只处理通过Model/Find等指定了模型的语句, Raw/Exec和只指定Table的语句不会添加租户条件
+//
+//	db.Use(tenant.New())
+type Plugin struct {
+	scoped sync.Map // reflect.Type -> bool
+}
+
+// New .
+func New() *Plugin {
+	return &Plugin{}
+}
+
+func (p *Plugin) Name() string {
+	return "tenant"
+}
+
+func (p *Plugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register("tenant:create", p.create); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := cb.Query().Before("gorm:query").Register("tenant:query", p.scope); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := cb.Row().Before("gorm:row").Register("tenant:row", p.scope); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := cb.Update().Before("gorm:update").Register("tenant:update", p.scope); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(cb.Delete().Before("gorm:delete").Register("tenant:delete", p.scope))
+}
+
+func (p *Plugin) isScoped(stmt *gorm.Statement) bool {
+	if stmt.Schema == nil {
+		return false
+	}
+	t := stmt.Schema.ModelType
+	if v, ok := p.scoped.Load(t); ok {
+		return v.(bool)
+	}
+	ok := reflect.PtrTo(t).Implements(scopedType) && stmt.Schema.LookUpField(Column) != nil
+	p.scoped.Store(t, ok)
+	return ok
+}
+
+// tenant 当前语句的租户, 不需要隔离时返回false
+func (p *Plugin) tenant(db *gorm.DB) (string, bool) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.SQL.Len() > 0 || !p.isScoped(stmt) || IsBypassed(stmt.Context) {
+		return "", false
+	}
+	id := FromContext(stmt.Context)
+	if id == "" {
+		_ = db.AddError(ErrMissing)
+		return "", false
+	}
+	return id, true
+}
+
+// scope 添加 tenant_id = ?
+func (p *Plugin) scope(db *gorm.DB) {
+	stmt := db.Statement
+	if _, ok := stmt.Clauses[enabledClause]; ok {
+		return
+	}
+	id, ok := p.tenant(db)
+	if !ok {
+		return
+	}
+	// 与软删除一致, 已有的单个OR条件需要先用括号包起来, 否则会组成 a OR b AND tenant_id = ?
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok {
+			for _, expr := range where.Exprs {
+				if orCond, ok := expr.(clause.OrConditions); ok && len(orCond.Exprs) == 1 {
+					where.Exprs = []clause.Expression{clause.And(where.Exprs...)}
+					c.Expression = where
+					stmt.Clauses["WHERE"] = c
+					break
+				}
+			}
+		}
+	}
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: Column}, Value: id},
+	}})
+	stmt.Clauses[enabledClause] = clause.Clause{}
+}
+
+// create 设置tenant_id, 已经设置了其他租户时返回ErrMismatch
+func (p *Plugin) create(db *gorm.DB) {
+	id, ok := p.tenant(db)
+	if !ok {
+		return
+	}
+	stmt := db.Statement
+	field := stmt.Schema.LookUpField(Column)
+	set := func(rv reflect.Value) {
+		v, zero := field.ValueOf(stmt.Context, rv)
+		if zero {
+			_ = db.AddError(field.Set(stmt.Context, rv, id))
+		} else if v != id {
+			_ = db.AddError(errors.WithStack(ErrMismatch))
+		}
+	}
+	switch rv := reflect.Indirect(stmt.ReflectValue); rv.Kind() {
+	case reflect.Struct:
+		set(rv)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			set(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Map:
+		stmt.SetColumn(Column, id)
+	}
+}
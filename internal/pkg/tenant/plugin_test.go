@@ -0,0 +1,212 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type scopedRow struct {
+	ID uint64 `gorm:"primaryKey"`
+	Mixin
+	Name      string
+	Score     int
+	DeletedAt gorm.DeletedAt
+}
+
+type plainRow struct {
+	ID   uint64 `gorm:"primaryKey"`
+	Name string
+}
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	// 每个连接是独立的内存数据库, 只使用一个连接
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err = db.AutoMigrate(&scopedRow{}, &plainRow{}); err != nil {
+		t.Fatal(err)
+	}
+	// 不经过插件写入两个租户的数据
+	rows := []*scopedRow{
+		{ID: 1, Mixin: Mixin{TenantID: "a"}, Name: "x", Score: 1},
+		{ID: 2, Mixin: Mixin{TenantID: "a"}, Name: "y", Score: 2},
+		{ID: 3, Mixin: Mixin{TenantID: "a"}, Name: "z", Score: 3},
+		{ID: 4, Mixin: Mixin{TenantID: "b"}, Name: "x", Score: 1},
+		{ID: 5, Mixin: Mixin{TenantID: "b"}, Name: "y", Score: 2},
+		{ID: 6, Mixin: Mixin{TenantID: "a"}, Name: "x", Score: 9, DeletedAt: gorm.DeletedAt{Valid: true}},
+	}
+	if err = db.Create(rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Use(New()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestScopeQuery(t *testing.T) {
+	db := openTestDB(t)
+	ctx := WithTenant(context.Background(), "a")
+	cases := []struct {
+		name  string
+		query func(db *gorm.DB) *gorm.DB
+		want  string
+	}{
+		{"no condition", func(db *gorm.DB) *gorm.DB { return db }, "[1 2 3]"},
+		{"where", func(db *gorm.DB) *gorm.DB { return db.Where("name = ?", "x") }, "[1]"},
+		{"where or", func(db *gorm.DB) *gorm.DB {
+			return db.Where("name = ?", "x").Or("name = ?", "y")
+		}, "[1 2]"},
+		{"single or", func(db *gorm.DB) *gorm.DB { return db.Or("name = ?", "y") }, "[2]"},
+		{"or with struct", func(db *gorm.DB) *gorm.DB {
+			return db.Where(&scopedRow{Name: "x"}).Or(&scopedRow{Name: "y"})
+		}, "[1 2]"},
+		{"multiple or", func(db *gorm.DB) *gorm.DB {
+			return db.Where("name = ?", "x").Or("name = ?", "y").Or("score > ?", 2)
+		}, "[1 2 3]"},
+		{"grouped or", func(db *gorm.DB) *gorm.DB {
+			return db.Where(db.Session(&gorm.Session{NewDB: true}).Where("name = ?", "x").Or("name = ?", "y")).Where("score > ?", 1)
+		}, "[2]"},
+		{"raw or in where", func(db *gorm.DB) *gorm.DB { return db.Where("name = ? OR name = ?", "x", "y") }, "[1 2]"},
+		{"not", func(db *gorm.DB) *gorm.DB { return db.Not("name = ?", "x") }, "[2 3]"},
+		{"or tenant of others", func(db *gorm.DB) *gorm.DB {
+			return db.Where("name = ?", "x").Or("tenant_id = ?", "b")
+		}, "[1]"},
+		// Unscoped只去掉软删除条件, 租户条件仍然生效
+		{"unscoped or", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped().Where("name = ?", "x").Or("score = ?", 2)
+		}, "[1 2 6]"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var ids []uint64
+			if err := c.query(db.WithContext(ctx).Model(&scopedRow{})).Order("id").Pluck("id", &ids).Error; err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(ids); got != c.want {
+				t.Fatalf("got %s, want %s", got, c.want)
+			}
+			var n int64
+			if err := c.query(db.WithContext(ctx).Model(&scopedRow{})).Count(&n).Error; err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(n) != fmt.Sprint(len(strings.Fields(strings.Trim(c.want, "[]")))) {
+				t.Fatalf("count got %d, want %s", n, c.want)
+			}
+		})
+	}
+}
+
+func TestScopeSQL(t *testing.T) {
+	db := openTestDB(t)
+	ctx := WithTenant(context.Background(), "a")
+	sql := db.WithContext(ctx).ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&scopedRow{}).Where("name = ?", "x").Or("name = ?", "y").Find(&[]scopedRow{})
+	})
+	want := "WHERE (name = \"x\" OR name = \"y\") AND `scoped_rows`.`tenant_id` = \"a\""
+	if !strings.Contains(sql, want) {
+		t.Fatalf("got %s, want it to contain %s", sql, want)
+	}
+}
+
+func TestScopeWrite(t *testing.T) {
+	cases := []struct {
+		name  string
+		exec  func(db *gorm.DB) *gorm.DB
+		count int64
+		left  string // 执行后所有未删除的数据
+	}{
+		{"update or", func(db *gorm.DB) *gorm.DB {
+			return db.Model(&scopedRow{}).Where("name = ?", "x").Or("name = ?", "y").Update("score", 0)
+		}, 2, "1:0 2:0 3:3 4:1 5:2"},
+		{"delete or", func(db *gorm.DB) *gorm.DB {
+			return db.Where("name = ?", "x").Or("name = ?", "y").Delete(&scopedRow{})
+		}, 2, "3:3 4:1 5:2"},
+		{"unscoped delete or", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped().Where("name = ?", "z").Or("score = ?", 1).Delete(&scopedRow{})
+		}, 2, "2:2 4:1 5:2"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			db := openTestDB(t)
+			res := c.exec(db.WithContext(WithTenant(context.Background(), "a")))
+			if res.Error != nil {
+				t.Fatal(res.Error)
+			}
+			if res.RowsAffected != c.count {
+				t.Fatalf("affected %d, want %d", res.RowsAffected, c.count)
+			}
+			var rows []scopedRow
+			if err := db.WithContext(Bypass(context.Background())).Order("id").Find(&rows).Error; err != nil {
+				t.Fatal(err)
+			}
+			left := make([]string, 0, len(rows))
+			for _, r := range rows {
+				left = append(left, fmt.Sprintf("%d:%d", r.ID, r.Score))
+			}
+			if got := strings.Join(left, " "); got != c.left {
+				t.Fatalf("got %s, want %s", got, c.left)
+			}
+		})
+	}
+}
+
+func TestScopeContext(t *testing.T) {
+	db := openTestDB(t)
+	var n int64
+	// 没有租户时返回ErrMissing
+	err := db.WithContext(context.Background()).Model(&scopedRow{}).Or("name = ?", "x").Count(&n).Error
+	if !errors.Is(err, ErrMissing) {
+		t.Fatalf("got %v, want ErrMissing", err)
+	}
+	// Bypass不添加租户条件
+	if err = db.WithContext(Bypass(context.Background())).Model(&scopedRow{}).Where("name = ?", "x").Or("name = ?", "y").Count(&n).Error; err != nil || n != 4 {
+		t.Fatalf("bypass got %d, %v", n, err)
+	}
+	// gin.Context中的租户
+	ctx := context.WithValue(context.Background(), ContextKey, "b")
+	if err = db.WithContext(ctx).Model(&scopedRow{}).Count(&n).Error; err != nil || n != 2 {
+		t.Fatalf("context key got %d, %v", n, err)
+	}
+	// 没有嵌入Mixin的模型不受影响
+	if err = db.WithContext(context.Background()).Model(&plainRow{}).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	db := openTestDB(t)
+	ctx := WithTenant(context.Background(), "b")
+	rows := []*scopedRow{{ID: 10, Name: "new"}, {ID: 11, Mixin: Mixin{TenantID: "b"}, Name: "new"}}
+	if err := db.WithContext(ctx).Create(rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rows {
+		if r.TenantID != "b" {
+			t.Fatalf("got tenant %q", r.TenantID)
+		}
+	}
+	if err := db.WithContext(ctx).Model(&scopedRow{}).Create(map[string]any{"id": 12, "name": "map"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var tenantID string
+	if err := db.WithContext(ctx).Model(&scopedRow{}).Where("id = ?", 12).Pluck("tenant_id", &tenantID).Error; err != nil || tenantID != "b" {
+		t.Fatalf("map create got %q, %v", tenantID, err)
+	}
+	err := db.WithContext(ctx).Create(&scopedRow{ID: 13, Mixin: Mixin{TenantID: "a"}}).Error
+	if !errors.Is(err, ErrMismatch) {
+		t.Fatalf("got %v, want ErrMismatch", err)
+	}
+}
@@ -0,0 +1,104 @@
+package tenant
+
+import (
+	"context"
+	"gin-layout/pkg/errResponse"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+const (
+	// Column 租户字段的列名
+	Column = "tenant_id"
+	// ContextKey gin.Context中租户的key, 由中间件从请求头/子域名解析, 登录校验时可以用token中的租户覆盖
+	ContextKey = "tenant_id"
+
+	keyPrefix = "tenant:"
+)
+
+var (
+	// ErrMissing 查询按租户隔离的模型时ctx中没有租户
+	ErrMissing = errResponse.SetCustomizeErrInfoByReason(errResponse.ReasonTenantIsRequired)
+	// ErrMismatch 创建的数据的租户与ctx中的租户不一致
+	ErrMismatch = errors.New("tenant: tenant_id does not match the context")
+)
+
+// Mixin 嵌入Mixin的模型按租户隔离:
+// 查询、更新、删除自动添加 tenant_id = ?, 创建时自动设置tenant_id, ctx中没有租户时返回ErrMissing;
+// gorm的Unscoped不影响租户条件, 跨租户访问需要使用Bypass
+//
+//	type UcUser struct {
+//		model.Model
+//		tenant.Mixin
+//	}
+type Mixin struct {
+	TenantID string `gorm:"column:tenant_id"`
+}
+
+// Tenant 实现Scoped
+func (m Mixin) Tenant() string {
+	return m.TenantID
+}
+
+// Scoped 按租户隔离的模型, 嵌入Mixin即可
+type Scoped interface {
+	Tenant() string
+}
+
+type tenantKey struct{}
+
+type bypassKey struct{}
+
+// WithTenant 指定租户, 不指定时使用gin.Context中的tenant_id, 用于任务等非请求的场景
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// FromContext 当前的租户, 没有时为空
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(tenantKey{}).(string); ok {
+		return id
+	}
+	id, _ := ctx.Value(ContextKey).(string)
+	return id
+}
+
+// Bypass 不添加租户条件, 用于后台任务和跨租户的管理功能, 需要显式调用
+//
+//	d.DB(tenant.Bypass(ctx)).Model(&model.UcUser{}).Count(&n)
+func Bypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+// IsBypassed ctx是否通过Bypass跳过了租户隔离
+func IsBypassed(ctx context.Context) bool {
+	v, _ := ctx.Value(bypassKey{}).(bool)
+	return v
+}
+
+// Key 按租户区分的redis key, 没有租户时返回原key
+//
+//	locker.WithLock(ctx, tenant.Key(ctx, "uc_user:serial_number"), fn)
+func Key(ctx context.Context, key string) string {
+	if id := FromContext(ctx); id != "" {
+		return keyPrefix + id + ":" + key
+	}
+	return key
+}
+
+// Check 检查不经过数据库读取的数据(如缓存)是否属于当前租户, 不属于时返回gorm.ErrRecordNotFound
+func Check(ctx context.Context, v any) error {
+	s, ok := v.(Scoped)
+	if !ok || IsBypassed(ctx) {
+		return nil
+	}
+	id := FromContext(ctx)
+	if id == "" {
+		return ErrMissing
+	}
+	if s.Tenant() != id {
+		return errors.WithStack(gorm.ErrRecordNotFound)
+	}
+	return nil
+}
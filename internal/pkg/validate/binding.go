@@ -0,0 +1,64 @@
+package validate
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+// bindingValidator 替换gin默认的binding.Validator, 与biz层共用同一套规则和翻译
+type bindingValidator struct {
+	v *Validate
+}
+
+var _ binding.StructValidator = (*bindingValidator)(nil)
+
+// Binding 返回gin使用的校验器, 用法: binding.Validator = validate.Binding()
+func Binding() binding.StructValidator {
+	return &bindingValidator{v: Default()}
+}
+
+// ValidateStruct 只校验结构体/结构体指针以及它们的切片, 切片会记录出错元素的下标
+func (b *bindingValidator) ValidateStruct(obj any) error {
+	if obj == nil {
+		return nil
+	}
+	value := reflect.ValueOf(obj)
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() {
+			return nil
+		}
+		return b.ValidateStruct(value.Elem().Interface())
+	case reflect.Struct:
+		return wrapInvalid(b.v.Engine(TagBinding).Struct(obj), TagBinding, value.Type(), "")
+	case reflect.Slice, reflect.Array:
+		ie := &invalidError{}
+		for i := 0; i < value.Len(); i++ {
+			err := b.ValidateStruct(value.Index(i).Interface())
+			if err == nil {
+				continue
+			}
+			sub, ok := err.(*invalidError)
+			if !ok {
+				return err
+			}
+			for _, item := range sub.items {
+				item.prefix = fmt.Sprintf("[%d]%s", i, item.prefix)
+				ie.items = append(ie.items, item)
+			}
+		}
+		if len(ie.items) == 0 {
+			return nil
+		}
+		return ie
+	default:
+		return nil
+	}
+}
+
+// Engine 返回binding tag的validator.Validate, gin通过它注册自定义规则
+func (b *bindingValidator) Engine() any {
+	return b.v.Engine(TagBinding)
+}
@@ -0,0 +1,230 @@
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+)
+
+// Rule 自定义校验规则, 通过RegisterRule同时注册到binding和validate两个tag
+//
+//	type Req struct {
+//		Mobile string `json:"mobile" binding:"required,mobile"`
+//	}
+type Rule struct {
+	Tag string
+	// Fn 为nil时只注册翻译, 用于结构体级别校验中ReportError的tag
+	Fn validator.Func
+	// CallEvenIfNull 字段为nil时也执行校验
+	CallEvenIfNull bool
+	// Messages 各语言的错误信息, {0}为字段名, {1}为Param(Param为nil时使用规则的参数)
+	Messages map[string]string
+	// Param 翻译时{1}的值, 为nil时使用规则的参数
+	Param func(fe validator.FieldError) string
+}
+
+var (
+	mobileRegexp   = regexp.MustCompile(`^1[3-9]\d{9}$`)
+	usernameRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{3,19}$`)
+	idCardRegexp   = regexp.MustCompile(`^[1-9]\d{5}(18|19|20)\d{2}(0[1-9]|1[0-2])(0[1-9]|[12]\d|3[01])\d{3}[\dXx]$`)
+
+	// 身份证号前17位的加权因子和校验码
+	idCardWeights = []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	idCardCheck   = "10X98765432"
+
+	enumMu sync.RWMutex
+	enums  = make(map[string][]string)
+)
+
+// builtinRules 内置规则, 初始化校验器时注册
+func builtinRules() []Rule {
+	return []Rule{
+		{
+			Tag: "mobile",
+			Fn:  isMobile,
+			Messages: map[string]string{
+				LocaleZh: "{0}必须是有效的手机号",
+				LocaleEn: "{0} must be a valid mobile number",
+			},
+		},
+		{
+			Tag: "idcard",
+			Fn:  isIdCard,
+			Messages: map[string]string{
+				LocaleZh: "{0}必须是有效的身份证号",
+				LocaleEn: "{0} must be a valid ID card number",
+			},
+		},
+		{
+			Tag: "username",
+			Fn:  isUsername,
+			Messages: map[string]string{
+				LocaleZh: "{0}必须以字母开头, 只能包含字母、数字和下划线, 长度为4-20个字符",
+				LocaleEn: "{0} must start with a letter, contain only letters, digits and underscores, and be 4-20 characters long",
+			},
+		},
+		{
+			Tag: "sort",
+			Fn:  isSafeSort,
+			Messages: map[string]string{
+				LocaleZh: "{0}只能按[{1}]排序",
+				LocaleEn: "{0} can only sort by [{1}]",
+			},
+		},
+		{
+			Tag: "enum",
+			Fn:  isEnum,
+			Messages: map[string]string{
+				LocaleZh: "{0}必须是[{1}]中的一个",
+				LocaleEn: "{0} must be one of [{1}]",
+			},
+			Param: func(fe validator.FieldError) string {
+				return strings.Join(enumValues(fe.Param()), " ")
+			},
+		},
+	}
+}
+
+// RegisterRule 注册自定义规则到共享校验器, 需要在开始处理请求前调用
+func RegisterRule(rules ...Rule) error {
+	return Default().RegisterRule(rules...)
+}
+
+// RegisterStructRule 注册结构体级别(跨字段)的校验, 需要在开始处理请求前调用
+// fn中通过sl.ReportError上报的tag需要用RegisterRule(Fn为nil)注册翻译
+func RegisterStructRule(fn validator.StructLevelFunc, types ...any) {
+	Default().RegisterStructRule(fn, types...)
+}
+
+// RegisterEnum 注册枚举, 字段使用 `binding:"enum=name"` 校验取值
+func RegisterEnum(name string, values ...any) {
+	list := make([]string, 0, len(values))
+	for _, v := range values {
+		list = append(list, fmt.Sprint(v))
+	}
+	enumMu.Lock()
+	defer enumMu.Unlock()
+	enums[name] = list
+}
+
+// RegisterRule 将规则和翻译注册到每个tag的引擎上
+func (v *Validate) RegisterRule(rules ...Rule) error {
+	for _, rule := range rules {
+		for tag, engine := range v.engines {
+			if rule.Fn != nil {
+				if err := engine.RegisterValidation(rule.Tag, rule.Fn, rule.CallEvenIfNull); err != nil {
+					return err
+				}
+			}
+			for locale, message := range rule.Messages {
+				trans, ok := v.unis[tag].GetTranslator(locale)
+				if !ok {
+					return fmt.Errorf("validate: translator for locale %s not found", locale)
+				}
+				if err := engine.RegisterTranslation(rule.Tag, trans, registerMessage(rule.Tag, message), translateParam(rule.Param)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// RegisterStructRule 将结构体级别的校验注册到每个tag的引擎上
+func (v *Validate) RegisterStructRule(fn validator.StructLevelFunc, types ...any) {
+	for _, engine := range v.engines {
+		engine.RegisterStructValidation(fn, types...)
+	}
+}
+
+func registerMessage(tag, message string) validator.RegisterTranslationsFunc {
+	return func(trans ut.Translator) error {
+		return trans.Add(tag, message, true)
+	}
+}
+
+func translateParam(param func(fe validator.FieldError) string) validator.TranslationFunc {
+	return func(trans ut.Translator, fe validator.FieldError) string {
+		p := fe.Param()
+		if param != nil {
+			p = param(fe)
+		}
+		msg, err := trans.T(fe.Tag(), fe.Field(), p)
+		if err != nil {
+			return fe.Error()
+		}
+		return msg
+	}
+}
+
+// isMobile 中国大陆手机号
+func isMobile(fl validator.FieldLevel) bool {
+	return mobileRegexp.MatchString(fl.Field().String())
+}
+
+// isUsername 字母开头, 字母数字下划线组成, 4-20位
+func isUsername(fl validator.FieldLevel) bool {
+	return usernameRegexp.MatchString(fl.Field().String())
+}
+
+// isIdCard 18位中国大陆身份证号, 校验出生日期格式和最后一位校验码
+func isIdCard(fl validator.FieldLevel) bool {
+	id := strings.ToUpper(fl.Field().String())
+	if !idCardRegexp.MatchString(id) {
+		return false
+	}
+	sum := 0
+	for i, w := range idCardWeights {
+		sum += int(id[i]-'0') * w
+	}
+	return idCardCheck[sum%11] == id[17]
+}
+
+// isSafeSort 排序字段只能是参数中列出的字段, 例如 `binding:"sort=id created_at"` 允许 "-created_at,id"
+func isSafeSort(fl validator.FieldLevel) bool {
+	allowed := strings.Fields(fl.Param())
+	for _, item := range strings.Split(fl.Field().String(), ",") {
+		field := strings.TrimLeft(strings.TrimSpace(item), "+-")
+		if !contains(allowed, field) {
+			return false
+		}
+	}
+	return true
+}
+
+// isEnum 取值必须在RegisterEnum注册的枚举中, 切片会校验每个元素
+func isEnum(fl validator.FieldLevel) bool {
+	values := enumValues(fl.Param())
+	field := fl.Field()
+	switch field.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < field.Len(); i++ {
+			if !contains(values, fmt.Sprint(field.Index(i).Interface())) {
+				return false
+			}
+		}
+		return true
+	default:
+		return contains(values, fmt.Sprint(field.Interface()))
+	}
+}
+
+func enumValues(name string) []string {
+	enumMu.RLock()
+	defer enumMu.RUnlock()
+	return enums[name]
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package validate
+
+import (
+	"context"
+	"gin-layout/pkg/errResponse"
+	"gin-layout/pkg/errors"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// invalidError 校验没有通过, 记录顶层结构体类型用于还原字段在请求中的路径
+type invalidError struct {
+	items []invalidItem
+}
+
+type invalidItem struct {
+	tag    string // 产生错误的引擎, 翻译时需要使用同一个引擎的翻译器
+	prefix string // 校验切片时元素的下标, 例如: [1]
+	root   reflect.Type
+	errs   validator.ValidationErrors
+}
+
+func (e *invalidError) Error() string {
+	messages := make([]string, 0, len(e.items))
+	for _, item := range e.items {
+		messages = append(messages, item.prefix+item.errs.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// wrapInvalid 包装validator返回的错误, 非校验错误原样返回
+func wrapInvalid(err error, tag string, root reflect.Type, prefix string) error {
+	if errs, ok := err.(validator.ValidationErrors); ok {
+		return &invalidError{items: []invalidItem{{tag: tag, prefix: prefix, root: root, errs: errs}}}
+	}
+	return err
+}
+
+// Translate 将校验错误转换为带有所有字段错误的参数错误(ReasonParamsError)
+// 非校验错误(例如json格式错误)同样转换为参数错误, 已经是业务错误的原样返回, err为nil时返回nil
+func (v *Validate) Translate(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	ie := new(invalidError)
+	if !errors.As(err, &ie) {
+		if se := new(errors.Error); errors.As(err, &se) {
+			return err
+		}
+		return errResponse.SetCustomizeErrMsgByReason(errResponse.ReasonParamsError, err.Error())
+	}
+
+	locales := acceptLocales(ctx)
+	fields := make([]*errors.FieldError, 0)
+	messages := make([]string, 0)
+	for _, item := range ie.items {
+		trans, _ := v.unis[item.tag].FindTranslator(locales...)
+		for _, fe := range item.errs {
+			field := fieldPath(item.root, fe)
+			if item.prefix != "" {
+				field = item.prefix + "." + field
+			}
+			f := &errors.FieldError{
+				Field:   field,
+				Tag:     fe.Tag(),
+				Message: fe.Translate(trans),
+			}
+			fields = append(fields, f)
+			messages = append(messages, f.Message)
+		}
+	}
+	return errors.FromError(
+		errResponse.SetCustomizeErrMsgByReason(errResponse.ReasonParamsError, strings.Join(messages, "; ")),
+	).WithFields(fields...)
+}
+
+// ParamsError 将gin绑定参数时返回的错误转换为参数错误
+func ParamsError(ctx context.Context, err error) error {
+	return Default().Translate(ctx, err)
+}
+
+// ContextKey gin.Context中请求语言的key, 由中间件从Accept-Language解析,
+// biz层的ctx经过InTx、tenant.WithTenant等包装后仍然可以通过ctx.Value取到
+const ContextKey = "locales"
+
+// acceptLocales 请求的语言, 最后追加默认语言; 没有经过中间件时直接读取gin.Context的Accept-Language
+func acceptLocales(ctx context.Context) []string {
+	locales, ok := ctx.Value(ContextKey).([]string)
+	if !ok {
+		if c, isGin := ctx.(*gin.Context); isGin && c.Request != nil {
+			locales = ParseAcceptLanguage(c.GetHeader("Accept-Language"))
+		}
+	}
+	return append(locales[:len(locales):len(locales)], DefaultLocale)
+}
+
+// ParseAcceptLanguage 例如: zh-CN,zh;q=0.9,en;q=0.8 => [zh_cn zh zh en]
+func ParseAcceptLanguage(header string) []string {
+	var locales []string
+	for _, item := range strings.Split(header, ",") {
+		tag := strings.TrimSpace(strings.SplitN(item, ";", 2)[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		tag = strings.ToLower(strings.ReplaceAll(tag, "-", "_"))
+		locales = append(locales, tag, strings.SplitN(tag, "_", 2)[0])
+	}
+	return locales
+}
+
+// fieldPath 将StructNamespace(例如 Req.Items[0].Name)转换为请求中的字段路径(例如 items[0].name)
+func fieldPath(root reflect.Type, fe validator.FieldError) string {
+	segments := strings.Split(fe.StructNamespace(), ".")
+	if len(segments) < 2 {
+		return fe.Field()
+	}
+	typ := structType(root, false)
+	path := make([]string, 0, len(segments)-1)
+	for _, seg := range segments[1:] {
+		name, index := seg, ""
+		if i := strings.IndexByte(seg, '['); i >= 0 {
+			name, index = seg[:i], seg[i:]
+		}
+		key := name
+		if typ != nil {
+			fld, ok := typ.FieldByName(name)
+			if !ok {
+				typ = nil
+				path = append(path, key+index)
+				continue
+			}
+			typ = structType(fld.Type, index != "")
+			if fld.Anonymous && fld.Tag.Get("json") == "" {
+				// 匿名嵌入的结构体在json中是平铺的
+				continue
+			}
+			key = fieldKey(fld)
+		}
+		path = append(path, key+index)
+	}
+	return strings.Join(path, ".")
+}
+
+// structType 去掉指针(以及带下标时的切片/map)后的结构体类型, 不是结构体时返回nil
+func structType(t reflect.Type, indexed bool) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if indexed && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map) {
+		t = t.Elem()
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
@@ -1,27 +1,125 @@
 package validate
 
 import (
-	"errors"
-	"github.com/go-playground/validator/v10"
+	"context"
 	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/zh"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	enTranslations "github.com/go-playground/validator/v10/translations/en"
+	zhTranslations "github.com/go-playground/validator/v10/translations/zh"
+	pkgerrors "github.com/pkg/errors"
 )
 
-// ValidateStruct 验证数据
+const (
+	// TagBinding gin绑定参数时使用的tag
+	TagBinding = "binding"
+	// TagValidate biz层校验使用的tag
+	TagValidate = "validate"
+
+	LocaleZh = "zh"
+	LocaleEn = "en"
+	// DefaultLocale 没有指定语言时使用中文
+	DefaultLocale = LocaleZh
+)
+
+var (
+	once sync.Once
+	std  *Validate
+)
+
+// Validate 全局共享的校验器, 同时服务于gin绑定和biz层校验
+// validator的tag名和翻译都是实例级别的, 所以每个tag各持有一个引擎和翻译器, 规则和翻译在初始化时一起注册
+type Validate struct {
+	engines map[string]*validator.Validate
+	unis    map[string]*ut.UniversalTranslator
+}
+
+// Default 获取全局共享的校验器, 第一次调用时初始化
+func Default() *Validate {
+	once.Do(func() {
+		std = newValidate()
+	})
+	return std
+}
+
+func newValidate() *Validate {
+	v := &Validate{
+		engines: make(map[string]*validator.Validate),
+		unis:    make(map[string]*ut.UniversalTranslator),
+	}
+	for _, tag := range []string{TagBinding, TagValidate} {
+		zhLocale, enLocale := zh.New(), en.New()
+		uni := ut.New(zhLocale, zhLocale, enLocale)
+		zhTrans, _ := uni.GetTranslator(LocaleZh)
+		enTrans, _ := uni.GetTranslator(LocaleEn)
+
+		engine := validator.New()
+		engine.SetTagName(tag)
+		engine.RegisterTagNameFunc(labelName)
+		// 注册失败只会是翻译模板本身有问题, 属于编码错误
+		if err := zhTranslations.RegisterDefaultTranslations(engine, zhTrans); err != nil {
+			panic(err)
+		}
+		if err := enTranslations.RegisterDefaultTranslations(engine, enTrans); err != nil {
+			panic(err)
+		}
+		v.engines[tag] = engine
+		v.unis[tag] = uni
+	}
+	if err := v.RegisterRule(builtinRules()...); err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Engine 获取指定tag的校验引擎
+func (v *Validate) Engine(tag string) *validator.Validate {
+	return v.engines[tag]
+}
+
+// Struct 使用validate tag校验结构体, 返回所有没有通过的字段(已翻译)
+func (v *Validate) Struct(ctx context.Context, model any) error {
+	err := v.engines[TagValidate].StructCtx(ctx, model)
+	if _, ok := err.(*validator.InvalidValidationError); ok {
+		// 传入的不是结构体, 属于编码错误
+		return pkgerrors.WithStack(err)
+	}
+	return v.Translate(ctx, wrapInvalid(err, TagValidate, reflect.TypeOf(model), ""))
+}
+
+// ValidateStruct 验证数据, 使用默认语言返回所有错误
 func ValidateStruct(model any) error {
-	//验证
-	validate := validator.New()
+	return Default().Struct(context.Background(), model)
+}
+
+// ValidateStructCtx 验证数据, 语言取自请求的Accept-Language
+func ValidateStructCtx(ctx context.Context, model any) error {
+	return Default().Struct(ctx, model)
+}
 
-	//注册一个函数，获取struct tag里自定义的label作为字段名
-	validate.RegisterTagNameFunc(func(fld reflect.StructField) string {
-		name := fld.Tag.Get("label")
+// labelName 错误信息中的字段名, 优先使用label, 其次json/form中的名称
+func labelName(fld reflect.StructField) string {
+	if name := fld.Tag.Get("label"); name != "" {
 		return name
-	})
+	}
+	return fieldKey(fld)
+}
 
-	err := validate.Struct(model)
-	if err != nil {
-		for _, err = range err.(validator.ValidationErrors) {
-			return errors.New(err.Error())
+// fieldKey 字段在请求中的名称, 依次取json/form tag, 都没有时使用字段名
+func fieldKey(fld reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		name := strings.SplitN(fld.Tag.Get(tag), ",", 2)[0]
+		if name == "-" {
+			continue
+		}
+		if name != "" {
+			return name
 		}
 	}
-	return nil
+	return fld.Name
 }
@@ -0,0 +1,60 @@
+package validate
+
+import (
+	"context"
+	"gin-layout/pkg/errors"
+	"testing"
+)
+
+type person struct {
+	Mobile string `json:"mobile" validate:"omitempty,mobile"`
+	IdCard string `json:"id_card" validate:"omitempty,idcard"`
+}
+
+func TestRules(t *testing.T) {
+	cases := []struct {
+		name string
+		in   person
+		want string // 没有通过的字段, 为空时校验通过
+	}{
+		{name: "empty", in: person{}},
+		{name: "mobile", in: person{Mobile: "13800138000"}},
+		{name: "mobile too short", in: person{Mobile: "1380013800"}, want: "mobile"},
+		{name: "mobile prefix", in: person{Mobile: "12800138000"}, want: "mobile"},
+		{name: "idcard", in: person{IdCard: "440308200001011234"}},
+		// 最后一位X不区分大小写
+		{name: "idcard x", in: person{IdCard: "11010519491231002x"}},
+		{name: "idcard checksum", in: person{IdCard: "440308200001011235"}, want: "id_card"},
+		{name: "idcard month", in: person{IdCard: "440308200013011234"}, want: "id_card"},
+		{name: "idcard length", in: person{IdCard: "44030820000101123"}, want: "id_card"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateStruct(&c.in)
+			if c.want == "" {
+				if err != nil {
+					t.Fatalf("got %v", err)
+				}
+				return
+			}
+			fields := errors.Fields(err)
+			if len(fields) != 1 || fields[0].Field != c.want {
+				t.Fatalf("got %v, fields %v", err, fields)
+			}
+		})
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	ctx := context.WithValue(context.Background(), ContextKey, ParseAcceptLanguage("en-US,en;q=0.9"))
+	err := ValidateStructCtx(ctx, &person{Mobile: "1"})
+	fields := errors.Fields(err)
+	if len(fields) != 1 || fields[0].Message != "mobile must be a valid mobile number" {
+		t.Fatalf("got %v", fields)
+	}
+	// 没有指定语言时使用中文
+	fields = errors.Fields(ValidateStruct(&person{IdCard: "1"}))
+	if len(fields) != 1 || fields[0].Message != "id_card必须是有效的身份证号" {
+		t.Fatalf("got %v", fields)
+	}
+}
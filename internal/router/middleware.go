@@ -1,7 +1,19 @@
 package router
 
 import (
+	"gin-layout/internal/conf"
+	"gin-layout/internal/pkg/dbresolver"
+	"gin-layout/internal/pkg/tenant"
+	"gin-layout/internal/pkg/validate"
 	"gin-layout/internal/service"
+	"gin-layout/pkg/errResponse"
+	"gin-layout/pkg/errors"
+	"gin-layout/pkg/ginx"
+	"gin-layout/pkg/reporter"
+	"net/http"
+	"regexp"
+	"strings"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	logs "github.com/sirupsen/logrus"
@@ -28,6 +40,9 @@ func VerifyLogin(user *service.UserService) gin.HandlerFunc {
 		//	return
 		//} else {
 		//	c.Set("login_user_id", uint64(xxx))
+		//	if !BindTokenTenant(c, "xxx") { // token中的租户
+		//		return
+		//	}
 		//}
 		//
 		// example ... end
@@ -38,13 +53,103 @@ func VerifyLogin(user *service.UserService) gin.HandlerFunc {
 // GenLogger generate request logger
 func GenLogger(logger *logs.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		requestId := uuid.NewString()
+		c.Set("request_id", requestId)
 		c.Set("logger", logger.WithFields(logs.Fields{
-			"request_id": uuid.NewString(),
+			"request_id": requestId,
 		}))
 		c.Next()
 	}
 }
 
+// GenDBState 记录请求中是否执行过写操作, 写之后的读使用主库
+func GenDBState() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(dbresolver.StateKey, dbresolver.NewState())
+		c.Next()
+	}
+}
+
+// tenantRegexp 租户只能是字母、数字、下划线和中划线
+var tenantRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// GenLocale 解析请求的Accept-Language放入gin.Context, 参数校验的错误信息按该语言翻译
+func GenLocale() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(validate.ContextKey, validate.ParseAcceptLanguage(c.GetHeader("Accept-Language")))
+		c.Next()
+	}
+}
+
+// requestedTenantKey 请求头或子域名中的租户, 登录后与token中的租户比较
+const requestedTenantKey = "requested_tenant_id"
+
+// GenTenant 解析请求的租户放入gin.Context; 请求头和子域名只在配置为trusted时直接使用,
+// 否则使用默认租户, 登录后由BindTokenTenant使用token中的租户
+func GenTenant(tc *conf.TenantConf) gin.HandlerFunc {
+	if tc == nil {
+		tc = &conf.TenantConf{}
+	}
+	header := tc.Header
+	if header == "" {
+		header = "X-Tenant-Id"
+	}
+	suffix := ""
+	if tc.Domain != "" {
+		suffix = "." + strings.ToLower(strings.TrimPrefix(tc.Domain, "."))
+	}
+	return func(c *gin.Context) {
+		requested := c.GetHeader(header)
+		if requested == "" && suffix != "" {
+			host := strings.ToLower(c.Request.Host)
+			if i := strings.LastIndexByte(host, ':'); i > strings.LastIndexByte(host, ']') {
+				host = host[:i]
+			}
+			if strings.HasSuffix(host, suffix) {
+				requested = strings.TrimSuffix(host, suffix)
+			}
+		}
+		if requested != "" && !tenantRegexp.MatchString(requested) {
+			ginx.ReturnJSON(ginx.New(c), nil, errResponse.SetCustomizeErrMsgByReason(errResponse.ReasonParamsError, "invalid tenant"))
+			c.Abort()
+			return
+		}
+		c.Set(requestedTenantKey, requested)
+		id := tc.Default
+		if tc.Trusted && requested != "" {
+			id = requested
+		}
+		if id != "" {
+			c.Set(tenant.ContextKey, id)
+		}
+		c.Next()
+	}
+}
+
+// BindTokenTenant 登录校验通过后调用, 使用token中的租户覆盖GenTenant解析的租户;
+// 请求头或子域名指定了其他租户时返回403并中断请求, 返回false
+func BindTokenTenant(c *gin.Context, id string) bool {
+	if id == "" {
+		return true
+	}
+	if requested := c.GetString(requestedTenantKey); requested != "" && requested != id {
+		err := errors.FromError(errResponse.SetCustomizeErrInfoByReason(errResponse.ReasonTenantMismatch))
+		ginx.New(c).ErrResponseWithStatus(http.StatusForbidden, err)
+		c.Abort()
+		return false
+	}
+	c.Set(tenant.ContextKey, id)
+	return true
+}
+
+// GenReporter 将错误上报放入gin.Context, 供ginx.RequestContext使用
+func GenReporter(r *reporter.Reporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("reporter", r)
+		c.Next()
+	}
+}
+
 // GenGinLogger change gin.DefaultWriter logger
 func GenGinLogger() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -54,11 +159,36 @@ func GenGinLogger() gin.HandlerFunc {
 	}
 }
 
-// GenGinRecover gin recover
-func GenGinRecover() gin.HandlerFunc {
+// GenGinRecover gin recover, 并上报panic
+func GenGinRecover(logger *logs.Logger, rp *reporter.Reporter) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		r := gin.RecoveryWithWriter(c.MustGet("logger").(*logs.Entry).WriterLevel(logs.ErrorLevel))
+		r := gin.CustomRecoveryWithWriter(
+			&recoveryWriter{c: c, logger: logger},
+			func(c *gin.Context, recovered any) {
+				// 跳过当前函数和gin recovery中的defer函数
+				rp.Report(reporter.NewPanicEvent(recovered, 2).
+					WithRequest(c.Request, c.ClientIP()).
+					WithUser(c.GetString("request_id"), c.GetUint64("login_user_id")),
+				)
+				c.AbortWithStatus(http.StatusInternalServerError)
+			},
+		)
 		r(c)
 		c.Next()
 	}
 }
+
+// recoveryWriter 写入请求的logger, 在GenLogger之前panic时请求的logger还没有设置, 使用全局的logger
+type recoveryWriter struct {
+	c      *gin.Context
+	logger *logs.Logger
+}
+
+func (w *recoveryWriter) Write(p []byte) (int, error) {
+	if entry, ok := w.c.Value("logger").(*logs.Entry); ok {
+		entry.Error(string(p))
+	} else {
+		w.logger.Error(string(p))
+	}
+	return len(p), nil
+}
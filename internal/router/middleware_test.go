@@ -0,0 +1,71 @@
+package router
+
+import (
+	"gin-layout/internal/conf"
+	"gin-layout/internal/pkg/tenant"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	logs "github.com/sirupsen/logrus"
+)
+
+func TestGenTenant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := logs.New()
+	l.SetOutput(io.Discard)
+	cases := []struct {
+		name       string
+		trusted    bool
+		header     string
+		token      string
+		wantStatus int
+		wantTenant string
+	}{
+		{name: "untrusted header ignored", header: "b", wantStatus: http.StatusOK, wantTenant: "d"},
+		{name: "trusted header", trusted: true, header: "b", wantStatus: http.StatusOK, wantTenant: "b"},
+		{name: "token overrides default", token: "a", wantStatus: http.StatusOK, wantTenant: "a"},
+		{name: "token matches header", header: "a", token: "a", wantStatus: http.StatusOK, wantTenant: "a"},
+		// 不论是否信任请求头, 与token不一致时都拒绝
+		{name: "untrusted mismatch", header: "b", token: "a", wantStatus: http.StatusForbidden},
+		{name: "trusted mismatch", trusted: true, header: "b", token: "a", wantStatus: http.StatusForbidden},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := ""
+			r := gin.New()
+			r.Use(GenLogger(l), GenTenant(&conf.TenantConf{Default: "d", Trusted: c.trusted}), func(ctx *gin.Context) {
+				BindTokenTenant(ctx, c.token)
+			})
+			r.GET("/", func(ctx *gin.Context) {
+				got = ctx.GetString(tenant.ContextKey)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Tenant-Id", c.header)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != c.wantStatus || got != c.wantTenant {
+				t.Fatalf("got status %d tenant %q, want %d %q", w.Code, got, c.wantStatus, c.wantTenant)
+			}
+		})
+	}
+}
+
+func TestGenGinRecover(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := logs.New()
+	l.SetOutput(io.Discard)
+	r := gin.New()
+	// 在GenLogger之前panic, 请求的logger还没有设置
+	r.Use(GenGinRecover(l, nil), func(c *gin.Context) {
+		panic("boom")
+	}, GenLogger(l))
+	r.GET("/", func(c *gin.Context) {})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("got status %d", w.Code)
+	}
+}
@@ -0,0 +1,29 @@
+package router
+
+import (
+	"gin-layout/internal/conf"
+	"gin-layout/pkg/reporter"
+	"net/http"
+	"time"
+
+	logs "github.com/sirupsen/logrus"
+)
+
+// NewReporter 根据err_report配置创建错误上报
+func NewReporter(appConf *conf.AppConfig, logger *logs.Logger) (*reporter.Reporter, func(), error) {
+	c := appConf.ErrReport
+	if c == nil {
+		c = &conf.ErrReportConf{}
+	}
+	opts := reporter.Options{
+		Env:         appConf.Env,
+		File:        c.File,
+		SentryDSN:   c.SentryDSN,
+		DedupWindow: time.Duration(c.DedupSeconds) * time.Second,
+		QueueSize:   c.QueueSize,
+	}
+	if c.TimeoutMs > 0 {
+		opts.HTTPClient = &http.Client{Timeout: time.Duration(c.TimeoutMs) * time.Millisecond}
+	}
+	return reporter.NewReporter(opts, logger)
+}
@@ -3,9 +3,13 @@ package router
 import (
 	"fmt"
 	"gin-layout/internal/conf"
+	"gin-layout/internal/pkg/page"
+	"gin-layout/internal/pkg/validate"
 	"gin-layout/internal/service"
 	"gin-layout/pkg/ginx"
+	"gin-layout/pkg/reporter"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/google/wire"
 	logs "github.com/sirupsen/logrus"
 	"time"
@@ -15,11 +19,13 @@ import (
 var ProviderSet = wire.NewSet(
 	NewRouter,
 	NewBeforeHandel,
+	NewReporter,
 )
 
-func NewRouter(user *service.UserService, appConfig *conf.AppConfig,
+func NewRouter(user *service.UserService, audit *service.AuditService, cron *service.CronService, appConfig *conf.AppConfig,
 	beforeHandel *RequestBeforeHandel,
 	logger *logs.Logger,
+	rp *reporter.Reporter,
 ) *gin.Engine {
 	gin.SetMode(gin.DebugMode)
 	if appConfig.Env == conf.EnvProd || appConfig.Env == conf.EnvLong {
@@ -30,11 +36,18 @@ func NewRouter(user *service.UserService, appConfig *conf.AppConfig,
 	gin.DefaultWriter = logs.NewEntry(logger).WriterLevel(logs.InfoLevel)
 	gin.DefaultErrorWriter = logs.NewEntry(logger).WriterLevel(logs.ErrorLevel)
 
+	// gin绑定参数和biz层使用同一套校验规则和翻译
+	binding.Validator = validate.Binding()
+	// 游标分页的签名密钥
+	page.SetCursorSecret(appConfig.CursorSecret)
+
 	router := gin.New()
 
+	// recovery最先注册, 后面的中间件panic时也能恢复
+	router.Use(GenGinRecover(logger, rp))
 	// 更改gin的log包
-	router.Use(GenLogger(logger))
-	router.Use(GenGinRecover(), GenGinLogger())
+	router.Use(GenLogger(logger), GenReporter(rp), GenDBState(), GenTenant(appConfig.Tenant), GenLocale())
+	router.Use(GenGinLogger())
 
 	// example ... start
 
@@ -44,11 +57,23 @@ func NewRouter(user *service.UserService, appConfig *conf.AppConfig,
 		test.POST("/add", ginx.API(user.AddTest))
 		test.POST("/tran", ginx.API(user.TranTest, beforeHandel.SuperAdmin))
 		test.GET("/list", ginx.API(user.ListTest))
+		test.POST("/del", ginx.API(user.DelTest, beforeHandel.SuperAdmin))
+		test.GET("/trash", ginx.API(user.TrashTest, beforeHandel.SuperAdmin))
+		test.POST("/restore", ginx.API(user.RestoreTest, beforeHandel.SuperAdmin))
 	}
 	router.Use(VerifyLogin(user))
 
 	// example ... end
 
+	admin := router.Group("/admin")
+	{
+		// entity=uc_users&entity_id=1&user_id=1&start_time=2026-01-01&end_time=2026-01-31
+		admin.GET("/audit_logs", ginx.API(audit.ListAuditLog, beforeHandel.SuperAdmin))
+		admin.GET("/cron_tasks", ginx.API(cron.ListCronTask, beforeHandel.SuperAdmin))
+		// 立即执行一次, 任务正在执行时返回REASON_RESOURCE_BUSY
+		admin.POST("/cron_tasks/:name/run", ginx.API(cron.RunCronTask, beforeHandel.SuperAdmin))
+	}
+
 	return router
 }
 
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"encoding/json"
+	"gin-layout/internal/biz"
+	"gin-layout/internal/pkg/page"
+	"gin-layout/internal/pkg/query"
+	"gin-layout/internal/pkg/validate"
+	"gin-layout/pkg/ginx"
+	"strconv"
+)
+
+// AuditService 审计日志
+type AuditService struct {
+	uc *biz.AuditLogUseCase
+}
+
+// auditLogListSpec 审计日志允许的排序和筛选
+var auditLogListSpec = &query.Spec{
+	Fields: map[string]query.Field{
+		"id":         {Kind: query.KindUint, Sortable: true},
+		"entity":     {Ops: []query.Op{query.OpEq, query.OpIn}},
+		"entity_id":  {Ops: []query.Op{query.OpEq, query.OpIn}},
+		"action":     {Ops: []query.Op{query.OpEq, query.OpIn}},
+		"user_id":    {Kind: query.KindUint, Ops: []query.Op{query.OpEq, query.OpIn}},
+		"request_id": {Ops: []query.Op{query.OpEq}},
+		"created_at": {Kind: query.KindTime, Sortable: true, Ops: []query.Op{query.OpGte, query.OpLte}},
+	},
+	DefaultSort: "-id",
+}
+
+type ListAuditLogReq struct {
+	PageNum   uint64 `form:"pageNum" binding:"omitempty,gte=1"`
+	PageSize  uint64 `form:"pageSize" binding:"omitempty,gte=1"`
+	Mode      string `form:"mode" binding:"omitempty,oneof=cursor"` // 分页方式, cursor为游标分页
+	Cursor    string `form:"cursor"`                                // 游标分页时上一次返回的next_cursor/prev_cursor
+	Entity    string `form:"entity" binding:"omitempty,min=1"`      // 表名, 等同于filter[entity]
+	EntityId  string `form:"entity_id" binding:"omitempty,min=1"`   // 主键, 等同于filter[entity_id]
+	UserId    uint64 `form:"user_id" binding:"omitempty,gte=1"`     // 操作人, 等同于filter[user_id]
+	StartTime string `form:"start_time"`                            // 2006-01-02 15:04:05 或 2006-01-02, 等同于filter[created_at][gte]
+	EndTime   string `form:"end_time"`                              // 同start_time, 等同于filter[created_at][lte]
+}
+
+type ListAuditLogReply struct {
+	Id        uint64          `json:"id"`
+	Entity    string          `json:"entity"`
+	EntityId  string          `json:"entity_id"`
+	Action    string          `json:"action"`
+	OldValues json.RawMessage `json:"old_values"`
+	NewValues json.RawMessage `json:"new_values"`
+	UserId    uint64          `json:"user_id"`
+	RequestId string          `json:"request_id"`
+	CreatedAt string          `json:"created_at"`
+}
+
+// ListAuditLog 分页查询审计日志
+func (s *AuditService) ListAuditLog(ctx *ginx.RequestContext) (any, error) {
+	var err error
+	req := &ListAuditLogReq{}
+
+	if err = ctx.Context.ShouldBindQuery(req); err != nil {
+		return nil, validate.ParamsError(ctx.Context, err)
+	}
+	q, err := auditLogListSpec.Parse(ctx.Request.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+	filters := []struct {
+		name  string
+		op    query.Op
+		value string
+	}{
+		{"entity", query.OpEq, req.Entity},
+		{"entity_id", query.OpEq, req.EntityId},
+		{"user_id", query.OpEq, formatId(req.UserId)},
+		{"created_at", query.OpGte, req.StartTime},
+		{"created_at", query.OpLte, req.EndTime},
+	}
+	for _, f := range filters {
+		if f.value == "" {
+			continue
+		}
+		if err = auditLogListSpec.AddFilter(q, f.name, f.op, f.value); err != nil {
+			return nil, err
+		}
+	}
+	condition := &biz.ListAuditLogRep{
+		Page: &page.Page{
+			Num:    req.PageNum,
+			Size:   req.PageSize,
+			Mode:   req.Mode,
+			Cursor: req.Cursor,
+		},
+		Query: q,
+	}
+
+	r, err := s.uc.ListAuditLog(ctx.Context, condition)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*ListAuditLogReply, 0, len(r.List))
+	for _, l := range r.List {
+		res = append(res, &ListAuditLogReply{
+			Id:        l.Id,
+			Entity:    l.Entity,
+			EntityId:  l.EntityId,
+			Action:    l.Action,
+			OldValues: rawJSON(l.OldValues),
+			NewValues: rawJSON(l.NewValues),
+			UserId:    l.UserId,
+			RequestId: l.RequestId,
+			CreatedAt: l.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return ctx.ReturnListWithLinks(res, pagination(r)), nil
+}
+
+func formatId(id uint64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatUint(id, 10)
+}
+
+// rawJSON 空字符串返回null
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(s)
+}
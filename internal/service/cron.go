@@ -0,0 +1,66 @@
+package service
+
+import (
+	"gin-layout/internal/biz"
+	"gin-layout/internal/pkg/validate"
+	"gin-layout/pkg/ginx"
+)
+
+// CronService 定时任务
+type CronService struct {
+	uc *biz.CronUseCase
+}
+
+type ListCronTaskReply struct {
+	Name    string            `json:"name"`
+	Spec    string            `json:"spec"`
+	NextRun string            `json:"next_run"` // 只手动触发时为空
+	LastRun *CronTaskRunReply `json:"last_run"` // 没有执行过时为null
+}
+
+type CronTaskRunReply struct {
+	Trigger    string `json:"trigger"` // schedule/manual
+	Instance   string `json:"instance"`
+	StartedAt  string `json:"started_at"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error"` // 为空时执行成功
+}
+
+// ListCronTask 所有定时任务和最后一次执行的结果
+func (s *CronService) ListCronTask(ctx *ginx.RequestContext) (any, error) {
+	tasks, err := s.uc.ListCronTask(ctx.Context)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*ListCronTaskReply, 0, len(tasks))
+	for _, t := range tasks {
+		r := &ListCronTaskReply{Name: t.Name, Spec: t.Spec}
+		if !t.NextRun.IsZero() {
+			r.NextRun = t.NextRun.Format("2006-01-02 15:04:05 -0700")
+		}
+		if t.LastRun != nil {
+			r.LastRun = &CronTaskRunReply{
+				Trigger:    t.LastRun.Trigger,
+				Instance:   t.LastRun.Instance,
+				StartedAt:  t.LastRun.StartedAt.Format("2006-01-02 15:04:05"),
+				DurationMs: t.LastRun.DurationMs,
+				Error:      t.LastRun.Error,
+			}
+		}
+		res = append(res, r)
+	}
+	return res, nil
+}
+
+type RunCronTaskReq struct {
+	Name string `uri:"name" binding:"required"`
+}
+
+// RunCronTask 手动触发, 在后台执行, 结果通过ListCronTask或日志查看
+func (s *CronService) RunCronTask(ctx *ginx.RequestContext) (any, error) {
+	req := &RunCronTaskReq{}
+	if err := ctx.Context.ShouldBindUri(req); err != nil {
+		return nil, validate.ParamsError(ctx.Context, err)
+	}
+	return nil, s.uc.RunCronTask(ctx.Context, req.Name)
+}
@@ -0,0 +1,23 @@
+package service
+
+import (
+	"gin-layout/internal/pkg/page"
+	"gin-layout/pkg/ginx"
+)
+
+// pagination 分页结果转换为返回的分页信息, page包不依赖web框架
+//
+//	return ctx.ReturnListWithLinks(res, pagination(r)), nil
+func pagination[T any](r *page.Result[T]) *ginx.Pagination {
+	return &ginx.Pagination{
+		Num:        r.Num,
+		Size:       r.Size,
+		Total:      r.Total,
+		TotalPages: r.TotalPages,
+		Estimated:  r.Estimated,
+		HasNext:    r.HasNext,
+		HasPrev:    r.HasPrev,
+		NextCursor: r.NextCursor,
+		PrevCursor: r.PrevCursor,
+	}
+}
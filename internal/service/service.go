@@ -8,6 +8,8 @@ import (
 // ProviderSet is service providers.
 var ProviderSet = wire.NewSet(
 	NewUserService,
+	NewAuditService,
+	NewCronService,
 )
 
 func NewUserService(userUseCase *biz.UcUserUseCase) *UserService {
@@ -15,3 +17,15 @@ func NewUserService(userUseCase *biz.UcUserUseCase) *UserService {
 		uc: userUseCase,
 	}
 }
+
+func NewAuditService(auditLogUseCase *biz.AuditLogUseCase) *AuditService {
+	return &AuditService{
+		uc: auditLogUseCase,
+	}
+}
+
+func NewCronService(cronUseCase *biz.CronUseCase) *CronService {
+	return &CronService{
+		uc: cronUseCase,
+	}
+}
@@ -1,12 +1,15 @@
 package service
 
 import (
+	"context"
 	"gin-layout/internal/biz"
 	"gin-layout/internal/pkg/copierx"
 	"gin-layout/internal/pkg/page"
-	"gin-layout/pkg/errResponse"
+	"gin-layout/internal/pkg/query"
+	"gin-layout/internal/pkg/validate"
 	"gin-layout/pkg/ginx"
 	"github.com/pkg/errors"
+	"strconv"
 )
 
 // UserService .
@@ -15,7 +18,8 @@ type UserService struct {
 }
 
 type TestReq struct {
-	Id uint64 `form:"id" binding:"omitempty,gte=1"` // id
+	Id    uint64 `form:"id" binding:"omitempty,gte=1"`     // id
+	Phone string `form:"phone" binding:"omitempty,mobile"` // 手机号, 没有id时按手机号查询
 }
 
 type TestReply struct {
@@ -29,7 +33,7 @@ func (s *UserService) Test(ctx *ginx.RequestContext) (any, error) {
 	req := &TestReq{}
 
 	if err = ctx.Context.ShouldBindQuery(req); err != nil {
-		return nil, errResponse.SetCustomizeErrMsgByReason(errResponse.ReasonParamsError, err.Error())
+		return nil, validate.ParamsError(ctx.Context, err)
 	}
 
 	r := &biz.UcUser{}
@@ -51,7 +55,9 @@ func (s *UserService) Test(ctx *ginx.RequestContext) (any, error) {
 }
 
 type AddTestReq struct {
-	Name string `json:"name" binding:"required,min=1,max=20"`
+	Name   string `json:"name" binding:"required,min=1,max=20"`
+	Phone  string `json:"phone" binding:"omitempty,mobile"`
+	IdCard string `json:"id_card" binding:"omitempty,idcard"`
 }
 
 // AddTest 添加数据
@@ -60,7 +66,7 @@ func (s *UserService) AddTest(ctx *ginx.RequestContext) (any, error) {
 	req := &AddTestReq{}
 
 	if err = ctx.Context.ShouldBindJSON(req); err != nil {
-		return nil, errResponse.SetCustomizeErrMsgByReason(errResponse.ReasonParamsError, err.Error())
+		return nil, validate.ParamsError(ctx.Context, err)
 	}
 	u := &biz.UcUser{}
 	if err = errors.WithStack(copierx.Copy(&u, req)); err != nil {
@@ -78,11 +84,45 @@ func (s *UserService) IsAdmin(ctx *ginx.RequestContext) (any, error) {
 	return nil, nil
 }
 
+type IdsReq struct {
+	Ids []uint64 `json:"ids" binding:"required,min=1,max=100,dive,gte=1"`
+}
+
+// DelTest 删除数据(软删除)
+func (s *UserService) DelTest(ctx *ginx.RequestContext) (any, error) {
+	req := &IdsReq{}
+	if err := ctx.Context.ShouldBindJSON(req); err != nil {
+		return nil, validate.ParamsError(ctx.Context, err)
+	}
+	return nil, s.uc.DelTest(ctx.Context, req.Ids)
+}
+
+// RestoreTest 从回收站恢复数据
+func (s *UserService) RestoreTest(ctx *ginx.RequestContext) (any, error) {
+	req := &IdsReq{}
+	if err := ctx.Context.ShouldBindJSON(req); err != nil {
+		return nil, validate.ParamsError(ctx.Context, err)
+	}
+	return nil, s.uc.RestoreTest(ctx.Context, req.Ids)
+}
+
+// ucUserListSpec 用户列表允许的排序和筛选
+var ucUserListSpec = &query.Spec{
+	Fields: map[string]query.Field{
+		"id":         {Kind: query.KindUint, Sortable: true, Ops: []query.Op{query.OpEq, query.OpIn}},
+		"name":       {Ops: []query.Op{query.OpEq, query.OpLike}},
+		"created_at": {Kind: query.KindTime, Sortable: true, Ops: []query.Op{query.OpGte, query.OpLte}},
+	},
+	DefaultSort: "-id",
+}
+
 type ListTestReq struct {
 	PageNum  uint64 `form:"pageNum" binding:"omitempty,gte=1"`
 	PageSize uint64 `form:"pageSize" binding:"omitempty,gte=1"`
-	Id       uint64 `form:"id" binding:"omitempty,gte=1"`   // id
-	Name     string `form:"name" binding:"omitempty,min=1"` // 名称
+	Mode     string `form:"mode" binding:"omitempty,oneof=cursor"` // 分页方式, cursor为游标分页
+	Cursor   string `form:"cursor"`                                // 游标分页时上一次返回的next_cursor/prev_cursor
+	Id       uint64 `form:"id" binding:"omitempty,gte=1"`          // id, 等同于filter[id]
+	Name     string `form:"name" binding:"omitempty,min=1"`        // 名称, 等同于filter[name][like]
 }
 
 type ListTestReply struct {
@@ -93,32 +133,56 @@ type ListTestReply struct {
 
 // ListTest 分页获取多条数据
 func (s *UserService) ListTest(ctx *ginx.RequestContext) (any, error) {
+	return s.list(ctx, s.uc.ListTest)
+}
+
+// TrashTest 分页获取回收站中的数据, 参数与ListTest相同
+func (s *UserService) TrashTest(ctx *ginx.RequestContext) (any, error) {
+	return s.list(ctx, s.uc.TrashTest)
+}
+
+func (s *UserService) list(ctx *ginx.RequestContext,
+	find func(ctx context.Context, condition *biz.ListTestRep) (*page.Result[*biz.UcUser], error),
+) (any, error) {
 	var err error
 	req := &ListTestReq{}
 
 	if err = ctx.Context.ShouldBindQuery(req); err != nil {
-		return nil, errResponse.SetCustomizeErrMsgByReason(errResponse.ReasonParamsError, err.Error())
+		return nil, validate.ParamsError(ctx.Context, err)
+	}
+	// sort=-created_at,id&filter[name][like]=x&filter[id][in]=1,2
+	q, err := ucUserListSpec.Parse(ctx.Request.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+	if req.Id > 0 {
+		if err = ucUserListSpec.AddFilter(q, "id", query.OpEq, strconv.FormatUint(req.Id, 10)); err != nil {
+			return nil, err
+		}
+	}
+	if req.Name != "" {
+		if err = ucUserListSpec.AddFilter(q, "name", query.OpLike, req.Name); err != nil {
+			return nil, err
+		}
 	}
 	condition := &biz.ListTestRep{
 		Page: &page.Page{
-			Num:  req.PageNum,
-			Size: req.PageSize,
+			Num:    req.PageNum,
+			Size:   req.PageSize,
+			Mode:   req.Mode,
+			Cursor: req.Cursor,
 		},
-	}
-	// copy过去筛选参数
-	err = errors.WithStack(copierx.Copy(condition, req))
-	if err != nil {
-		return nil, err
+		Query: q,
 	}
 
-	r, err := s.uc.ListTest(ctx.Context, condition)
+	r, err := find(ctx.Context, condition)
 	if err != nil {
 		return nil, err
 	}
 	res := make([]*ListTestReply, 0)
-	err = errors.WithStack(copierx.Copy(&res, r))
+	err = errors.WithStack(copierx.Copy(&res, r.List))
 	if err != nil {
 		return nil, err
 	}
-	return ctx.ReturnList(res, condition.Page.Total), nil
+	return ctx.ReturnListWithLinks(res, pagination(r)), nil
 }
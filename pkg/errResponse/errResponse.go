@@ -13,6 +13,9 @@ const ReasonLoginTokenIsExpired = "LOGIN_TOKEN_IS_EXPIRED"
 const ReasonLoginPermissionDenied = "LOGIN_PERMISSION_DENIED"
 const ReasonUserIsNotFount = "REASON_USER_IS_NOT_FOUNT"
 const ReasonDataIsNotFount = "REASON_DATA_IS_NOT_FOUNT"
+const ReasonResourceBusy = "REASON_RESOURCE_BUSY"
+const ReasonTenantIsRequired = "REASON_TENANT_IS_REQUIRED"
+const ReasonTenantMismatch = "REASON_TENANT_MISMATCH"
 
 var reasonMessageAll = map[string]string{
 	ReasonSuccess:      "success",
@@ -25,6 +28,9 @@ var reasonMessageAll = map[string]string{
 	ReasonLoginPermissionDenied: "无权登陆",
 	ReasonUserIsNotFount:        "用户不存在",
 	ReasonDataIsNotFount:        "data is not found",
+	ReasonResourceBusy:          "操作正在进行中, 请稍后重试",
+	ReasonTenantIsRequired:      "缺少租户信息",
+	ReasonTenantMismatch:        "无权访问该租户",
 }
 
 var reasonCodeAll = map[string]int{
@@ -37,6 +43,9 @@ var reasonCodeAll = map[string]int{
 	ReasonLoginPermissionDenied: 10005,
 	ReasonUserIsNotFount:        10006,
 	ReasonDataIsNotFount:        10007,
+	ReasonResourceBusy:          10008,
+	ReasonTenantIsRequired:      10009,
+	ReasonTenantMismatch:        10010,
 }
 
 //
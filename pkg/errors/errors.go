@@ -17,12 +17,20 @@ const (
 )
 
 type Error struct {
-	Code    int32  `json:"code,omitempty"`
-	Reason  string `json:"reason,omitempty"`
-	Message string `json:"message,omitempty"`
+	Code    int32         `json:"code,omitempty"`
+	Reason  string        `json:"reason,omitempty"`
+	Message string        `json:"message,omitempty"`
+	Fields  []*FieldError `json:"fields,omitempty"`
 	cause   error
 }
 
+// FieldError 单个字段的错误, 一般由参数校验产生
+type FieldError struct {
+	Field   string `json:"field"`   // 字段路径, 例如: items[0].name
+	Tag     string `json:"tag"`     // 没有通过的校验规则
+	Message string `json:"message"` // 已翻译的错误信息
+}
+
 func (e *Error) Error() string {
 	return fmt.Sprintf("error: code = %d reason = %s message = %s cause = %+v", e.Code, e.Reason, e.Message, e.cause)
 }
@@ -45,6 +53,13 @@ func (e *Error) WithCause(cause error) *Error {
 	return err
 }
 
+// WithFields with the field errors of the error.
+func (e *Error) WithFields(fields ...*FieldError) *Error {
+	err := Clone(e)
+	err.Fields = fields
+	return err
+}
+
 // New returns an error object for the code, message.
 func New(code int, reason, message string) *Error {
 	return &Error{
@@ -91,6 +106,15 @@ func Reason(err error) string {
 	return FromError(err).Reason
 }
 
+// Fields returns the field errors for a particular error.
+// It supports wrapped errors.
+func Fields(err error) []*FieldError {
+	if err == nil {
+		return nil
+	}
+	return FromError(err).Fields
+}
+
 // Clone deep clone error to a new error.
 func Clone(err *Error) *Error {
 	if err == nil {
@@ -101,6 +125,7 @@ func Clone(err *Error) *Error {
 		Code:    err.Code,
 		Reason:  err.Reason,
 		Message: err.Message,
+		Fields:  err.Fields,
 	}
 }
 
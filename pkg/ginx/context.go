@@ -3,6 +3,7 @@ package ginx
 import (
 	"gin-layout/pkg/errResponse"
 	"gin-layout/pkg/errors"
+	"gin-layout/pkg/reporter"
 	"github.com/gin-gonic/gin"
 	logs "github.com/sirupsen/logrus"
 	"net/http"
@@ -14,24 +15,37 @@ type RequestContext struct {
 	Request *http.Request
 	UserId  uint64
 	logger  *logs.Entry
+	// 未知错误上报, 由中间件放入gin.Context, 可能为nil
+	reporter *reporter.Reporter
 }
 
 // New 从gin.Context构建RequestContext
 func New(c *gin.Context) *RequestContext {
+	r, _ := c.Value("reporter").(*reporter.Reporter)
 	return &RequestContext{
-		Context: c,
-		Request: c.Request,
-		UserId:  c.GetUint64("login_user_id"),
-		logger:  c.MustGet("logger").(*logs.Entry),
+		Context:  c,
+		Request:  c.Request,
+		UserId:   c.GetUint64("login_user_id"),
+		logger:   c.MustGet("logger").(*logs.Entry),
+		reporter: r,
 	}
 }
 
 // ErrResponse 返回错误信息
 func (rc *RequestContext) ErrResponse(err *errors.Error) {
-	rc.Context.JSON(http.StatusOK, gin.H{
+	rc.ErrResponseWithStatus(http.StatusOK, err)
+}
+
+// ErrResponseWithStatus 使用指定的http状态码返回错误信息, 用于中间件拒绝请求
+func (rc *RequestContext) ErrResponseWithStatus(status int, err *errors.Error) {
+	res := gin.H{
 		"code": errors.Code(err),
 		"msg":  errors.Message(err),
-	})
+	}
+	if fields := errors.Fields(err); len(fields) > 0 {
+		res["fields"] = fields
+	}
+	rc.Context.JSON(status, res)
 }
 
 // ToResponse 返回数据
@@ -58,13 +72,33 @@ func (rc *RequestContext) GetLogger() *logs.Entry {
 	return rc.logger
 }
 
-// ReturnList 分页返回格式化数据
-func (rc *RequestContext) ReturnList(list any, Total int64) any {
-	return struct {
-		List  any   `json:"list"`
-		Total int64 `json:"total"`
-	}{
-		List:  list,
-		Total: Total,
+// ReportError 上报未知错误(带业务错误码的错误不上报), 附带请求信息和登陆用户
+func (rc *RequestContext) ReportError(err error) {
+	if rc.reporter == nil || !reporter.ShouldReport(err) {
+		return
+	}
+	rc.reporter.Report(reporter.NewEvent(err).
+		WithRequest(rc.Request, rc.Context.ClientIP()).
+		WithUser(rc.Context.GetString("request_id"), rc.UserId),
+	)
+}
+
+// ReturnList 分页返回格式化数据, list为当前页的数据
+//
+//	{"list": [...], "pagination": {"num": 1, "size": 10, "total": 100, "total_pages": 10, "has_next": true, "has_prev": false}}
+func (rc *RequestContext) ReturnList(list any, p Paginated) any {
+	return &ListResponse{
+		List:       list,
+		Pagination: p.Pagination(),
+	}
+}
+
+// ReturnListWithLinks 同ReturnList, 并根据当前请求的url生成翻页链接
+func (rc *RequestContext) ReturnListWithLinks(list any, p Paginated) any {
+	res := &ListResponse{
+		List:       list,
+		Pagination: p.Pagination(),
 	}
+	res.Links = res.Pagination.links(rc.Request.URL)
+	return res
 }
@@ -0,0 +1,86 @@
+package ginx
+
+import (
+	"net/url"
+	"strconv"
+)
+
+const (
+	// PageNumParam 生成翻页链接时使用的页码参数名
+	PageNumParam = "pageNum"
+	// CursorParam 生成翻页链接时使用的游标参数名
+	CursorParam = "cursor"
+)
+
+// Paginated 分页结果, *Pagination实现了该接口
+type Paginated interface {
+	Pagination() *Pagination
+}
+
+// Pagination 列表的分页信息
+type Pagination struct {
+	Num        uint64 `json:"num"`
+	Size       uint64 `json:"size"`
+	Total      int64  `json:"total"`
+	TotalPages uint64 `json:"total_pages"`
+	Estimated  bool   `json:"estimated"` // total是估算值
+	HasNext    bool   `json:"has_next"`
+	HasPrev    bool   `json:"has_prev"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+// Pagination 实现Paginated
+func (p *Pagination) Pagination() *Pagination {
+	return p
+}
+
+// Links 翻页链接, 没有对应的页时为空
+type Links struct {
+	Self  string `json:"self"`
+	First string `json:"first,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Next  string `json:"next,omitempty"`
+	Last  string `json:"last,omitempty"`
+}
+
+// ListResponse 列表统一的返回格式
+type ListResponse struct {
+	List       any         `json:"list"`
+	Pagination *Pagination `json:"pagination"`
+	Links      *Links      `json:"links,omitempty"`
+}
+
+// links 在当前url上替换页码(游标分页时替换游标)生成翻页链接
+func (p *Pagination) links(u *url.URL) *Links {
+	links := &Links{Self: u.RequestURI()}
+	if p.NextCursor != "" || p.PrevCursor != "" {
+		if p.HasPrev {
+			links.Prev = withQuery(u, CursorParam, p.PrevCursor)
+		}
+		if p.HasNext {
+			links.Next = withQuery(u, CursorParam, p.NextCursor)
+		}
+		return links
+	}
+
+	links.First = withQuery(u, PageNumParam, "1")
+	if p.HasPrev {
+		links.Prev = withQuery(u, PageNumParam, strconv.FormatUint(p.Num-1, 10))
+	}
+	if p.HasNext {
+		links.Next = withQuery(u, PageNumParam, strconv.FormatUint(p.Num+1, 10))
+	}
+	if p.TotalPages > 0 {
+		links.Last = withQuery(u, PageNumParam, strconv.FormatUint(p.TotalPages, 10))
+	}
+	return links
+}
+
+func withQuery(u *url.URL, key, value string) string {
+	q := u.Query()
+	q.Set(key, value)
+	n := *u
+	n.RawQuery = q.Encode()
+	return n.RequestURI()
+}
@@ -42,7 +42,8 @@ func api(request APIHandler, serviceName string, funcName string) RequestHandler
 		}()
 		response, err := request(rc)
 		if err != nil {
-			rc.GetLogger().Errorf(fmt.Sprintf("%+v", err))
+			rc.GetLogger().Errorf("%+v", err)
+			rc.ReportError(err)
 		}
 
 		ReturnJSON(rc, response, err)
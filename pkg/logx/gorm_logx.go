@@ -30,15 +30,15 @@ func (l *gormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
 }
 
 func (l *gormLogger) Info(ctx context.Context, s string, args ...interface{}) {
-	l.WithContext(ctx).Infof(s, args)
+	l.WithContext(ctx).Infof(s, args...)
 }
 
 func (l *gormLogger) Warn(ctx context.Context, s string, args ...interface{}) {
-	l.WithContext(ctx).Warnf(s, args)
+	l.WithContext(ctx).Warnf(s, args...)
 }
 
 func (l *gormLogger) Error(ctx context.Context, s string, args ...interface{}) {
-	l.WithContext(ctx).Errorf(s, args)
+	l.WithContext(ctx).Errorf(s, args...)
 }
 
 func (l *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
@@ -0,0 +1,195 @@
+package reporter
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"gin-layout/pkg/errors"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	pkgerrors "github.com/pkg/errors"
+)
+
+const (
+	LevelError = "error"
+	LevelFatal = "fatal"
+
+	// 参与计算指纹的栈帧数量
+	fingerprintFrames = 10
+)
+
+// 上报时需要隐藏的请求头
+var sensitiveHeaders = map[string]struct{}{
+	"Authorization": {},
+	"Cookie":        {},
+	"Set-Cookie":    {},
+	"Token":         {},
+}
+
+// Frame 栈帧
+type Frame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// Request 出错时的请求信息
+type Request struct {
+	Method   string            `json:"method"`
+	URL      string            `json:"url"`
+	Query    string            `json:"query,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	ClientIP string            `json:"client_ip,omitempty"`
+}
+
+// Event 一次错误上报
+type Event struct {
+	EventID     string    `json:"event_id"`
+	Fingerprint string    `json:"fingerprint"`
+	Timestamp   time.Time `json:"timestamp"`
+	Level       string    `json:"level"`
+	Type        string    `json:"type"`
+	Message     string    `json:"message"`
+	Reason      string    `json:"reason,omitempty"`
+	Stack       []Frame   `json:"stack,omitempty"` // 从出错处到最外层调用
+	Request     *Request  `json:"request,omitempty"`
+	RequestID   string    `json:"request_id,omitempty"`
+	UserId      uint64    `json:"user_id,omitempty"`
+	Env         string    `json:"env,omitempty"`
+	Count       int       `json:"count"` // 去重窗口内合并的次数(包含本次)
+}
+
+// ShouldReport 只上报未知错误, 带业务错误码的错误不上报
+func ShouldReport(err error) bool {
+	return err != nil && errors.Code(err) == errors.UnknownCode
+}
+
+// NewEvent 根据error生成上报事件, 栈取自错误链中最深处的 pkg/errors.WithStack
+func NewEvent(err error) *Event {
+	cause := pkgerrors.Cause(err)
+	e := newEvent(LevelError, fmt.Sprintf("%T", cause), err.Error())
+	if se := new(errors.Error); errors.As(err, &se) {
+		e.Reason = se.Reason
+	}
+	e.Stack = stackOf(err)
+	e.Fingerprint = fingerprint(e)
+	return e
+}
+
+// NewPanicEvent 根据recover()的返回值生成上报事件, skip为需要跳过的调用层数
+func NewPanicEvent(recovered any, skip int) *Event {
+	e := newEvent(LevelFatal, fmt.Sprintf("%T", recovered), fmt.Sprintf("panic: %v", recovered))
+	if err, ok := recovered.(error); ok {
+		// panic(err) 且err自带栈时, 优先使用err的栈
+		e.Stack = stackOf(err)
+	}
+	if len(e.Stack) == 0 {
+		e.Stack = callers(skip + 1)
+	}
+	e.Fingerprint = fingerprint(e)
+	return e
+}
+
+func newEvent(level, typ, message string) *Event {
+	return &Event{
+		EventID:   strings.ReplaceAll(uuid.NewString(), "-", ""),
+		Timestamp: time.Now(),
+		Level:     level,
+		Type:      typ,
+		Message:   message,
+		Count:     1,
+	}
+}
+
+// WithRequest 记录请求信息, 敏感请求头会被隐藏
+func (e *Event) WithRequest(r *http.Request, clientIP string) *Event {
+	if r == nil {
+		return e
+	}
+	headers := make(map[string]string, len(r.Header))
+	for k := range r.Header {
+		if _, ok := sensitiveHeaders[k]; ok {
+			headers[k] = "[Filtered]"
+			continue
+		}
+		headers[k] = r.Header.Get(k)
+	}
+	e.Request = &Request{
+		Method:   r.Method,
+		URL:      r.URL.Path,
+		Query:    r.URL.RawQuery,
+		Headers:  headers,
+		ClientIP: clientIP,
+	}
+	return e
+}
+
+// WithUser 记录请求id和登陆用户
+func (e *Event) WithUser(requestID string, userId uint64) *Event {
+	e.RequestID = requestID
+	e.UserId = userId
+	return e
+}
+
+type stackTracer interface {
+	StackTrace() pkgerrors.StackTrace
+}
+
+// stackOf 取错误链中最深处(离出错点最近)的栈
+func stackOf(err error) []Frame {
+	var st pkgerrors.StackTrace
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if s, ok := e.(stackTracer); ok {
+			st = s.StackTrace()
+		}
+	}
+	frames := make([]Frame, 0, len(st))
+	for _, f := range st {
+		pc := uintptr(f) - 1
+		fn := runtime.FuncForPC(pc)
+		if fn == nil {
+			continue
+		}
+		file, line := fn.FileLine(pc)
+		frames = append(frames, Frame{Function: fn.Name(), File: file, Line: line})
+	}
+	return frames
+}
+
+// callers 获取当前调用栈, 跳过runtime内部的栈帧
+func callers(skip int) []Frame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+2, pcs)
+	it := runtime.CallersFrames(pcs[:n])
+	frames := make([]Frame, 0, n)
+	for {
+		f, more := it.Next()
+		if !strings.HasPrefix(f.Function, "runtime.") {
+			frames = append(frames, Frame{Function: f.Function, File: f.File, Line: f.Line})
+		}
+		if !more {
+			break
+		}
+	}
+	return frames
+}
+
+// fingerprint 由错误类型和栈顶的若干帧计算, 没有栈时使用错误信息
+func fingerprint(e *Event) string {
+	h := sha1.New()
+	h.Write([]byte(e.Type))
+	if len(e.Stack) == 0 {
+		h.Write([]byte(e.Message))
+	}
+	for i, f := range e.Stack {
+		if i >= fingerprintFrames {
+			break
+		}
+		_, _ = fmt.Fprintf(h, "|%s:%d", f.Function, f.Line)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
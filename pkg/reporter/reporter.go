@@ -0,0 +1,177 @@
+package reporter
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	logs "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultDedupWindow = time.Minute
+	defaultQueueSize   = 1024
+	// 去重表超过该大小时清理过期的指纹
+	maxFingerprints = 4096
+)
+
+// Sink 错误事件的接收端
+type Sink interface {
+	Send(ctx context.Context, e *Event) error
+	Close() error
+}
+
+// Reporter 按指纹去重后, 异步把错误事件发送到各个Sink
+type Reporter struct {
+	env    string
+	sinks  []Sink
+	window time.Duration
+	logger *logs.Logger
+
+	mu     sync.Mutex
+	seen   map[string]*seenEntry
+	closed bool
+	queue  chan *Event
+	done   chan struct{}
+}
+
+type seenEntry struct {
+	last       time.Time
+	suppressed int
+}
+
+// Options 创建Reporter的选项
+type Options struct {
+	Env         string        // 环境, 事件没有设置时使用
+	File        string        // 以jsonl格式追加写入的本地文件, 为空则不写
+	SentryDSN   string        // sentry协议的dsn, 为空则不上报
+	HTTPClient  *http.Client  // 上报sentry使用的http客户端, 为空时使用3s超时的默认客户端
+	DedupWindow time.Duration // 相同指纹的错误在该时间内只上报一次, 默认60s
+	QueueSize   int           // 异步上报队列长度, 默认1024
+}
+
+// NewReporter 根据选项创建Reporter, 没有配置任何Sink时Report不做任何事
+func NewReporter(opts Options, logger *logs.Logger) (*Reporter, func(), error) {
+	var sinks []Sink
+	if opts.File != "" {
+		s, err := NewFileSink(opts.File)
+		if err != nil {
+			return nil, nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if opts.SentryDSN != "" {
+		s, err := NewSentrySink(opts.SentryDSN, opts.HTTPClient)
+		if err != nil {
+			return nil, nil, err
+		}
+		sinks = append(sinks, s)
+	}
+
+	r := New(logger, opts.DedupWindow, opts.QueueSize, sinks...)
+	r.env = opts.Env
+	return r, r.Close, nil
+}
+
+// New 创建Reporter并启动发送协程, window<=0 使用默认60s, queueSize<=0 使用默认1024
+func New(logger *logs.Logger, window time.Duration, queueSize int, sinks ...Sink) *Reporter {
+	if window <= 0 {
+		window = defaultDedupWindow
+	}
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	r := &Reporter{
+		sinks:  sinks,
+		window: window,
+		logger: logger,
+		seen:   make(map[string]*seenEntry),
+		queue:  make(chan *Event, queueSize),
+		done:   make(chan struct{}),
+	}
+	go r.loop()
+	return r
+}
+
+// Report 上报事件, 相同指纹在去重窗口内只发送第一次, 之后的次数合并到下一次发送的Count中
+func (r *Reporter) Report(e *Event) {
+	if r == nil || e == nil || len(r.sinks) == 0 {
+		return
+	}
+	if e.Env == "" {
+		e.Env = r.env
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	now := time.Now()
+	if s, ok := r.seen[e.Fingerprint]; ok && now.Sub(s.last) < r.window {
+		s.suppressed++
+		return
+	} else if ok {
+		e.Count += s.suppressed
+	}
+	if len(r.seen) >= maxFingerprints {
+		r.prune(now)
+	}
+	r.seen[e.Fingerprint] = &seenEntry{last: now}
+
+	select {
+	case r.queue <- e:
+	default:
+		r.logger.Warnf("reporter queue is full, drop event %s", e.EventID)
+	}
+}
+
+// ReportError 上报未知错误, 带业务错误码的错误会被忽略
+func (r *Reporter) ReportError(err error) *Event {
+	if !ShouldReport(err) {
+		return nil
+	}
+	e := NewEvent(err)
+	r.Report(e)
+	return e
+}
+
+// Close 停止接收新事件, 发送完队列中剩余的事件后关闭所有Sink
+func (r *Reporter) Close() {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.closed = true
+	close(r.queue)
+	r.mu.Unlock()
+
+	<-r.done
+	for _, s := range r.sinks {
+		if err := s.Close(); err != nil {
+			r.logger.Errorf("reporter close sink error: %+v", err)
+		}
+	}
+}
+
+func (r *Reporter) loop() {
+	defer close(r.done)
+	for e := range r.queue {
+		for _, s := range r.sinks {
+			if err := s.Send(context.Background(), e); err != nil {
+				r.logger.Errorf("reporter send event %s error: %+v", e.EventID, err)
+			}
+		}
+	}
+}
+
+// prune 清理已过去重窗口的指纹, 需持有锁
+func (r *Reporter) prune(now time.Time) {
+	for k, s := range r.seen {
+		if now.Sub(s.last) >= r.window {
+			delete(r.seen, k)
+		}
+	}
+}
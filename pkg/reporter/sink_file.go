@@ -0,0 +1,47 @@
+package reporter
+
+import (
+	"context"
+	"gin-layout/pkg"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// FileSink 以jsonl格式(一行一个事件)追加写入本地文件
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink 打开(不存在则创建)文件
+func NewFileSink(path string) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &FileSink{file: f}, nil
+}
+
+func (s *FileSink) Send(_ context.Context, e *Event) error {
+	line, err := pkg.MustToJSON(e)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.WriteString(line + "\n")
+	return errors.WithStack(err)
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return errors.WithStack(s.file.Close())
+}
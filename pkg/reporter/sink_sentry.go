@@ -0,0 +1,131 @@
+package reporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	sentryVersion        = 7
+	sentryClient         = "gin-layout/1.0"
+	defaultSentryTimeout = 3 * time.Second
+)
+
+// SentrySink 按sentry的store协议上报, 兼容sentry及其协议的自建服务
+type SentrySink struct {
+	storeURL string
+	auth     string
+	client   *http.Client
+}
+
+// NewSentrySink dsn格式: {scheme}://{public_key}@{host}/{path}{project_id}, client为空时使用3s超时的默认客户端
+func NewSentrySink(dsn string, client *http.Client) (*SentrySink, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, errors.Errorf("sentry dsn missing public key: %s", dsn)
+	}
+	idx := strings.LastIndex(u.Path, "/")
+	projectID := u.Path[idx+1:]
+	if projectID == "" {
+		return nil, errors.Errorf("sentry dsn missing project id: %s", dsn)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: defaultSentryTimeout}
+	}
+	return &SentrySink{
+		storeURL: fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, u.Path[:idx], projectID),
+		auth: fmt.Sprintf("Sentry sentry_version=%d, sentry_client=%s, sentry_key=%s",
+			sentryVersion, sentryClient, u.User.Username()),
+		client: client,
+	}, nil
+}
+
+func (s *SentrySink) Send(ctx context.Context, e *Event) error {
+	body, err := json.Marshal(toSentryPayload(e))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.storeURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("sentry store status %d: %s", resp.StatusCode, msg)
+	}
+	return nil
+}
+
+func (s *SentrySink) Close() error {
+	return nil
+}
+
+// toSentryPayload 转换为sentry的事件格式, sentry的栈帧顺序是从最外层调用到出错处
+func toSentryPayload(e *Event) map[string]any {
+	frames := make([]map[string]any, 0, len(e.Stack))
+	for i := len(e.Stack) - 1; i >= 0; i-- {
+		f := e.Stack[i]
+		frames = append(frames, map[string]any{
+			"function": f.Function,
+			"abs_path": f.File,
+			"filename": f.File,
+			"lineno":   f.Line,
+			"in_app":   strings.HasPrefix(f.Function, "gin-layout/"),
+		})
+	}
+
+	payload := map[string]any{
+		"event_id":    e.EventID,
+		"timestamp":   e.Timestamp.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		"level":       e.Level,
+		"platform":    "go",
+		"environment": e.Env,
+		"fingerprint": []string{e.Fingerprint},
+		"exception": map[string]any{
+			"values": []map[string]any{{
+				"type":       e.Type,
+				"value":      e.Message,
+				"stacktrace": map[string]any{"frames": frames},
+			}},
+		},
+		"tags": map[string]string{
+			"request_id": e.RequestID,
+			"reason":     e.Reason,
+		},
+		"extra": map[string]any{
+			"count": e.Count,
+		},
+	}
+	if e.UserId > 0 {
+		payload["user"] = map[string]any{"id": fmt.Sprint(e.UserId)}
+	}
+	if e.Request != nil {
+		payload["request"] = map[string]any{
+			"method":       e.Request.Method,
+			"url":          e.Request.URL,
+			"query_string": e.Request.Query,
+			"headers":      e.Request.Headers,
+			"env":          map[string]string{"REMOTE_ADDR": e.Request.ClientIP},
+		}
+	}
+	return payload
+}